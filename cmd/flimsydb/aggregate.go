@@ -0,0 +1,421 @@
+package flimsydb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+aggregates are computed on the stored values, only numbers are decoded
+for SUM and AVG, MIN and MAX compare the stored values and decode just
+the result, NULL is skipped by every aggregate but COUNT(*), over no
+values COUNT is 0 and the others are NULL
+*/
+type aggFunc int
+
+const (
+	aggCount aggFunc = iota
+	aggSum
+	aggAvg
+	aggMin
+	aggMax
+)
+
+var aggFuncNames = [...]string{"count", "sum", "avg", "min", "max"}
+
+/* countAll is the column of Count counting every row */
+const countAll = "*"
+
+/* Aggregate is an aggregate function over a column, its result is named after it unless renamed with As */
+type Aggregate struct {
+	fn    aggFunc
+	col   string
+	alias string
+}
+
+/* Count counts the values of a column which are not NULL, Count("*") counts the rows */
+func Count(col string) Aggregate { return Aggregate{fn: aggCount, col: col} }
+
+/* Sum adds up a numeric column, integers sum to an int64 and decimals to a decimal of the column scale */
+func Sum(col string) Aggregate { return Aggregate{fn: aggSum, col: col} }
+
+/* Avg is the mean of a numeric column as a float64 */
+func Avg(col string) Aggregate { return Aggregate{fn: aggAvg, col: col} }
+
+func Min(col string) Aggregate { return Aggregate{fn: aggMin, col: col} }
+func Max(col string) Aggregate { return Aggregate{fn: aggMax, col: col} }
+
+func (a Aggregate) As(name string) Aggregate {
+	a.alias = name
+	return a
+}
+
+func (a Aggregate) String() string {
+	return fmt.Sprintf("%s(%s)", aggFuncNames[a.fn], a.col)
+}
+
+func (a Aggregate) name() string {
+	if a.alias != "" {
+		return a.alias
+	}
+	return a.String()
+}
+
+/* a bound aggregate of COUNT(*) has no column */
+type boundAgg struct {
+	fn       aggFunc
+	colIndex int
+	col      *Column
+	name     string
+}
+
+func (a Aggregate) bind(t *Table) (boundAgg, error) {
+	if a.col == countAll && a.fn == aggCount {
+		return boundAgg{fn: aggCount, colIndex: -1, name: a.name()}, nil
+	}
+
+	colIndex, exists := t.columnIndex[a.col]
+	if !exists {
+		return boundAgg{}, fmt.Errorf("column '%s': %w", a.col, cm.ErrColumnNotFound)
+	}
+
+	col := t.scheme[colIndex]
+	if a.fn == aggSum || a.fn == aggAvg {
+		switch col.Type {
+		case cm.Int32TType, cm.Int64TType, cm.Float64TType, cm.DecimalTType:
+		default:
+			return boundAgg{}, fmt.Errorf("%v: column is not numeric: %w", a, cm.ErrTypeMismatch)
+		}
+	}
+
+	return boundAgg{a.fn, colIndex, col, a.name()}, nil
+}
+
+/* aggState accumulates one aggregate, integers and decimals sum exactly in sumInt */
+type aggState struct {
+	count    int
+	sumInt   int64
+	sumFloat float64
+	extreme  cm.Blob
+}
+
+func (a boundAgg) accumulate(state *aggState, row Row) error {
+	if a.colIndex < 0 {
+		state.count++
+		return nil
+	}
+
+	value := row[a.colIndex]
+	if cm.IsNull(value) {
+		return nil
+	}
+	state.count++
+
+	switch a.fn {
+	case aggSum, aggAvg:
+		return a.add(state, value)
+	case aggMin:
+		if state.extreme == nil || bytes.Compare(value, state.extreme) < 0 {
+			state.extreme = value
+		}
+	case aggMax:
+		if state.extreme == nil || bytes.Compare(value, state.extreme) > 0 {
+			state.extreme = value
+		}
+	}
+
+	return nil
+}
+
+func (a boundAgg) add(state *aggState, value cm.Blob) error {
+	var n int64
+	switch a.col.Type {
+	case cm.Float64TType:
+		f, err := cm.DecodeFloat64(value)
+		if err != nil {
+			return err
+		}
+		state.sumFloat += f
+		return nil
+	case cm.Int32TType:
+		i, err := cm.DecodeInt32(value)
+		if err != nil {
+			return err
+		}
+		n = int64(i)
+	case cm.Int64TType:
+		i, err := cm.DecodeInt64(value)
+		if err != nil {
+			return err
+		}
+		n = i
+	case cm.DecimalTType:
+		d, err := cm.DecodeDecimal(value)
+		if err != nil {
+			return err
+		}
+		n = d.Unscaled
+	}
+
+	sum := state.sumInt + n
+	if (n > 0 && sum < state.sumInt) || (n < 0 && sum > state.sumInt) {
+		return fmt.Errorf("%s: sum overflow: %w", a.name, cm.ErrInvalidData)
+	}
+	state.sumInt = sum
+	return nil
+}
+
+func (a boundAgg) result(state *aggState) (any, error) {
+	if a.fn == aggCount {
+		return state.count, nil
+	}
+	if state.count == 0 {
+		return nil, nil
+	}
+
+	switch a.fn {
+	case aggSum:
+		switch a.col.Type {
+		case cm.Float64TType:
+			return state.sumFloat, nil
+		case cm.DecimalTType:
+			return cm.NewDecimal(state.sumInt, a.col.Scale), nil
+		default:
+			return state.sumInt, nil
+		}
+
+	case aggAvg:
+		switch a.col.Type {
+		case cm.Float64TType:
+			return state.sumFloat / float64(state.count), nil
+		case cm.DecimalTType:
+			return float64(state.sumInt) / math.Pow10(a.col.Scale) / float64(state.count), nil
+		default:
+			return float64(state.sumInt) / float64(state.count), nil
+		}
+
+	default:
+		return a.col.deserialize(state.extreme)
+	}
+}
+
+/*
+indexedResult answers an aggregate without deserializing rows, COUNT(*)
+counts the row ids of an exact access path, COUNT(col) counts them too
+when the path is an equality on col, which never matches NULL, and the
+non-NULL values of col otherwise, MIN and MAX of the whole table are the
+first and the last values of a B-tree, the caller must hold the read lock
+*/
+func (t *Table) indexedResult(a boundAgg, pred boundPred) (*aggState, bool) {
+	switch a.fn {
+	case aggCount:
+		state := &aggState{}
+		if pred == nil {
+			if a.colIndex < 0 {
+				return &aggState{count: len(t.slots)}, true
+			}
+			for _, row := range t.rows {
+				if row != nil && !cm.IsNull(row[a.colIndex]) {
+					state.count++
+				}
+			}
+			return state, true
+		}
+
+		path, residual := t.planAccess(pred)
+		if path == nil || residual != nil {
+			return nil, false
+		}
+		eq, isEq := pred.(boundEq)
+		countRows := a.colIndex < 0 || isEq && eq.colIndex == a.colIndex
+		for _, id := range path.ids() {
+			if countRows {
+				if t.rowExists(id) {
+					state.count++
+				}
+			} else if row, exists := t.rowByID(id); exists && !cm.IsNull(row[a.colIndex]) {
+				state.count++
+			}
+		}
+		return state, true
+
+	case aggMin, aggMax:
+		ordered, ok := a.col.Idxr.(indexer.OrderedIndexer)
+		if pred != nil || a.col.IdxrType != indexer.BTreeIndexerType || !ok {
+			return nil, false
+		}
+		state := &aggState{}
+		visit := func(val cm.Blob, ptrs []int) bool {
+			if !cm.IsNull(val) {
+				state.extreme, state.count = val, 1
+			}
+			return false
+		}
+		if a.fn == aggMin {
+			ordered.Ascend(lowestValue, visit)
+		} else {
+			ordered.Descend(nil, visit)
+		}
+		return state, true
+
+	default:
+		return nil, false
+	}
+}
+
+/* aggGroup holds the states of a group and one of its rows, which gives the values of the grouping columns */
+type aggGroup struct {
+	key    string
+	row    Row
+	states []aggState
+}
+
+/*
+GroupBy makes Aggregate return a record per distinct combination of
+values of the columns, NULLs form a group of their own
+*/
+func (q *Query) GroupBy(cols ...string) *Query {
+	q.groupBy = append(q.groupBy, cols...)
+	return q
+}
+
+/*
+Aggregate runs the query and returns a record per group holding the
+grouping columns and the aggregates, without GroupBy the whole result
+is a single group, groups are sorted by the grouping columns unless
+ordered by them with OrderBy, Limit and Offset apply to the groups
+*/
+func (q *Query) Aggregate(aggs ...Aggregate) ([]Record, error) {
+	t := q.table
+	if len(q.columns) != 0 {
+		return nil, fmt.Errorf("aggregate queries select the grouping columns and the aggregates: %w", cm.ErrInvalidData)
+	}
+
+	group, err := t.bindProjection(q.groupBy)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.groupBy) == 0 {
+		group = nil
+	}
+
+	bound := make([]boundAgg, len(aggs))
+	for i, agg := range aggs {
+		if bound[i], err = agg.bind(t); err != nil {
+			return nil, err
+		}
+	}
+
+	pred, keys, err := q.bind()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if !containsColumn(group, key.colIndex) {
+			return nil, fmt.Errorf("column '%s' is not grouped and cannot order the groups: %w", t.scheme[key.colIndex].Name, cm.ErrInvalidData)
+		}
+	}
+	if len(keys) == 0 {
+		for _, colIndex := range group {
+			keys = append(keys, boundSortKey{colIndex: colIndex})
+		}
+	}
+
+	groups, err := t.aggregate(pred, group, bound)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if c := compareRows(keys, groups[i].row, groups[j].row); c != 0 {
+			return c < 0
+		}
+		return groups[i].key < groups[j].key
+	})
+	groups = page(groups, q.offset, q.limit)
+
+	records := make([]Record, len(groups))
+	for i, g := range groups {
+		record := make(Record, len(group)+len(bound))
+		for _, colIndex := range group {
+			if record[t.scheme[colIndex].Name], err = t.scheme[colIndex].deserialize(g.row[colIndex]); err != nil {
+				return nil, fmt.Errorf("row deserialization error: %w", err)
+			}
+		}
+		for j, agg := range bound {
+			if record[agg.name], err = agg.result(&g.states[j]); err != nil {
+				return nil, err
+			}
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
+
+func containsColumn(cols []int, colIndex int) bool {
+	for _, c := range cols {
+		if c == colIndex {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Table) aggregate(pred boundPred, group []int, aggs []boundAgg) ([]*aggGroup, error) {
+	t.mu.RLock()
+	if len(group) == 0 {
+		states := make([]aggState, len(aggs))
+		indexed := true
+		for i, agg := range aggs {
+			state, ok := t.indexedResult(agg, pred)
+			if !ok {
+				indexed = false
+				break
+			}
+			states[i] = *state
+		}
+		if indexed {
+			t.mu.RUnlock()
+			return []*aggGroup{{states: states}}, nil
+		}
+	}
+	rows, _ := t.selectRows(pred)
+	t.mu.RUnlock()
+
+	var groups []*aggGroup
+	byKey := make(map[string]*aggGroup)
+	if len(group) == 0 {
+		/* a query without grouping has a result even when no row matches */
+		groups = append(groups, &aggGroup{states: make([]aggState, len(aggs))})
+		byKey[""] = groups[0]
+	}
+
+	var key []byte
+	for _, row := range rows {
+		key = key[:0]
+		for _, colIndex := range group {
+			key = appendKeyPart(key, row[colIndex])
+		}
+
+		g, exists := byKey[string(key)]
+		if !exists {
+			g = &aggGroup{key: string(key), row: row, states: make([]aggState, len(aggs))}
+			byKey[g.key] = g
+			groups = append(groups, g)
+		}
+		for i, agg := range aggs {
+			if err := agg.accumulate(&g.states[i], row); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,81 @@
+package flimsydb
+
+import (
+	"bytes"
+	"fmt"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+func (t *Table) prepareElement(colName string, elem any) (int, cm.Blob, error) {
+	colIndex, exists := t.columnIndex[colName]
+	if !exists {
+		return 0, nil, fmt.Errorf("column with name %q does not exist", colName)
+	}
+
+	col := t.scheme[colIndex]
+	elemType, isArray := cm.ElementType(col.Type)
+	if !isArray {
+		return 0, nil, fmt.Errorf("column '%s' is not an array column: %w", colName, cm.ErrTypeMismatch)
+	}
+	if elem == nil {
+		return 0, nil, fmt.Errorf("arrays cannot hold NULL elements: %w", cm.ErrInvalidData)
+	}
+	if err := validateType(elem, elemType); err != nil {
+		return 0, nil, fmt.Errorf("validation error: %w", err)
+	}
+
+	blobElem, err := Serialize(elemType, elem)
+	if err != nil {
+		return 0, nil, fmt.Errorf("value serialization error: %w", err)
+	}
+
+	return colIndex, blobElem, nil
+}
+
+/* arrayContains reports whether the stored array holds the encoded element, NULL holds nothing */
+func arrayContains(elemType cm.TabularType, array cm.Blob, elem cm.Blob) bool {
+	if cm.IsNull(array) {
+		return false
+	}
+
+	elems, err := cm.DecodeArray(elemType, array)
+	if err != nil {
+		return false
+	}
+	for _, e := range elems {
+		if bytes.Equal(e, elem) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/* FindContaining returns the rows whose array column holds elem, it uses an inverted indexer when the column has one */
+func (t *Table) FindContaining(colName string, elem any) ([][]any, error) {
+	colIndex, blobElem, err := t.prepareElement(colName, elem)
+	if err != nil {
+		return nil, err
+	}
+
+	col := t.scheme[colIndex]
+	elemType, _ := cm.ElementType(col.Type)
+
+	t.mu.RLock()
+	var ids []int
+	if col.IdxrType == indexer.InvertedIndexerType {
+		ids = col.Idxr.Find(blobElem)
+	} else {
+		for slot, row := range t.rows {
+			if row != nil && arrayContains(elemType, row[colIndex], blobElem) {
+				ids = append(ids, t.rowIDs[slot])
+			}
+		}
+	}
+	rows := t.rowsByIDs(ids)
+	t.mu.RUnlock()
+
+	return deserializeRows(t.scheme, rows)
+}
@@ -19,17 +19,17 @@ not be changed during its execution, the function requires
 that during its execution the passed column rows do not
 change their value
 */
-func IdxrAddRow(scheme Scheme, row Row, index int) error {
+func IdxrAddRow(scheme Scheme, row Row, id int) error {
 	completedOps := make(map[*Column]cm.Blob)
 	for i, col := range scheme {
 		if col.IdxrType == indexer.AbsentIndexerType {
 			continue
 		}
 
-		if err := col.Idxr.Add(row[i], index); err != nil {
+		if err := col.Idxr.Add(row[i], id); err != nil {
 			var rollbackErr error
 			for col, v := range completedOps {
-				if rErr := col.Idxr.Delete(v, index); rErr != nil {
+				if rErr := col.Idxr.Delete(v, id); rErr != nil {
 					rollbackErr = fmt.Errorf("rollback failed for column %v: %w", col, rErr)
 				}
 			}
@@ -45,17 +45,17 @@ func IdxrAddRow(scheme Scheme, row Row, index int) error {
 	return nil
 }
 
-func IdxrUpdateRow(scheme Scheme, oldRow Row, newRow Row, index int) error {
-	updatedOps := make(map[*Column]cm.Blob)
+func IdxrUpdateRow(scheme Scheme, oldRow Row, newRow Row, id int) error {
+	updatedOps := make(map[*Column]int)
 	for i, col := range scheme {
 		if col.IdxrType == indexer.AbsentIndexerType {
 			continue
 		}
 
-		if err := col.Idxr.Update(oldRow[i], newRow[i], index); err != nil {
+		if err := col.Idxr.Update(oldRow[i], newRow[i], id); err != nil {
 			var rollbackErr error
-			for col, v := range updatedOps {
-				if rErr := col.Idxr.Update(newRow[i], v, index); rErr != nil {
+			for col, j := range updatedOps {
+				if rErr := col.Idxr.Update(newRow[j], oldRow[j], id); rErr != nil {
 					rollbackErr = fmt.Errorf("rollback failed for column %v: %w", col, rErr)
 				}
 			}
@@ -65,23 +65,23 @@ func IdxrUpdateRow(scheme Scheme, oldRow Row, newRow Row, index int) error {
 			return fmt.Errorf("error updating index: %w", err)
 		}
 
-		updatedOps[col] = oldRow[i]
+		updatedOps[col] = i
 	}
 
 	return nil
 }
 
-func IdxrDeleteRow(scheme Scheme, row Row, index int) error {
+func IdxrDeleteRow(scheme Scheme, row Row, id int) error {
 	deletedOps := make(map[*Column]cm.Blob)
 	for i, col := range scheme {
 		if col.IdxrType == indexer.AbsentIndexerType {
 			continue
 		}
 
-		if err := col.Idxr.Delete(row[i], index); err != nil {
+		if err := col.Idxr.Delete(row[i], id); err != nil {
 			var rollbackErr error
 			for col, v := range deletedOps {
-				if rErr := col.Idxr.Add(v, index); rErr != nil {
+				if rErr := col.Idxr.Add(v, id); rErr != nil {
 					rollbackErr = fmt.Errorf("rollback failed for column %v: %w", col, rErr)
 				}
 			}
@@ -0,0 +1,149 @@
+package flimsydb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+const snapshotFileName = "snapshot.db"
+
+/*
+the snapshot uses the log record format: a checkpoint record holding
+the last log sequence number it covers, followed by a table creation
+record and the insertion records of its rows for every table
+*/
+
+/*
+Checkpoint writes a consistent snapshot of every table and truncates
+the write-ahead log, so the next Open does not replay the whole history
+*/
+func (db *FlimsyDB) Checkpoint() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return cm.ErrClosed
+	}
+	if db.wal == nil {
+		return cm.ErrNotPersistent
+	}
+
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	/* table writers log under the write lock, so holding read locks freezes the log */
+	for _, name := range names {
+		table := db.tables[name]
+		table.mu.RLock()
+		defer table.mu.RUnlock()
+	}
+
+	path := filepath.Join(db.dir, snapshotFileName)
+	if err := db.writeSnapshot(path, names); err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+
+	if err := db.wal.reset(); err != nil {
+		return fmt.Errorf("log truncation failed: %w", err)
+	}
+
+	return nil
+}
+
+func (db *FlimsyDB) writeSnapshot(path string, names []string) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if err := writeRecord(writer, &walRecord{Op: walCheckpoint, LSN: db.wal.lsn}); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		table := db.tables[name]
+		rec := &walRecord{Op: walCreateTable, Table: name, Scheme: schemeToWAL(table.scheme), NextID: table.nextRowID, Indexes: table.indexesToWAL()}
+		if err := writeRecord(writer, rec); err != nil {
+			return err
+		}
+
+		for slot, row := range table.rows {
+			if row == nil {
+				continue
+			}
+
+			rec := &walRecord{Op: walInsertRow, Table: name, RowID: table.rowIDs[slot], Row: row}
+			if err := writeRecord(writer, rec); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+/* loadSnapshot returns the log sequence number covered by the snapshot */
+func (db *FlimsyDB) loadSnapshot(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var lsn uint64
+	_, err = readRecords(file, func(rec *walRecord) error {
+		if rec.Op == walCheckpoint {
+			lsn = rec.LSN
+			return nil
+		}
+		return db.applyRecord(rec)
+	})
+	if errors.Is(err, errDamagedRecord) {
+		return 0, fmt.Errorf("%w: damaged record", cm.ErrSnapshotCorrupted)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return lsn, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
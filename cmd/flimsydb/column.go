@@ -1,7 +1,9 @@
 package flimsydb
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 
 	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
 	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
@@ -17,11 +19,21 @@ const (
 	ImmutableFlag
 )
 
-/*
-It may be worth reforming the flags to be able to supplement their information,
-for example, in the case of a foreign key, store which table and column it refers to,
-and do the appropriate checks for existence and consistency
-*/
+/* ReferenceAction tells what happens to referencing rows when the referenced row is deleted */
+type ReferenceAction int
+
+const (
+	RestrictAction ReferenceAction = iota
+	CascadeAction
+	SetNullAction
+)
+
+/* Reference is the target of a foreign key, the referenced column must be unique */
+type Reference struct {
+	Table    string
+	Column   string
+	OnDelete ReferenceAction
+}
 
 type Column struct {
 	Name     string
@@ -30,36 +42,184 @@ type Column struct {
 	IdxrType indexer.IndexerType
 	Idxr     indexer.Indexer
 	Flags    FlagsType
+	Ref      *Reference
+
+	/* total and fractional digits of a decimal column */
+	Precision int
+	Scale     int
+
+	/* allowed values of an enum column in declaration order */
+	Labels []string
 }
 
 type Scheme []*Column
 
-func NewColumn(name string, valType cm.TabularType, defaultVal any, idxrType indexer.IndexerType, flags FlagsType) (*Column, error) {
-	if err := validateType(defaultVal, valType); err != nil {
+type ColumnOption func(col *Column)
+
+/* WithReference makes the column a foreign key referring to column of table */
+func WithReference(table string, column string, onDelete ReferenceAction) ColumnOption {
+	return func(col *Column) {
+		col.Ref = &Reference{Table: table, Column: column, OnDelete: onDelete}
+	}
+}
+
+/* WithDecimal sets the precision and scale of a decimal column */
+func WithDecimal(precision int, scale int) ColumnOption {
+	return func(col *Column) {
+		col.Precision = precision
+		col.Scale = scale
+	}
+}
+
+/* WithEnum declares the labels of an enum column, their order is the sort order of the column */
+func WithEnum(labels ...string) ColumnOption {
+	return func(col *Column) {
+		col.Labels = slices.Clone(labels)
+	}
+}
+
+func NewColumn(name string, valType cm.TabularType, defaultVal any, idxrType indexer.IndexerType, flags FlagsType, opts ...ColumnOption) (*Column, error) {
+	col := &Column{Name: name, Type: valType}
+	for _, opt := range opts {
+		opt(col)
+	}
+
+	if valType == cm.EnumTType {
+		if err := validateLabels(col.Labels); err != nil {
+			return nil, err
+		}
+	} else if col.Labels != nil {
+		return nil, fmt.Errorf("labels only apply to enum columns")
+	}
+
+	if err := col.validate(defaultVal); err != nil {
 		return nil, err
 	}
 
+	if valType == cm.DecimalTType {
+		if col.Precision < 1 || col.Precision > cm.MaxDecimalPrecision || col.Scale < 0 || col.Scale > col.Precision {
+			return nil, fmt.Errorf("decimal column needs 1 <= precision <= %d and 0 <= scale <= precision, got (%d, %d)", cm.MaxDecimalPrecision, col.Precision, col.Scale)
+		}
+	} else if col.Precision != 0 || col.Scale != 0 {
+		return nil, fmt.Errorf("precision and scale only apply to decimal columns")
+	}
+
+	if _, isArray := cm.ElementType(valType); idxrType == indexer.InvertedIndexerType && !isArray {
+		return nil, fmt.Errorf("an inverted indexer needs an array column")
+	}
+
 	/* flag validation */
+	if col.Ref != nil {
+		flags |= ForeignKeyFlag
+	}
 	if flags&PrimaryKeyFlag != 0 && flags&ForeignKeyFlag != 0 {
 		return nil, fmt.Errorf("flags error: a field cannot be both a primary and a foreign key")
 	}
+	/* the table enforces the uniqueness of all primary key columns together */
 	if flags&PrimaryKeyFlag != 0 {
-		flags |= UniqueFlag | NotNullFlag
+		flags |= NotNullFlag
+	}
+	setNull := col.Ref != nil && col.Ref.OnDelete == SetNullAction
+	if setNull && flags&NotNullFlag != 0 {
+		return nil, fmt.Errorf("flags error: a \"not null\" foreign key cannot use the set null action")
 	}
-	if flags&ForeignKeyFlag != 0 && flags&NotNullFlag == 0 {
+	if flags&ForeignKeyFlag != 0 && flags&NotNullFlag == 0 && !setNull {
 		flags |= NotNullFlag
 	}
 
-	blobDefaultVal, err := Serialize(valType, defaultVal)
+	blobDefaultVal, err := col.serialize(defaultVal)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Column{
-		Name:     name,
-		Type:     valType,
-		Default:  blobDefaultVal,
-		IdxrType: idxrType,
-		Idxr:     indexer.NewIndexer(idxrType, valType),
-	}, nil
+	col.Default = blobDefaultVal
+	col.IdxrType = idxrType
+	col.Idxr = indexer.NewIndexer(idxrType, valType)
+	col.Flags = flags
+
+	return col, nil
+}
+
+func validateLabels(labels []string) error {
+	if len(labels) == 0 || len(labels) > cm.MaxEnumLabels {
+		return fmt.Errorf("enum column needs 1 to %d labels, got %d", cm.MaxEnumLabels, len(labels))
+	}
+
+	seen := make(map[string]struct{}, len(labels))
+	for _, label := range labels {
+		if _, dup := seen[label]; dup {
+			return fmt.Errorf("enum label %q is declared twice", label)
+		}
+		seen[label] = struct{}{}
+	}
+
+	return nil
+}
+
+/* validate checks the type of a value and, for enum columns, that it is one of the labels */
+func (col *Column) validate(value any) error {
+	if err := validateType(value, col.Type); err != nil {
+		return err
+	}
+
+	if col.Type == cm.EnumTType && value != nil && !slices.Contains(col.Labels, value.(string)) {
+		return fmt.Errorf("%q is not a label of enum column '%s'", value, col.Name)
+	}
+
+	return nil
+}
+
+/*
+serialize converts decimals to the precision and scale of the column and
+enum labels to their position, other types serialize as is
+*/
+func (col *Column) serialize(value any) (cm.Blob, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch col.Type {
+	case cm.EnumTType:
+		label, ok := value.(string)
+		if !ok {
+			return nil, errors.New("value does not match enum label type")
+		}
+		ordinal := slices.Index(col.Labels, label)
+		if ordinal < 0 {
+			return nil, fmt.Errorf("%q is not a label of enum column '%s'", label, col.Name)
+		}
+		return cm.EncodeEnum(ordinal), nil
+
+	case cm.DecimalTType:
+		d, err := cm.ToDecimal(value)
+		if err != nil {
+			return nil, err
+		}
+		if d, err = d.Rescale(col.Scale); err != nil {
+			return nil, err
+		}
+		if d.Digits() > col.Precision {
+			return nil, fmt.Errorf("decimal %v has more than %d digits", d, col.Precision)
+		}
+		return Serialize(col.Type, d)
+
+	default:
+		return Serialize(col.Type, value)
+	}
+}
+
+/* deserialize turns enum positions back into labels, other types deserialize as is */
+func (col *Column) deserialize(value cm.Blob) (any, error) {
+	if col.Type != cm.EnumTType || cm.IsNull(value) {
+		return Deserialize(col.Type, value)
+	}
+
+	ordinal, err := cm.DecodeEnum(value)
+	if err != nil {
+		return nil, err
+	}
+	if ordinal >= len(col.Labels) {
+		return nil, fmt.Errorf("enum column '%s' has no label at position %d", col.Name, ordinal)
+	}
+	return col.Labels[ordinal], nil
 }
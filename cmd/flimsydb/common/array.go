@@ -0,0 +1,79 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+/*
+an array is stored as its element count followed by the encoded elements,
+which are fixed-size or self-delimiting, so they can be split without
+further framing, arrays sort by length first and then element by element,
+an empty array is a value and not NULL
+*/
+func EncodeArray(elems []Blob) Blob {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(elems)))
+	for _, elem := range elems {
+		b = append(b, elem...)
+	}
+
+	return b
+}
+
+/* DecodeArray splits an encoded array into the encoded elements, which share the memory of b */
+func DecodeArray(elemType TabularType, b Blob) ([]Blob, error) {
+	if len(b) < 4 {
+		return nil, errMalformedValue
+	}
+
+	count := binary.BigEndian.Uint32(b)
+	rest := b[4:]
+	if uint64(count) > uint64(len(rest)) {
+		return nil, errMalformedValue
+	}
+
+	elems := make([]Blob, 0, count)
+	for range count {
+		size, err := elementSize(elemType, rest)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, rest[:size:size])
+		rest = rest[size:]
+	}
+	if len(rest) != 0 {
+		return nil, errMalformedValue
+	}
+
+	return elems, nil
+}
+
+func elementSize(elemType TabularType, b Blob) (int, error) {
+	size := 0
+	switch elemType {
+	case Int32TType:
+		size = 4
+	case Int64TType:
+		size = 8
+	case StringTType:
+		/* an escaped zero byte is followed by 0xff, only the terminator by 0x01 */
+		for i := 0; ; i += 2 {
+			end := bytes.IndexByte(b[i:], 0x00)
+			if end < 0 || i+end+1 >= len(b) {
+				return 0, errMalformedValue
+			}
+			i += end
+			if b[i+1] == 0x01 {
+				size = i + 2
+				break
+			}
+		}
+	default:
+		return 0, errMalformedValue
+	}
+
+	if size > len(b) {
+		return 0, errMalformedValue
+	}
+	return size, nil
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+/* MaxDecimalPrecision is the number of digits that always fit into the int64 holding a decimal */
+const MaxDecimalPrecision = 18
+
+/* Decimal is an exact fixed-point number equal to Unscaled * 10^-Scale */
+type Decimal struct {
+	Unscaled int64
+	Scale    int
+}
+
+var errDecimalOverflow = errors.New("decimal overflow")
+
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return Decimal{Unscaled: unscaled, Scale: scale}
+}
+
+/* ParseDecimal reads numbers like "-12.50" without going through floating point */
+func ParseDecimal(s string) (Decimal, error) {
+	digits := s
+	negative := false
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		negative = digits[0] == '-'
+		digits = digits[1:]
+	}
+
+	intPart, fracPart, hasPoint := strings.Cut(digits, ".")
+	if intPart == "" && fracPart == "" || hasPoint && fracPart == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	var d Decimal
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+		if d.Unscaled > (math.MaxInt64-int64(c-'0'))/10 {
+			return Decimal{}, fmt.Errorf("decimal %q: %w", s, errDecimalOverflow)
+		}
+		d.Unscaled = d.Unscaled*10 + int64(c-'0')
+	}
+	d.Scale = len(fracPart)
+
+	if negative {
+		d.Unscaled = -d.Unscaled
+	}
+	return d, nil
+}
+
+/* ToDecimal converts strings, integers and decimals, floats are refused because they are not exact */
+func ToDecimal(v any) (Decimal, error) {
+	switch v := v.(type) {
+	case Decimal:
+		return v, nil
+	case string:
+		return ParseDecimal(v)
+	case int:
+		return Decimal{Unscaled: int64(v)}, nil
+	case int32:
+		return Decimal{Unscaled: int64(v)}, nil
+	case int64:
+		return Decimal{Unscaled: v}, nil
+	default:
+		return Decimal{}, fmt.Errorf("cannot convert %T to a decimal", v)
+	}
+}
+
+/* Rescale changes the number of fractional digits, it fails instead of rounding */
+func (d Decimal) Rescale(scale int) (Decimal, error) {
+	for d.Scale < scale {
+		if d.Unscaled > math.MaxInt64/10 || d.Unscaled < math.MinInt64/10 {
+			return Decimal{}, errDecimalOverflow
+		}
+		d.Unscaled *= 10
+		d.Scale++
+	}
+	for d.Scale > scale {
+		if d.Unscaled%10 != 0 {
+			return Decimal{}, fmt.Errorf("decimal %v does not fit into scale %d without rounding", d, scale)
+		}
+		d.Unscaled /= 10
+		d.Scale--
+	}
+
+	return d, nil
+}
+
+/* Digits returns the number of digits of the unscaled value */
+func (d Decimal) Digits() int {
+	n := 1
+	for v := d.Unscaled / 10; v != 0; v /= 10 {
+		n++
+	}
+	return n
+}
+
+func (d Decimal) String() string {
+	abs := fmt.Sprintf("%d", d.Unscaled)
+	sign := ""
+	if strings.HasPrefix(abs, "-") {
+		sign, abs = "-", abs[1:]
+	}
+	if d.Scale <= 0 {
+		return sign + abs + strings.Repeat("0", -d.Scale)
+	}
+
+	if len(abs) <= d.Scale {
+		abs = strings.Repeat("0", d.Scale-len(abs)+1) + abs
+	}
+	point := len(abs) - d.Scale
+	return sign + abs[:point] + "." + abs[point:]
+}
+
+/*
+a decimal is stored as its unscaled value followed by its scale, all
+values of a column share the scale, so they sort by the unscaled value
+*/
+func EncodeDecimal(d Decimal) Blob {
+	return append(EncodeInt64(d.Unscaled), byte(d.Scale))
+}
+
+func DecodeDecimal(b Blob) (Decimal, error) {
+	if len(b) != 9 {
+		return Decimal{}, errMalformedValue
+	}
+
+	unscaled, err := DecodeInt64(b[:8])
+	if err != nil {
+		return Decimal{}, err
+	}
+	return Decimal{Unscaled: unscaled, Scale: int(b[8])}, nil
+}
@@ -0,0 +1,169 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+/*
+values are stored in an order-preserving encoding: for any two values
+of a type, bytes.Compare of their encodings orders them like the values
+themselves, so indexers and comparators never decode anything,
+NULL is the empty blob and sorts before every value
+*/
+
+var errMalformedValue = errors.New("malformed encoded value")
+
+/* the sign bit is flipped, so negative numbers sort before positive ones */
+func EncodeInt32(v int32) Blob {
+	return binary.BigEndian.AppendUint32(nil, uint32(v)^(1<<31))
+}
+
+func DecodeInt32(b Blob) (int32, error) {
+	if len(b) != 4 {
+		return 0, errMalformedValue
+	}
+	return int32(binary.BigEndian.Uint32(b) ^ (1 << 31)), nil
+}
+
+func EncodeInt64(v int64) Blob {
+	return binary.BigEndian.AppendUint64(nil, uint64(v)^(1<<63))
+}
+
+func DecodeInt64(b Blob) (int64, error) {
+	if len(b) != 8 {
+		return 0, errMalformedValue
+	}
+	return int64(binary.BigEndian.Uint64(b) ^ (1 << 63)), nil
+}
+
+/* timestamps are UTC nanoseconds since the Unix epoch, so they cover the years 1678 to 2262 */
+func EncodeTimestamp(v time.Time) Blob {
+	return EncodeInt64(v.UnixNano())
+}
+
+func DecodeTimestamp(b Blob) (time.Time, error) {
+	n, err := DecodeInt64(b)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, n).UTC(), nil
+}
+
+func EncodeBool(v bool) Blob {
+	if v {
+		return Blob{0x01}
+	}
+	return Blob{0x00}
+}
+
+func DecodeBool(b Blob) (bool, error) {
+	if len(b) != 1 || b[0] > 0x01 {
+		return false, errMalformedValue
+	}
+	return b[0] == 0x01, nil
+}
+
+/* an enum value is stored as the position of its label, so enums sort in declaration order */
+const MaxEnumLabels = 1 << 16
+
+func EncodeEnum(ordinal int) Blob {
+	return binary.BigEndian.AppendUint16(nil, uint16(ordinal))
+}
+
+func DecodeEnum(b Blob) (int, error) {
+	if len(b) != 2 {
+		return 0, errMalformedValue
+	}
+	return int(binary.BigEndian.Uint16(b)), nil
+}
+
+/*
+positive floats get the sign bit set and negative floats have all bits
+inverted, so larger magnitudes of negative numbers sort first,
+negative zero is stored as zero and NaN sorts after every number
+*/
+func EncodeFloat64(v float64) Blob {
+	if v == 0 {
+		v = 0
+	}
+	if math.IsNaN(v) {
+		v = math.NaN()
+	}
+
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return binary.BigEndian.AppendUint64(nil, bits)
+}
+
+func DecodeFloat64(b Blob) (float64, error) {
+	if len(b) != 8 {
+		return 0, errMalformedValue
+	}
+
+	bits := binary.BigEndian.Uint64(b)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits), nil
+}
+
+/*
+zero bytes are escaped as 0x00 0xff and the string is terminated by 0x00 0x01,
+so a string sorts before the strings it is a prefix of, the encoding is
+self-delimiting and even the empty string is not mistaken for NULL
+*/
+func EncodeString(v string) Blob {
+	return EncodeBytes([]byte(v))
+}
+
+func DecodeString(b Blob) (string, error) {
+	s, err := DecodeBytes(b)
+	return string(s), err
+}
+
+/* raw bytes use the string encoding, so an empty slice is a value and not NULL */
+func EncodeBytes(v []byte) Blob {
+	b := make(Blob, 0, len(v)+2)
+	for _, c := range v {
+		b = append(b, c)
+		if c == 0x00 {
+			b = append(b, 0xff)
+		}
+	}
+
+	return append(b, 0x00, 0x01)
+}
+
+func DecodeBytes(b Blob) ([]byte, error) {
+	s := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0x00 {
+			s = append(s, b[i])
+			continue
+		}
+		if i+1 >= len(b) {
+			return nil, errMalformedValue
+		}
+
+		i++
+		switch {
+		case b[i] == 0xff:
+			s = append(s, 0x00)
+		case b[i] == 0x01 && i == len(b)-1:
+			return s, nil
+		default:
+			return nil, errMalformedValue
+		}
+	}
+
+	return nil, errMalformedValue
+}
@@ -4,18 +4,45 @@ import "errors"
 
 var (
 	// Table errors
-	ErrTableExists   = errors.New("table already exists")
-	ErrTableNotFound = errors.New("table not found")
+	ErrTableExists     = errors.New("table already exists")
+	ErrTableNotFound   = errors.New("table not found")
+	ErrTableReferenced = errors.New("table is referenced by a foreign key")
 
 	// Column errors
 	ErrColumnNotFound = errors.New("column not found")
 
 	// Data errors
-	ErrTypeMismatch = errors.New("value type does not match column type")
-	ErrInvalidData  = errors.New("invalid data provided")
+	ErrTypeMismatch  = errors.New("value type does not match column type")
+	ErrInvalidData   = errors.New("invalid data provided")
+	ErrNullViolation = errors.New("NULL value in a column marked with the \"not null\" flag")
+
+	// Primary key errors
+	ErrNoPrimaryKey = errors.New("table has no primary key")
+	ErrDuplicateKey = errors.New("duplicate primary key")
+
+	// Foreign key errors
+	ErrInvalidReference    = errors.New("invalid foreign key reference")
+	ErrForeignKeyViolation = errors.New("foreign key constraint violated")
+
+	// Row errors
+	ErrRowNotFound = errors.New("row not found")
 
 	// Index errors
 	ErrIndexOutOfBounds = errors.New("row index out of bounds")
 	ErrIndexExists      = errors.New("index already exists")
 	ErrIndexNotFound    = errors.New("index not found")
+
+	// Transaction errors
+	ErrTxDone           = errors.New("transaction has already been committed or rolled back")
+	ErrSnapshotReleased = errors.New("snapshot has already been released")
+	ErrTxConflict       = errors.New("row was changed by another transaction after Begin")
+
+	// Storage errors
+	ErrLogCorrupted      = errors.New("write-ahead log is corrupted")
+	ErrSnapshotCorrupted = errors.New("snapshot is corrupted")
+	ErrNotPersistent     = errors.New("database is not backed by a directory")
+	ErrClosed            = errors.New("database is closed")
+
+	// SQL errors
+	ErrSyntax = errors.New("SQL syntax error")
 )
@@ -6,6 +6,30 @@ const (
 	StringTType TabularType = iota
 	Int32TType
 	Float64TType
+	Int64TType
+	BoolTType
+	TimestampTType
+	BytesTType
+	DecimalTType
+	JSONTType
+	StringArrayTType
+	Int32ArrayTType
+	Int64ArrayTType
+	EnumTType
 )
 
+/* ElementType returns the type of the elements of an array type */
+func ElementType(typ TabularType) (TabularType, bool) {
+	switch typ {
+	case StringArrayTType:
+		return StringTType, true
+	case Int32ArrayTType:
+		return Int32TType, true
+	case Int64ArrayTType:
+		return Int64TType, true
+	default:
+		return 0, false
+	}
+}
+
 type Blob []byte
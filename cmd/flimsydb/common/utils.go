@@ -1,82 +1,24 @@
 package common
 
-import (
-	"bytes"
-	"encoding/binary"
-	"math"
-)
+import "bytes"
 
 type CompareFunc func(a, b []byte) int
 
+func IsNull(b []byte) bool {
+	return len(b) == 0
+}
+
+/* every type is stored in an order-preserving encoding, see encoding.go */
 func GetCompareFunc(typ TabularType) CompareFunc {
 	switch typ {
-	case Int32TType:
-		return compareInt32
-	// case fdb.Int64TType:
-	// 	return compareInt64
-	case Float64TType:
-		return compareFloat64
-	case StringTType:
-		return compareString
-	// case fdb.BoolTType:
-	// 	return compareBool
+	case Int32TType, Float64TType, StringTType, Int64TType, BoolTType, TimestampTType, BytesTType, DecimalTType, JSONTType,
+		StringArrayTType, Int32ArrayTType, Int64ArrayTType, EnumTType:
+		return bytes.Compare
 	default:
 		return nil
 	}
 }
 
-func compareInt32(a, b []byte) int {
-	valA := int32(binary.BigEndian.Uint32(a))
-	valB := int32(binary.BigEndian.Uint32(b))
-	if valA < valB {
-		return -1
-	}
-	if valA > valB {
-		return 1
-	}
-	return 0
-}
-
-func compareInt64(a, b []byte) int {
-	valA := int64(binary.BigEndian.Uint64(a))
-	valB := int64(binary.BigEndian.Uint64(b))
-	if valA < valB {
-		return -1
-	}
-	if valA > valB {
-		return 1
-	}
-	return 0
-}
-
-func compareFloat64(a, b []byte) int {
-	valA := math.Float64frombits(binary.BigEndian.Uint64(a))
-	valB := math.Float64frombits(binary.BigEndian.Uint64(b))
-	if valA < valB {
-		return -1
-	}
-	if valA > valB {
-		return 1
-	}
-	return 0
-}
-
-func compareString(a, b []byte) int {
-	return bytes.Compare(a, b)
-}
-
-func compareBool(a, b []byte) int {
-	valA := a[0] != 0
-	valB := b[0] != 0
-	if valA == valB {
-		return 0
-	}
-	if !valA && valB {
-		return -1
-	}
-	return 1
-}
-
 func Equal(a, b []byte, compareFunc CompareFunc) bool {
 	return compareFunc(a, b) == 0
 }
@@ -0,0 +1,247 @@
+package flimsydb
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+a composite index is declared on the table over an ordered list of columns,
+it keeps the encoded keys of all rows in a BTreeIndexer, so equality on
+a prefix of the columns and a range on the column after it are both
+a single range scan
+*/
+type compositeIndex struct {
+	name     string
+	columns  []int
+	path     jsonPath // set for an index over a path of a single JSON column
+	idxrType indexer.IndexerType
+	idxr     indexer.Indexer
+}
+
+func newIndexIdxr(idxrType indexer.IndexerType) indexer.Indexer {
+	if idxrType == indexer.HashMapIndexerType {
+		return indexer.NewIndexer(idxrType, cm.BytesTType)
+	}
+	return indexer.NewKeyIndexer()
+}
+
+func (t *Table) compositeKey(idx *compositeIndex, row Row) cm.Blob {
+	if idx.path != nil {
+		return idx.path.key(row[idx.columns[0]])
+	}
+
+	var key cm.Blob
+	for _, colIndex := range idx.columns {
+		key = appendKeyPart(key, row[colIndex])
+	}
+
+	return key
+}
+
+/* the caller must hold the write lock, the index is filled by the caller */
+func (t *Table) addIndex(w walIndex) (*compositeIndex, error) {
+	if _, exists := t.indexes[w.Name]; exists {
+		return nil, fmt.Errorf("index %q: %w", w.Name, cm.ErrIndexExists)
+	}
+	if len(w.Columns) == 0 {
+		return nil, fmt.Errorf("index %q has no columns: %w", w.Name, cm.ErrInvalidData)
+	}
+
+	columns := make([]int, len(w.Columns))
+	for i, colName := range w.Columns {
+		colIndex, exists := t.columnIndex[colName]
+		if !exists {
+			return nil, fmt.Errorf("column '%s': %w", colName, cm.ErrColumnNotFound)
+		}
+		if slices.Contains(columns[:i], colIndex) {
+			return nil, fmt.Errorf("column '%s' is listed twice: %w", colName, cm.ErrInvalidData)
+		}
+		columns[i] = colIndex
+	}
+
+	idx := &compositeIndex{name: w.Name, columns: columns, idxrType: indexer.BTreeIndexerType}
+	if w.Path != "" {
+		if len(columns) != 1 || t.scheme[columns[0]].Type != cm.JSONTType {
+			return nil, fmt.Errorf("path index %q needs a single JSON column: %w", w.Name, cm.ErrTypeMismatch)
+		}
+
+		path, err := parseJSONPath(w.Path)
+		if err != nil {
+			return nil, err
+		}
+		idx.path, idx.idxrType = path, w.IdxrType
+	}
+	idx.idxr = newIndexIdxr(idx.idxrType)
+
+	t.indexes[w.Name] = idx
+	return idx, nil
+}
+
+/* the caller must hold the read lock */
+func (t *Table) indexesToWAL() []walIndex {
+	names := make([]string, 0, len(t.indexes))
+	for name := range t.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indexes := make([]walIndex, len(names))
+	for i, name := range names {
+		idx := t.indexes[name]
+		indexes[i] = walIndex{Name: name, Columns: make([]string, len(idx.columns))}
+		if idx.path != nil {
+			indexes[i].Path, indexes[i].IdxrType = idx.path.String(), idx.idxrType
+		}
+		for j, colIndex := range idx.columns {
+			indexes[i].Columns[j] = t.scheme[colIndex].Name
+		}
+	}
+
+	return indexes
+}
+
+/* CreateIndex declares a composite index over the columns in the given order */
+func (t *Table) CreateIndex(name string, columns ...string) error {
+	return t.createIndex(walIndex{Name: name, Columns: columns})
+}
+
+func (t *Table) createIndex(w walIndex) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	idx, err := t.addIndex(w)
+	if err != nil {
+		return err
+	}
+
+	if err := t.logWrite(&walRecord{Op: walCreateIndex, Index: &w}); err != nil {
+		delete(t.indexes, w.Name)
+		return err
+	}
+
+	for slot, row := range t.rows {
+		if row != nil {
+			idx.idxr.Add(t.compositeKey(idx, row), t.rowIDs[slot])
+		}
+	}
+	t.indexVersion++
+
+	return nil
+}
+
+func (t *Table) DropIndex(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.indexes[name]; !exists {
+		return fmt.Errorf("index %q: %w", name, cm.ErrIndexNotFound)
+	}
+
+	if err := t.logWrite(&walRecord{Op: walDropIndex, Index: &walIndex{Name: name}}); err != nil {
+		return err
+	}
+
+	delete(t.indexes, name)
+	t.indexVersion++
+	return nil
+}
+
+/* the caller must hold the write lock */
+func (t *Table) indexComposites(id int, row Row) {
+	for _, idx := range t.indexes {
+		idx.idxr.Add(t.compositeKey(idx, row), id)
+	}
+}
+
+/* the keys were added together with the row, so removing them cannot fail */
+func (t *Table) unindexComposites(id int, row Row) {
+	for _, idx := range t.indexes {
+		idx.idxr.Delete(t.compositeKey(idx, row), id)
+	}
+}
+
+/* encodePrefix encodes the values of the leading columns of the index, a nil value matches NULL */
+func (t *Table) encodePrefix(idx *compositeIndex, values []any) (cm.Blob, error) {
+	var key cm.Blob
+	for i, val := range values {
+		col := t.scheme[idx.columns[i]]
+		_, blobValue, err := t.prepareLookup(col.Name, val)
+		if err != nil {
+			return nil, err
+		}
+		key = appendKeyPart(key, blobValue)
+	}
+
+	return key, nil
+}
+
+func (t *Table) compositeIndex(name string) (*compositeIndex, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	idx, exists := t.indexes[name]
+	if !exists || idx.path != nil {
+		return nil, fmt.Errorf("index %q: %w", name, cm.ErrIndexNotFound)
+	}
+	return idx, nil
+}
+
+func (t *Table) findByKeyRange(idx *compositeIndex, minKey cm.Blob, maxKey cm.Blob) ([][]any, error) {
+	t.mu.RLock()
+	rows := t.rowsByIDs(idx.idxr.FindInRange(minKey, maxKey))
+	t.mu.RUnlock()
+
+	return deserializeRows(t.scheme, rows)
+}
+
+/* FindByIndex returns the rows whose leading index columns equal values, in index order */
+func (t *Table) FindByIndex(name string, values ...any) ([][]any, error) {
+	idx, err := t.compositeIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 || len(values) > len(idx.columns) {
+		return nil, fmt.Errorf("index %q expects 1 to %d values, got %d: %w", name, len(idx.columns), len(values), cm.ErrInvalidData)
+	}
+
+	prefix, err := t.encodePrefix(idx, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.findByKeyRange(idx, prefix, append(slices.Clip(prefix), keyPrefixEnd))
+}
+
+/*
+FindInRangeByIndex returns the rows whose leading index columns equal prefix
+and whose next column lies between minVal and maxVal inclusively, in index order
+*/
+func (t *Table) FindInRangeByIndex(name string, prefix []any, minVal any, maxVal any) ([][]any, error) {
+	idx, err := t.compositeIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) >= len(idx.columns) {
+		return nil, fmt.Errorf("index %q expects at most %d prefix values, got %d: %w", name, len(idx.columns)-1, len(prefix), cm.ErrInvalidData)
+	}
+
+	rangeCol := t.scheme[idx.columns[len(prefix)]]
+	_, blobMinVal, blobMaxVal, err := t.prepareRangeLookup(rangeCol.Name, minVal, maxVal)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := t.encodePrefix(idx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	minKey := appendKeyPart(slices.Clone(key), blobMinVal)
+	maxKey := append(appendKeyPart(slices.Clone(key), blobMaxVal), keyPrefixEnd)
+	return t.findByKeyRange(idx, minKey, maxKey)
+}
@@ -0,0 +1,185 @@
+package flimsydb
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+a Cursor is an opaque continuation token of a Scan, it holds the key and
+the row id of the last row returned, so the next page resumes the walk of
+the B-tree right after it, rows inserted or deleted in the meantime never
+make the scan skip or repeat the other rows
+*/
+type Cursor string
+
+const cursorVersion byte = 1
+
+type ScanOptions struct {
+	Limit   int       // rows per page
+	Order   SortOrder // rows sharing a key come in row id order in both directions
+	Where   Predicate // optional filter
+	Columns []string  // columns of the returned rows, every column by default
+}
+
+type cursorPosition struct {
+	col   string
+	order SortOrder
+	key   cm.Blob
+	id    int
+}
+
+func (p cursorPosition) encode() Cursor {
+	b := []byte{cursorVersion, byte(p.order)}
+	b = binary.AppendUvarint(b, uint64(len(p.col)))
+	b = append(b, p.col...)
+	b = binary.AppendUvarint(b, uint64(len(p.key)))
+	b = append(b, p.key...)
+	b = binary.AppendVarint(b, int64(p.id))
+
+	return Cursor(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func decodeCursor(c Cursor) (cursorPosition, error) {
+	errInvalid := fmt.Errorf("malformed cursor: %w", cm.ErrInvalidData)
+
+	b, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil || len(b) < 2 || b[0] != cursorVersion {
+		return cursorPosition{}, errInvalid
+	}
+	p := cursorPosition{order: SortOrder(b[1])}
+	b = b[2:]
+
+	readBytes := func() ([]byte, bool) {
+		n, size := binary.Uvarint(b)
+		if size <= 0 || n > uint64(len(b)-size) {
+			return nil, false
+		}
+		field := b[size : size+int(n)]
+		b = b[size+int(n):]
+		return field, true
+	}
+
+	col, ok := readBytes()
+	if !ok {
+		return cursorPosition{}, errInvalid
+	}
+	key, ok := readBytes()
+	if !ok {
+		return cursorPosition{}, errInvalid
+	}
+	id, size := binary.Varint(b)
+	if size <= 0 || size != len(b) {
+		return cursorPosition{}, errInvalid
+	}
+
+	/* a non-nil key, even for NULL, because Descend starts at the largest value for nil */
+	p.col, p.key, p.id = string(col), append(cm.Blob{}, key...), int(id)
+	return p, nil
+}
+
+/*
+Scan returns a page of rows in the order of the B-tree indexer of col
+and the cursor of the next page, an empty from starts at the first row
+and an empty returned cursor means that there are no more rows
+*/
+func (t *Table) Scan(col string, from Cursor, opts ScanOptions) ([][]any, Cursor, error) {
+	if opts.Limit <= 0 {
+		return nil, "", fmt.Errorf("scan limit must be positive, got %d: %w", opts.Limit, cm.ErrInvalidData)
+	}
+
+	colIndex, exists := t.columnIndex[col]
+	if !exists {
+		return nil, "", fmt.Errorf("column '%s': %w", col, cm.ErrColumnNotFound)
+	}
+	ordered, ok := t.scheme[colIndex].Idxr.(indexer.OrderedIndexer)
+	if !ok || t.scheme[colIndex].IdxrType != indexer.BTreeIndexerType {
+		return nil, "", fmt.Errorf("column '%s' has no B-tree indexer: %w", col, cm.ErrIndexNotFound)
+	}
+
+	projection, err := t.bindProjection(opts.Columns)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var after *cursorPosition
+	if from != "" {
+		p, err := decodeCursor(from)
+		if err != nil {
+			return nil, "", err
+		}
+		if p.col != col || p.order != opts.Order {
+			return nil, "", fmt.Errorf("cursor belongs to another scan: %w", cm.ErrInvalidData)
+		}
+		after = &p
+	}
+
+	var pred boundPred
+	if opts.Where != nil {
+		if pred, err = opts.Where.bind(t); err != nil {
+			return nil, "", err
+		}
+	}
+
+	t.mu.RLock()
+	rows, keys, ids := t.scanPage(ordered, colIndex, opts.Order == Desc, after, pred, opts.Limit+1)
+	t.mu.RUnlock()
+
+	/* the extra row only tells whether there is a next page */
+	var next Cursor
+	if len(rows) > opts.Limit {
+		last := opts.Limit - 1
+		next = cursorPosition{col, opts.Order, keys[last], ids[last]}.encode()
+		rows = rows[:opts.Limit]
+	}
+
+	result, err := deserializeProjection(t.scheme, rows, projection)
+	return result, next, err
+}
+
+/* scanPage walks the indexer from the cursor and collects up to limit rows, the caller must hold the read lock */
+func (t *Table) scanPage(ordered indexer.OrderedIndexer, colIndex int, desc bool, after *cursorPosition, pred boundPred, limit int) ([]Row, []cm.Blob, []int) {
+	var rows []Row
+	var keys []cm.Blob
+	var ids []int
+
+	visit := func(val cm.Blob, ptrs []int) bool {
+		group := slices.Sorted(slices.Values(ptrs))
+		resume := after != nil && string(val) == string(after.key)
+		for _, id := range group {
+			if resume && id <= after.id {
+				continue
+			}
+
+			row, exists := t.rowByID(id)
+			if !exists || pred != nil && !pred.match(row) {
+				continue
+			}
+			rows = append(rows, row)
+			keys = append(keys, row[colIndex])
+			ids = append(ids, id)
+			if len(rows) == limit {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	var start cm.Blob
+	if after != nil {
+		start = after.key
+	}
+	if desc {
+		ordered.Descend(start, visit)
+	} else {
+		ordered.Ascend(start, visit)
+	}
+
+	return rows, keys, ids
+}
@@ -0,0 +1,409 @@
+package flimsydb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+explaining a query plans it like running it would and describes the
+plan step by step, there are no statistics, so the row estimates come
+from the live row count and a fixed selectivity for each kind of index
+lookup, a filter is expected to keep half of its rows, analyzing runs
+the plan one step at a time to count and time every step
+*/
+
+/* PlanStep is one step of a plan, every step works on the rows left by the previous one */
+type PlanStep struct {
+	Operation     string // index lookup, full scan, index walk, filter, sort or limit
+	Detail        string
+	EstimatedRows int
+	ActualRows    int           // set when analyzed
+	Duration      time.Duration // set when analyzed
+}
+
+/* Explanation describes how a query finds its rows */
+type Explanation struct {
+	AccessPath        string
+	EstimatedRows     int
+	IndexesConsidered []string
+	Filters           []string
+	Steps             []PlanStep
+
+	Analyzed   bool
+	ActualRows int
+	Duration   time.Duration
+}
+
+func (e *Explanation) String() string {
+	return strings.Join(e.lines(), "\n")
+}
+
+func (e *Explanation) lines() []string {
+	considered := "none"
+	if len(e.IndexesConsidered) != 0 {
+		considered = strings.Join(e.IndexesConsidered, ", ")
+	}
+	filters := "none"
+	if len(e.Filters) != 0 {
+		filters = strings.Join(e.Filters, ", ")
+	}
+
+	lines := []string{
+		fmt.Sprintf("access path: %s (estimated %d rows)", e.AccessPath, e.EstimatedRows),
+		"indexes considered: " + considered,
+		"filters: " + filters,
+	}
+	for i, step := range e.Steps {
+		line := fmt.Sprintf("%d. %s", i+1, step.Operation)
+		if step.Detail != "" {
+			line += ": " + step.Detail
+		}
+		line += fmt.Sprintf(" (estimated %d rows", step.EstimatedRows)
+		if e.Analyzed {
+			line += fmt.Sprintf(", actual %d rows in %v", step.ActualRows, step.Duration)
+		}
+		lines = append(lines, line+")")
+	}
+	if e.Analyzed {
+		lines = append(lines, fmt.Sprintf("total: %d rows in %v", e.ActualRows, e.Duration))
+	}
+
+	return lines
+}
+
+/*
+Explain describes how the query would find its rows without running it,
+a query with a single Eq or Between shows whether Find and FindInRange
+use an index or scan the table
+*/
+func (q *Query) Explain() (*Explanation, error) {
+	return q.explain(false)
+}
+
+/* ExplainAnalyze runs the query step by step and adds the actual row counts and timings to its explanation */
+func (q *Query) ExplainAnalyze() (*Explanation, error) {
+	return q.explain(true)
+}
+
+func (q *Query) explain(analyze bool) (*Explanation, error) {
+	if _, err := q.table.bindProjection(q.columns); err != nil {
+		return nil, err
+	}
+	pred, keys, err := q.bind()
+	if err != nil {
+		return nil, err
+	}
+
+	t := q.table
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.explain(t.planQuery(pred, keys, q.limit >= 0), q.offset, q.limit, analyze), nil
+}
+
+/* estimate guesses how many of the live rows the access path finds */
+func (a *accessPath) estimate(total int) int {
+	switch {
+	case a.lookup != nil:
+		return rankEstimate(a.rank, total)
+	case a.union:
+		sum := 0
+		for _, child := range a.children {
+			sum += child.estimate(total)
+		}
+		return min(sum, total)
+	default:
+		least := total
+		for _, child := range a.children {
+			least = min(least, child.estimate(total))
+		}
+		return least
+	}
+}
+
+func rankEstimate(rank accessRank, total int) int {
+	switch rank {
+	case rankUnique:
+		return min(total, 1)
+	case rankComposite:
+		return (total + 99) / 100
+	case rankEq, rankPrefix:
+		return (total + 9) / 10
+	case rankIn:
+		return (total + 4) / 5
+	default:
+		return (total + 2) / 3
+	}
+}
+
+/* filtered is the number of rows a filter is expected to keep */
+func filtered(n int) int {
+	return (n + 1) / 2
+}
+
+func (a *accessPath) String() string {
+	if a.lookup != nil {
+		return a.desc
+	}
+
+	children := make([]string, len(a.children))
+	for i, child := range a.children {
+		children[i] = child.String()
+	}
+	return fmt.Sprintf("%s of (%s)", a.desc, strings.Join(children, ", "))
+}
+
+/* consideredIndexes lists the indexes the planner could use for the predicate and the sort keys */
+func (t *Table) consideredIndexes(pred boundPred, keys []boundSortKey) []string {
+	var result []string
+	add := func(desc string) {
+		if !slices.Contains(result, desc) {
+			result = append(result, desc)
+		}
+	}
+
+	var visit func(p boundPred)
+	visit = func(p boundPred) {
+		switch p := p.(type) {
+		case nil:
+		case boundAnd:
+			conjuncts := flattenAnd(p.preds)
+			for _, access := range t.compositeAccess(conjuncts) {
+				add(access.path.desc)
+			}
+			for _, conjunct := range conjuncts {
+				visit(conjunct)
+			}
+		case boundOr:
+			for _, child := range p.preds {
+				visit(child)
+			}
+		default:
+			if path, _ := t.leafAccess(p); path != nil {
+				add(path.desc)
+				return
+			}
+			for _, access := range t.compositeAccess([]boundPred{p}) {
+				add(access.path.desc)
+			}
+		}
+	}
+	visit(pred)
+
+	if len(keys) != 0 {
+		if col := t.scheme[keys[0].colIndex]; col.IdxrType == indexer.BTreeIndexerType {
+			add("B-tree index on " + col.Name)
+		}
+	}
+
+	return result
+}
+
+func (t *Table) describeValue(colIndex int, value cm.Blob) string {
+	val, err := t.scheme[colIndex].deserialize(value)
+	if err != nil {
+		return fmt.Sprintf("%x", value)
+	}
+	return formatLiteral(val)
+}
+
+/* describePred formats a bound predicate like the predicate it was bound from */
+func (t *Table) describePred(p boundPred) string {
+	switch p := p.(type) {
+	case boundEq:
+		return fmt.Sprintf("%s = %s", t.scheme[p.colIndex].Name, t.describeValue(p.colIndex, p.value))
+	case boundNe:
+		return fmt.Sprintf("%s != %s", t.scheme[p.colIndex].Name, t.describeValue(p.colIndex, p.value))
+	case boundRange:
+		name := t.scheme[p.colIndex].Name
+		if p.min != nil && p.max != nil && p.minInclusive && p.maxInclusive {
+			return fmt.Sprintf("%s BETWEEN %s AND %s", name, t.describeValue(p.colIndex, p.min), t.describeValue(p.colIndex, p.max))
+		}
+		var parts []string
+		if p.min != nil {
+			op := compareOpNames[opGt]
+			if p.minInclusive {
+				op = compareOpNames[opGe]
+			}
+			parts = append(parts, fmt.Sprintf("%s %s %s", name, op, t.describeValue(p.colIndex, p.min)))
+		}
+		if p.max != nil {
+			op := compareOpNames[opLt]
+			if p.maxInclusive {
+				op = compareOpNames[opLe]
+			}
+			parts = append(parts, fmt.Sprintf("%s %s %s", name, op, t.describeValue(p.colIndex, p.max)))
+		}
+		return strings.Join(parts, " AND ")
+	case boundIn:
+		vals := make([]string, len(p.values))
+		for i, value := range p.values {
+			vals[i] = t.describeValue(p.colIndex, value)
+		}
+		return fmt.Sprintf("%s IN (%s)", t.scheme[p.colIndex].Name, strings.Join(vals, ", "))
+	case boundLike:
+		return fmt.Sprintf("%s LIKE %q", p.col.Name, p.pattern)
+	case boundIsNull:
+		return t.scheme[p.colIndex].Name + " IS NULL"
+	case boundAnd:
+		return t.describePreds(p.preds, " AND ", "TRUE")
+	case boundOr:
+		return t.describePreds(p.preds, " OR ", "FALSE")
+	case boundNot:
+		return "NOT (" + t.describePred(p.pred) + ")"
+	default:
+		return fmt.Sprintf("%v", p)
+	}
+}
+
+func (t *Table) describePreds(preds []boundPred, sep string, empty string) string {
+	if len(preds) == 0 {
+		return empty
+	}
+
+	parts := make([]string, len(preds))
+	for i, pred := range preds {
+		parts[i] = t.describePred(pred)
+		switch pred.(type) {
+		case boundAnd, boundOr:
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+/* describeFilters lists the conjuncts of a predicate, every one of them is a filter */
+func (t *Table) describeFilters(p boundPred) []string {
+	conjuncts := []boundPred{p}
+	if and, ok := p.(boundAnd); ok && len(and.preds) != 0 {
+		conjuncts = flattenAnd(and.preds)
+	}
+
+	filters := make([]string, len(conjuncts))
+	for i, conjunct := range conjuncts {
+		filters[i] = t.describePred(conjunct)
+	}
+	return filters
+}
+
+func (t *Table) describeKeys(keys []boundSortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = t.scheme[key.colIndex].Name + " ASC"
+		if key.desc {
+			parts[i] = t.scheme[key.colIndex].Name + " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+/*
+explain describes the plan and, when analyzing, runs it step by step, the
+caller must hold the read lock
+*/
+func (t *Table) explain(plan *queryPlan, offset int, limit int, analyze bool) *Explanation {
+	e := &Explanation{IndexesConsidered: t.consideredIndexes(plan.pred, plan.keys), Analyzed: analyze}
+	start := time.Now()
+
+	var rows []Row
+	var ids []int
+	estimate := len(t.slots)
+	step := func(operation string, detail string, run func()) {
+		s := PlanStep{Operation: operation, Detail: detail, EstimatedRows: estimate}
+		if analyze {
+			begin := time.Now()
+			run()
+			s.Duration = time.Since(begin)
+			s.ActualRows = len(rows)
+		}
+		e.Steps = append(e.Steps, s)
+	}
+
+	if plan.ordered != nil {
+		/* the walk filters the rows itself and stops once the page is full */
+		first := plan.keys[0]
+		direction := "ascending"
+		if first.desc {
+			direction = "descending"
+		}
+		e.AccessPath = fmt.Sprintf("B-tree index on %s walked in %s order", t.scheme[first.colIndex].Name, direction)
+		if plan.pred != nil {
+			e.Filters = t.describeFilters(plan.pred)
+			estimate = filtered(estimate)
+		}
+		walked := limit
+		if limit >= 0 {
+			walked = offset + limit
+			estimate = min(estimate, walked)
+		}
+		step("index walk", e.AccessPath, func() {
+			rows = t.indexOrderedRows(plan.ordered, plan.pred, plan.keys, 0, walked)
+		})
+	} else {
+		if plan.path == nil {
+			e.AccessPath = "full scan"
+			step("full scan", "table "+t.name, func() {
+				for slot, row := range t.rows {
+					if row != nil {
+						rows = append(rows, row)
+						ids = append(ids, t.rowIDs[slot])
+					}
+				}
+			})
+		} else {
+			e.AccessPath = plan.path.String()
+			estimate = plan.path.estimate(estimate)
+			step("index lookup", e.AccessPath, func() {
+				for _, id := range plan.path.ids() {
+					if row, exists := t.rowByID(id); exists {
+						rows = append(rows, row)
+						ids = append(ids, id)
+					}
+				}
+			})
+		}
+
+		if plan.residual != nil {
+			e.Filters = t.describeFilters(plan.residual)
+			estimate = filtered(estimate)
+			step("filter", t.describePred(plan.residual), func() {
+				var kept []Row
+				var keptIDs []int
+				for i, row := range rows {
+					if plan.residual.match(row) {
+						kept = append(kept, row)
+						keptIDs = append(keptIDs, ids[i])
+					}
+				}
+				rows, ids = kept, keptIDs
+			})
+		}
+
+		if len(plan.keys) != 0 {
+			step("sort", t.describeKeys(plan.keys), func() { sortRows(rows, ids, plan.keys) })
+		}
+	}
+
+	if offset > 0 || limit >= 0 {
+		estimate = max(estimate-offset, 0)
+		detail := fmt.Sprintf("offset %d", offset)
+		if limit >= 0 {
+			estimate = min(estimate, limit)
+			detail = fmt.Sprintf("limit %d %s", limit, detail)
+		}
+		step("limit", detail, func() { rows = page(rows, offset, limit) })
+	}
+
+	e.EstimatedRows = estimate
+	if analyze {
+		e.ActualRows = len(rows)
+		e.Duration = time.Since(start)
+	}
+	return e
+}
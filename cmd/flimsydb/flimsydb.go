@@ -2,31 +2,189 @@ package flimsydb
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
 )
 
+const walFileName = "wal.log"
+
 type FlimsyDB struct {
 	mu     sync.RWMutex
 	tables map[string]*Table
+	dir    string
+	wal    *WAL
+	clock  *versionClock
+	closed bool
+
+	/* catalogVersion changes with the set of tables, so prepared statements know their plans are stale */
+	catalogVersion atomic.Uint64
+	stmtMu         sync.Mutex
+	stmts          map[string]*Stmt
 }
 
 func NewFlimsyDB() *FlimsyDB {
 	return &FlimsyDB{
 		tables: make(map[string]*Table),
+		clock:  newVersionClock(),
+	}
+}
+
+/*
+Open loads the database stored in dir from its latest snapshot and
+write-ahead log, and keeps logging every change made through the returned instance
+*/
+func Open(dir string) (*FlimsyDB, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	wal, err := openWAL(filepath.Join(dir, walFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	db := NewFlimsyDB()
+	snapshotLSN, err := db.loadSnapshot(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		wal.Close()
+		return nil, fmt.Errorf("snapshot loading failed: %w", err)
+	}
+
+	/* records already covered by the snapshot survive if a checkpoint crashed before truncating the log */
+	err = wal.replay(func(rec *walRecord) error {
+		if rec.LSN <= snapshotLSN {
+			return nil
+		}
+		return db.applyRecord(rec)
+	})
+	if err != nil {
+		wal.Close()
+		return nil, fmt.Errorf("log replay failed: %w", err)
+	}
+	wal.lsn = max(wal.lsn, snapshotLSN)
+
+	for name, table := range db.tables {
+		if err := table.RestoreIndexing(); err != nil {
+			wal.Close()
+			return nil, fmt.Errorf("table %q: %w", name, err)
+		}
+	}
+
+	db.dir = dir
+	db.wal = wal
+	for _, table := range db.tables {
+		table.wal = wal
+	}
+
+	return db, nil
+}
+
+/* Close releases the log, afterwards every write fails with ErrClosed while reads keep working */
+func (db *FlimsyDB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+
+	for _, table := range db.tables {
+		table.mu.Lock()
+		table.wal = nil
+		table.closed = true
+		table.mu.Unlock()
+	}
+
+	if db.wal == nil {
+		return nil
+	}
+
+	err := db.wal.Close()
+	db.wal = nil
+	return err
+}
+
+/* records are applied without indexing, Open rebuilds the indexers afterwards */
+func (db *FlimsyDB) applyRecord(rec *walRecord) error {
+	if rec.Op == walCommitTx {
+		for i := range rec.Batch {
+			if err := db.applyRecord(&rec.Batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if rec.Op == walCreateTable {
+		if db.tableExists(rec.Table) {
+			return fmt.Errorf("%w: table %q created twice", cm.ErrLogCorrupted, rec.Table)
+		}
+		table := newTable(rec.Table, schemeFromWAL(rec.Scheme), nil, db.clock)
+		table.nextRowID = rec.NextID
+		table.db = db
+		for _, w := range rec.Indexes {
+			if _, err := table.addIndex(w); err != nil {
+				return fmt.Errorf("%w: table %q: %w", cm.ErrLogCorrupted, rec.Table, err)
+			}
+		}
+		db.tables[rec.Table] = table
+		return nil
+	}
+
+	table, exists := db.tables[rec.Table]
+	if !exists {
+		return fmt.Errorf("%w: table %q: %w", cm.ErrLogCorrupted, rec.Table, cm.ErrTableNotFound)
 	}
+
+	switch rec.Op {
+	case walDeleteTable:
+		delete(db.tables, rec.Table)
+		return nil
+	default:
+		return table.applyRecord(rec)
+	}
+}
+
+/* the caller must hold the database lock */
+func (db *FlimsyDB) logWrite(rec *walRecord) error {
+	if db.closed {
+		return cm.ErrClosed
+	}
+	if db.wal == nil {
+		return nil
+	}
+
+	return db.wal.append(rec)
 }
 
 func (db *FlimsyDB) CreateTable(name string, scheme Scheme) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	if db.closed {
+		return cm.ErrClosed
+	}
 	if db.tableExists(name) {
 		return cm.ErrTableExists
 	}
 
-	db.tables[name] = NewTable(scheme)
+	if err := db.validateReferences(name, scheme); err != nil {
+		return fmt.Errorf("foreign key validation failed: %w", err)
+	}
+
+	if err := db.logWrite(&walRecord{Op: walCreateTable, Table: name, Scheme: schemeToWAL(scheme)}); err != nil {
+		return fmt.Errorf("logging failed: %w", err)
+	}
+
+	table := newTable(name, scheme, db.wal, db.clock)
+	table.db = db
+	db.tables[name] = table
+	db.catalogVersion.Add(1)
 	return nil
 }
 
@@ -45,10 +203,32 @@ func (db *FlimsyDB) DeleteTable(name string) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	if !db.tableExists(name) {
+	if db.closed {
+		return cm.ErrClosed
+	}
+	table, exists := db.tables[name]
+	if !exists {
 		return cm.ErrTableNotFound
 	}
+
+	for _, edge := range db.referencedBy(table) {
+		if edge.child != table {
+			return fmt.Errorf("table %q: %w by table %q", name, cm.ErrTableReferenced, edge.child.name)
+		}
+	}
+
+	if err := db.logWrite(&walRecord{Op: walDeleteTable, Table: name}); err != nil {
+		return fmt.Errorf("logging failed: %w", err)
+	}
+
+	/* a dropped table is detached from the log, later writes to it are not persisted */
+	table.mu.Lock()
+	table.wal = nil
+	table.db = nil
+	table.mu.Unlock()
+
 	delete(db.tables, name)
+	db.catalogVersion.Add(1)
 	return nil
 }
 
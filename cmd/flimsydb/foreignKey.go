@@ -0,0 +1,197 @@
+package flimsydb
+
+import (
+	"fmt"
+	"slices"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/* fkEdge is a foreign key column of table child referring to column parentCol of its parent */
+type fkEdge struct {
+	child     *Table
+	childCol  int
+	parentCol int
+	onDelete  ReferenceAction
+}
+
+/* the caller must hold db.mu, a table may refer to itself */
+func (db *FlimsyDB) validateReferences(name string, scheme Scheme) error {
+	for _, col := range scheme {
+		if col.Ref == nil {
+			if col.Flags&ForeignKeyFlag != 0 {
+				return fmt.Errorf("column '%s' has no reference target: %w", col.Name, cm.ErrInvalidReference)
+			}
+			continue
+		}
+
+		parentScheme := scheme
+		if col.Ref.Table != name {
+			parent, exists := db.tables[col.Ref.Table]
+			if !exists {
+				return fmt.Errorf("column '%s' refers to table %q: %w", col.Name, col.Ref.Table, cm.ErrTableNotFound)
+			}
+			parentScheme = parent.scheme
+		}
+
+		parentIndex := slices.IndexFunc(parentScheme, func(c *Column) bool { return c.Name == col.Ref.Column })
+		if parentIndex < 0 {
+			return fmt.Errorf("column '%s' refers to column '%s': %w", col.Name, col.Ref.Column, cm.ErrColumnNotFound)
+		}
+
+		parentCol := parentScheme[parentIndex]
+		/* enum values are stored as positions, so both columns need the same labels */
+		if parentCol.Type != col.Type || !slices.Equal(parentCol.Labels, col.Labels) {
+			return fmt.Errorf("column '%s' and the referenced column '%s': %w", col.Name, parentCol.Name, cm.ErrTypeMismatch)
+		}
+		if !isUniqueColumn(parentScheme, parentIndex) {
+			return fmt.Errorf("referenced column '%s' is not unique: %w", parentCol.Name, cm.ErrInvalidReference)
+		}
+	}
+
+	return nil
+}
+
+/* referencedBy returns the foreign keys of other tables and of the table itself referring to it, the caller must hold db.mu */
+func (db *FlimsyDB) referencedBy(parent *Table) []fkEdge {
+	var edges []fkEdge
+	for _, child := range db.tables {
+		for i, col := range child.scheme {
+			if col.Ref == nil || col.Ref.Table != parent.name {
+				continue
+			}
+			edges = append(edges, fkEdge{
+				child:     child,
+				childCol:  i,
+				parentCol: parent.columnIndex[col.Ref.Column],
+				onDelete:  col.Ref.OnDelete,
+			})
+		}
+	}
+
+	return edges
+}
+
+/* the caller must hold db.mu */
+func (db *FlimsyDB) isLinked(table *Table) bool {
+	if db.tables[table.name] != table {
+		return false
+	}
+
+	for _, col := range table.scheme {
+		if col.Ref != nil {
+			return true
+		}
+	}
+	return len(db.referencedBy(table)) != 0
+}
+
+/*
+linkedTables extends the set with every table reachable through foreign keys,
+a write may have to check or change rows in any of them, the caller must hold db.mu
+*/
+func (db *FlimsyDB) linkedTables(tables map[string]*Table) {
+	queue := make([]*Table, 0, len(tables))
+	for _, table := range tables {
+		queue = append(queue, table)
+	}
+
+	visit := func(table *Table) {
+		if _, seen := tables[table.name]; !seen {
+			tables[table.name] = table
+			queue = append(queue, table)
+		}
+	}
+
+	for len(queue) != 0 {
+		table := queue[0]
+		queue = queue[1:]
+
+		for _, col := range table.scheme {
+			if col.Ref == nil {
+				continue
+			}
+			if parent, exists := db.tables[col.Ref.Table]; exists {
+				visit(parent)
+			}
+		}
+		for _, edge := range db.referencedBy(table) {
+			visit(edge.child)
+		}
+	}
+}
+
+/* checkParents makes sure the changed foreign keys of the row point at existing rows, NULL refers to nothing */
+func (a *txApplier) checkParents(table *Table, oldRow Row, newRow Row) error {
+	for i, col := range table.scheme {
+		if col.Ref == nil || cm.IsNull(newRow[i]) {
+			continue
+		}
+		if oldRow != nil && cm.Equal(oldRow[i], newRow[i], cm.GetCompareFunc(col.Type)) {
+			continue
+		}
+
+		parent := a.tables[col.Ref.Table]
+		if len(parent.lookup(parent.columnIndex[col.Ref.Column], newRow[i])) == 0 {
+			return fmt.Errorf("column '%s' refers to a missing row of table %q: %w", col.Name, parent.name, cm.ErrForeignKeyViolation)
+		}
+	}
+
+	return nil
+}
+
+/* a referenced key cannot change while rows still refer to it */
+func (a *txApplier) checkChildren(table *Table, oldRow Row, newRow Row) error {
+	for _, edge := range a.db.referencedBy(table) {
+		key := oldRow[edge.parentCol]
+		if cm.IsNull(key) || cm.Equal(key, newRow[edge.parentCol], cm.GetCompareFunc(table.scheme[edge.parentCol].Type)) {
+			continue
+		}
+
+		if len(edge.child.lookup(edge.childCol, key)) != 0 {
+			return fmt.Errorf("column '%s' is referenced by table %q: %w", table.scheme[edge.parentCol].Name, edge.child.name, cm.ErrForeignKeyViolation)
+		}
+	}
+
+	return nil
+}
+
+/* onDelete applies the reference actions to the rows referring to a deleted row */
+func (a *txApplier) onDelete(table *Table, oldRow Row) error {
+	for _, edge := range a.db.referencedBy(table) {
+		key := oldRow[edge.parentCol]
+		if cm.IsNull(key) {
+			continue
+		}
+
+		/* the indexer result is copied because the actions below modify the indexer */
+		ids := slices.Clone(edge.child.lookup(edge.childCol, key))
+		if len(ids) == 0 {
+			continue
+		}
+
+		if edge.onDelete == RestrictAction {
+			return fmt.Errorf("row is referenced by table %q: %w", edge.child.name, cm.ErrForeignKeyViolation)
+		}
+
+		childCol := edge.child.scheme[edge.childCol]
+		for _, id := range ids {
+			/* an earlier action may have removed the row already */
+			if !edge.child.rowExists(id) {
+				continue
+			}
+
+			var err error
+			if edge.onDelete == CascadeAction {
+				err = a.delete(edge.child, id)
+			} else {
+				err = a.update(edge.child, id, map[string]any{childCol.Name: nil})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
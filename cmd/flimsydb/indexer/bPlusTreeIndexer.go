@@ -44,6 +44,10 @@ type BTreeIndexer struct {
 }
 
 func NewBTreeIndexer(valueType cm.TabularType, degree int) *BTreeIndexer {
+	return newBTreeIndexer(cm.GetCompareFunc(valueType), degree)
+}
+
+func newBTreeIndexer(compareFunc cm.CompareFunc, degree int) *BTreeIndexer {
 	if degree < 3 {
 		panic("degree must be at least 3")
 	}
@@ -51,7 +55,7 @@ func NewBTreeIndexer(valueType cm.TabularType, degree int) *BTreeIndexer {
 	return &BTreeIndexer{
 		root:        nil,
 		degree:      degree,
-		compareFunc: cm.GetCompareFunc(valueType),
+		compareFunc: compareFunc,
 	}
 }
 
@@ -160,32 +164,48 @@ func (bt *BTreeIndexer) Delete(val cm.Blob, ptr int) error {
 	node.bunches[idx].ptrs = append(ptrs[:ptrIndex], ptrs[ptrIndex+1:]...)
 
 	if len(node.bunches[idx].ptrs) == 0 {
-		node.bunches = append(node.bunches[:idx], node.bunches[idx+1:]...)
-		bt.rebalanceAfterDeletion(node)
+		bt.removeBunch(node, idx)
 	}
 
 	return nil
 }
 
+/* an internal bunch is replaced by its in-order predecessor, so removal always happens in a leaf */
+func (bt *BTreeIndexer) removeBunch(node *Node, idx int) {
+	if !node.isLeaf {
+		leaf := node.children[idx]
+		for !leaf.isLeaf {
+			leaf = leaf.children[len(leaf.children)-1]
+		}
+
+		node.bunches[idx] = leaf.bunches[len(leaf.bunches)-1]
+		node = leaf
+		idx = len(leaf.bunches) - 1
+	}
+
+	node.bunches = append(node.bunches[:idx], node.bunches[idx+1:]...)
+	bt.rebalanceAfterDeletion(node)
+}
+
 func (bt *BTreeIndexer) rebalanceAfterDeletion(node *Node) {
-	if node == bt.root && len(node.bunches) == 0 {
-		if len(node.children) > 0 {
-			bt.root = node.children[0]
-			bt.root.parent = nil
-		} else {
-			bt.root = nil
+	if node == bt.root {
+		if len(node.bunches) == 0 {
+			if len(node.children) > 0 {
+				bt.root = node.children[0]
+				bt.root.parent = nil
+			} else {
+				bt.root = nil
+			}
 		}
 		return
 	}
 
-	if len(node.bunches) >= (bt.degree-1)/2 {
+	minBunches := (bt.degree - 1) / 2
+	if len(node.bunches) >= minBunches {
 		return
 	}
 
 	parent := node.parent
-	if parent == nil {
-		return
-	}
 
 	var nodeIdx int
 	for i, child := range parent.children {
@@ -197,39 +217,51 @@ func (bt *BTreeIndexer) rebalanceAfterDeletion(node *Node) {
 
 	if nodeIdx > 0 {
 		leftSibling := parent.children[nodeIdx-1]
-		if len(leftSibling.bunches) > (bt.degree-1)/2 {
+		if len(leftSibling.bunches) > minBunches {
 			node.bunches = append([]ValPtrsBunch{parent.bunches[nodeIdx-1]}, node.bunches...)
 			parent.bunches[nodeIdx-1] = leftSibling.bunches[len(leftSibling.bunches)-1]
 			leftSibling.bunches = leftSibling.bunches[:len(leftSibling.bunches)-1]
+			if !node.isLeaf {
+				moved := leftSibling.children[len(leftSibling.children)-1]
+				leftSibling.children = leftSibling.children[:len(leftSibling.children)-1]
+				node.children = append([]*Node{moved}, node.children...)
+				moved.parent = node
+			}
 			return
 		}
 	}
 
 	if nodeIdx < len(parent.children)-1 {
 		rightSibling := parent.children[nodeIdx+1]
-		if len(rightSibling.bunches) > (bt.degree-1)/2 {
+		if len(rightSibling.bunches) > minBunches {
 			node.bunches = append(node.bunches, parent.bunches[nodeIdx])
 			parent.bunches[nodeIdx] = rightSibling.bunches[0]
 			rightSibling.bunches = rightSibling.bunches[1:]
+			if !node.isLeaf {
+				moved := rightSibling.children[0]
+				rightSibling.children = rightSibling.children[1:]
+				node.children = append(node.children, moved)
+				moved.parent = node
+			}
 			return
 		}
 	}
 
+	left, right, sepIdx := node, (*Node)(nil), nodeIdx
 	if nodeIdx > 0 {
-		leftSibling := parent.children[nodeIdx-1]
-		leftSibling.bunches = append(leftSibling.bunches, parent.bunches[nodeIdx-1])
-		leftSibling.bunches = append(leftSibling.bunches, node.bunches...)
-		leftSibling.children = append(leftSibling.children, node.children...)
-		parent.bunches = append(parent.bunches[:nodeIdx-1], parent.bunches[nodeIdx:]...)
-		parent.children = append(parent.children[:nodeIdx], parent.children[nodeIdx+1:]...)
+		left, right, sepIdx = parent.children[nodeIdx-1], node, nodeIdx-1
 	} else {
-		rightSibling := parent.children[nodeIdx+1]
-		node.bunches = append(node.bunches, parent.bunches[nodeIdx])
-		node.bunches = append(node.bunches, rightSibling.bunches...)
-		node.children = append(node.children, rightSibling.children...)
-		parent.bunches = append(parent.bunches[:nodeIdx], parent.bunches[nodeIdx+1:]...)
-		parent.children = append(parent.children[:nodeIdx+1], parent.children[nodeIdx+2:]...)
+		right = parent.children[nodeIdx+1]
+	}
+
+	left.bunches = append(left.bunches, parent.bunches[sepIdx])
+	left.bunches = append(left.bunches, right.bunches...)
+	for _, child := range right.children {
+		child.parent = left
 	}
+	left.children = append(left.children, right.children...)
+	parent.bunches = append(parent.bunches[:sepIdx], parent.bunches[sepIdx+1:]...)
+	parent.children = append(parent.children[:sepIdx+1], parent.children[sepIdx+2:]...)
 
 	bt.rebalanceAfterDeletion(parent)
 }
@@ -317,21 +349,88 @@ func (bt *BTreeIndexer) collectInRangeFromNodeBinary(node *Node, min, max cm.Blo
 		return !cm.Less(node.bunches[i].val, min, bt.compareFunc)
 	})
 
-	for i := start; i < len(node.bunches); i++ {
-		if cm.Greater(node.bunches[i].val, max, bt.compareFunc) {
+	/* children are visited before their separators, so the pointers come out in key order */
+	for i := start; i <= len(node.bunches); i++ {
+		if !node.isLeaf {
+			bt.collectInRangeFromNodeBinary(node.children[i], min, max, result)
+		}
+		if i == len(node.bunches) || cm.Greater(node.bunches[i].val, max, bt.compareFunc) {
 			break
 		}
 
 		*result = append(*result, node.bunches[i].ptrs...)
+	}
+}
 
-		if !node.isLeaf {
-			bt.collectInRangeFromNodeBinary(node.children[i], min, max, result)
+/*
+Ascend visits the values from min upwards in key order until visit returns
+false, visit runs under the read lock of the indexer, so it must not
+modify the indexer or keep ptrs
+*/
+func (bt *BTreeIndexer) Ascend(min cm.Blob, visit func(val cm.Blob, ptrs []int) bool) {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+
+	bt.ascendFromNode(bt.root, min, visit)
+}
+
+func (bt *BTreeIndexer) ascendFromNode(node *Node, min cm.Blob, visit func(val cm.Blob, ptrs []int) bool) bool {
+	if node == nil {
+		return true
+	}
+
+	start := sort.Search(len(node.bunches), func(i int) bool {
+		return !cm.Less(node.bunches[i].val, min, bt.compareFunc)
+	})
+
+	for i := start; i <= len(node.bunches); i++ {
+		if !node.isLeaf && !bt.ascendFromNode(node.children[i], min, visit) {
+			return false
+		}
+		if i == len(node.bunches) {
+			break
+		}
+		if !visit(node.bunches[i].val, node.bunches[i].ptrs) {
+			return false
 		}
 	}
 
-	if !node.isLeaf {
-		bt.collectInRangeFromNodeBinary(node.children[len(node.bunches)], min, max, result)
+	return true
+}
+
+/* Descend visits the values from max downwards like Ascend, a nil max starts at the largest value */
+func (bt *BTreeIndexer) Descend(max cm.Blob, visit func(val cm.Blob, ptrs []int) bool) {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+
+	bt.descendFromNode(bt.root, max, visit)
+}
+
+func (bt *BTreeIndexer) descendFromNode(node *Node, max cm.Blob, visit func(val cm.Blob, ptrs []int) bool) bool {
+	if node == nil {
+		return true
+	}
+
+	end := len(node.bunches)
+	if max != nil {
+		end = sort.Search(len(node.bunches), func(i int) bool {
+			return cm.Greater(node.bunches[i].val, max, bt.compareFunc)
+		})
 	}
+
+	for i := end; i >= 0; i-- {
+		if !node.isLeaf && !bt.descendFromNode(node.children[i], max, visit) {
+			return false
+		}
+		if i == 0 {
+			break
+		}
+		if !visit(node.bunches[i-1].val, node.bunches[i-1].ptrs) {
+			return false
+		}
+	}
+
+	return true
 }
 
 func (bt *BTreeIndexer) PrintHorizontal() {
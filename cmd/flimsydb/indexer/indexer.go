@@ -1,6 +1,8 @@
 package indexer
 
 import (
+	"bytes"
+
 	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
 )
 
@@ -12,12 +14,20 @@ type Indexer interface {
 	FindInRange(min cm.Blob, max cm.Blob) []int
 }
 
+/* OrderedIndexer is implemented by indexers that can visit their values in key order */
+type OrderedIndexer interface {
+	Indexer
+	Ascend(min cm.Blob, visit func(val cm.Blob, ptrs []int) bool)
+	Descend(max cm.Blob, visit func(val cm.Blob, ptrs []int) bool)
+}
+
 type IndexerType int
 
 const (
 	AbsentIndexerType IndexerType = iota
 	HashMapIndexerType
 	BTreeIndexerType
+	InvertedIndexerType
 )
 
 func calculateDegree(pageSize int, keySize int, pointerSize int, overhead int) int {
@@ -33,7 +43,17 @@ func NewIndexer(indexerType IndexerType, valueType cm.TabularType) Indexer {
 		return NewHashMapIndexer(valueType)
 	case BTreeIndexerType:
 		return NewBTreeIndexer(valueType, calculateDegree(4096, 8, 8, 64))
+	case InvertedIndexerType:
+		if idxr := NewInvertedIndexer(valueType); idxr != nil {
+			return idxr
+		}
+		return nil
 	default:
 		return nil
 	}
 }
+
+/* NewKeyIndexer indexes keys that are already encoded to sort as plain bytes */
+func NewKeyIndexer() *BTreeIndexer {
+	return newBTreeIndexer(bytes.Compare, calculateDegree(4096, 8, 8, 64))
+}
@@ -0,0 +1,187 @@
+package indexer
+
+import (
+	"slices"
+	"sync"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/*
+InvertedIndexer indexes array values by their elements, every element
+maps to the pointers of the arrays holding it, so Find and FindInRange
+take an encoded element and not a whole array
+*/
+type InvertedIndexer struct {
+	mu       sync.RWMutex
+	store    map[string][]int
+	elemType cm.TabularType
+}
+
+func NewInvertedIndexer(valueType cm.TabularType) *InvertedIndexer {
+	elemType, ok := cm.ElementType(valueType)
+	if !ok {
+		return nil
+	}
+
+	return &InvertedIndexer{
+		store:    make(map[string][]int),
+		elemType: elemType,
+	}
+}
+
+/* elements returns the distinct elements of an array, NULL holds no elements */
+func (ii *InvertedIndexer) elements(val cm.Blob) ([]string, error) {
+	if cm.IsNull(val) {
+		return nil, nil
+	}
+
+	elems, err := cm.DecodeArray(ii.elemType, val)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		if key := bytesToKey(elem); !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+/* the caller must hold the write lock */
+func (ii *InvertedIndexer) add(keys []string, ptr int) {
+	for _, key := range keys {
+		ii.store[key] = append(ii.store[key], ptr)
+	}
+}
+
+/* the caller must hold the write lock */
+func (ii *InvertedIndexer) remove(keys []string, ptr int) error {
+	for _, key := range keys {
+		ptrs := ii.store[key]
+		i := slices.Index(ptrs, ptr)
+		if i < 0 {
+			return cm.ErrIndexNotFound
+		}
+
+		if len(ptrs) == 1 {
+			delete(ii.store, key)
+		} else {
+			ii.store[key] = slices.Delete(ptrs, i, i+1)
+		}
+	}
+
+	return nil
+}
+
+func (ii *InvertedIndexer) Add(val cm.Blob, ptr int) error {
+	keys, err := ii.elements(val)
+	if err != nil {
+		return err
+	}
+
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	for _, key := range keys {
+		if slices.Contains(ii.store[key], ptr) {
+			return cm.ErrIndexExists
+		}
+	}
+	ii.add(keys, ptr)
+
+	return nil
+}
+
+func (ii *InvertedIndexer) Delete(val cm.Blob, ptr int) error {
+	keys, err := ii.elements(val)
+	if err != nil {
+		return err
+	}
+
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	for _, key := range keys {
+		if !slices.Contains(ii.store[key], ptr) {
+			return cm.ErrIndexNotFound
+		}
+	}
+
+	return ii.remove(keys, ptr)
+}
+
+func (ii *InvertedIndexer) Update(oldVal cm.Blob, newVal cm.Blob, ptr int) error {
+	oldKeys, err := ii.elements(oldVal)
+	if err != nil {
+		return err
+	}
+	newKeys, err := ii.elements(newVal)
+	if err != nil {
+		return err
+	}
+
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	for _, key := range oldKeys {
+		if !slices.Contains(ii.store[key], ptr) {
+			return cm.ErrIndexNotFound
+		}
+	}
+
+	/* the elements kept by the update are not touched */
+	var removed, added []string
+	for _, key := range oldKeys {
+		if !slices.Contains(newKeys, key) {
+			removed = append(removed, key)
+		}
+	}
+	for _, key := range newKeys {
+		if !slices.Contains(oldKeys, key) {
+			added = append(added, key)
+		}
+	}
+
+	if err := ii.remove(removed, ptr); err != nil {
+		return err
+	}
+	ii.add(added, ptr)
+
+	return nil
+}
+
+/* Find returns the pointers of the arrays holding the element */
+func (ii *InvertedIndexer) Find(elem cm.Blob) []int {
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+
+	return slices.Clone(ii.store[bytesToKey(elem)])
+}
+
+/* FindInRange returns the pointers of the arrays holding at least one element between min and max */
+func (ii *InvertedIndexer) FindInRange(min cm.Blob, max cm.Blob) []int {
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+
+	compareFunc := cm.GetCompareFunc(ii.elemType)
+	seen := make(map[int]struct{})
+	result := []int{}
+	for key, ptrs := range ii.store {
+		keyBytes := []byte(key)
+		if !cm.GreaterOrEqual(keyBytes, min, compareFunc) || !cm.LessOrEqual(keyBytes, max, compareFunc) {
+			continue
+		}
+		for _, ptr := range ptrs {
+			if _, dup := seen[ptr]; !dup {
+				seen[ptr] = struct{}{}
+				result = append(result, ptr)
+			}
+		}
+	}
+
+	return result
+}
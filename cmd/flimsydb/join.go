@@ -0,0 +1,246 @@
+package flimsydb
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/*
+a join pairs every row of the left table with the rows of the right
+table holding an equal value in the joined column, NULL equals nothing,
+the right rows are looked up through the index of the right column when
+it has one and through a hash table built from the right table otherwise
+*/
+type JoinType int
+
+const (
+	InnerJoin JoinType = iota
+	/* LeftJoin keeps the left rows without a match, their right columns are NULL */
+	LeftJoin
+)
+
+/* JoinQuery combines the rows of two tables of a database, the methods configure it and return it for chaining */
+type JoinQuery struct {
+	db       *FlimsyDB
+	typ      JoinType
+	left     string
+	right    string
+	leftCol  string
+	rightCol string
+	columns  []string
+	where    Predicate
+}
+
+func (db *FlimsyDB) Join(left string, right string, typ JoinType) *JoinQuery {
+	return &JoinQuery{db: db, typ: typ, left: left, right: right}
+}
+
+/* On joins the rows whose leftCol value in the left table equals their rightCol value in the right table */
+func (j *JoinQuery) On(leftCol string, rightCol string) *JoinQuery {
+	j.leftCol, j.rightCol = leftCol, rightCol
+	return j
+}
+
+/* Select picks the columns of the result qualified like "table.column", by default every column of both tables is returned */
+func (j *JoinQuery) Select(cols ...string) *JoinQuery {
+	j.columns = append(j.columns, cols...)
+	return j
+}
+
+/* Where adds a condition on the columns of the left table, the conditions of several calls must all hold */
+func (j *JoinQuery) Where(pred Predicate) *JoinQuery {
+	if j.where == nil {
+		j.where = pred
+	} else {
+		j.where = And(j.where, pred)
+	}
+
+	return j
+}
+
+type joinStrategy int
+
+const (
+	indexNestedLoopJoin joinStrategy = iota
+	hashJoin
+)
+
+/* boundJoin is a join with its tables resolved and its columns checked */
+type boundJoin struct {
+	typ         JoinType
+	left, right *Table
+	leftCol     int
+	rightCol    int
+	strategy    joinStrategy
+	where       boundPred
+}
+
+/* qualifiedColumn is a column of the result, side 0 is the left table */
+type qualifiedColumn struct {
+	side     int
+	colIndex int
+	name     string
+}
+
+func (j *JoinQuery) bind() (*boundJoin, error) {
+	if j.left == j.right {
+		return nil, fmt.Errorf("table %q joined with itself: %w", j.left, cm.ErrInvalidData)
+	}
+	if j.leftCol == "" || j.rightCol == "" {
+		return nil, fmt.Errorf("join of %q and %q has no condition: %w", j.left, j.right, cm.ErrInvalidData)
+	}
+
+	left, err := j.db.GetTable(j.left)
+	if err != nil {
+		return nil, fmt.Errorf("table %q: %w", j.left, err)
+	}
+	right, err := j.db.GetTable(j.right)
+	if err != nil {
+		return nil, fmt.Errorf("table %q: %w", j.right, err)
+	}
+
+	leftCol, exists := left.columnIndex[j.leftCol]
+	if !exists {
+		return nil, fmt.Errorf("column '%s.%s': %w", j.left, j.leftCol, cm.ErrColumnNotFound)
+	}
+	rightCol, exists := right.columnIndex[j.rightCol]
+	if !exists {
+		return nil, fmt.Errorf("column '%s.%s': %w", j.right, j.rightCol, cm.ErrColumnNotFound)
+	}
+
+	/* the stored values are compared, so they need the same encoding on both sides */
+	lc, rc := left.scheme[leftCol], right.scheme[rightCol]
+	if lc.Type != rc.Type || !slices.Equal(lc.Labels, rc.Labels) || lc.Scale != rc.Scale {
+		return nil, fmt.Errorf("columns '%s.%s' and '%s.%s': %w", j.left, lc.Name, j.right, rc.Name, cm.ErrTypeMismatch)
+	}
+
+	bound := &boundJoin{typ: j.typ, left: left, right: right, leftCol: leftCol, rightCol: rightCol, strategy: hashJoin}
+	if idxr, _ := right.columnIndexer(rightCol); idxr != nil || right.isPrimaryKey(rightCol) {
+		bound.strategy = indexNestedLoopJoin
+	}
+
+	if j.where != nil {
+		if bound.where, err = j.where.bind(left); err != nil {
+			return nil, err
+		}
+	}
+
+	return bound, nil
+}
+
+func (j *JoinQuery) bindColumns(b *boundJoin) ([]qualifiedColumn, error) {
+	tables := [2]*Table{b.left, b.right}
+
+	if len(j.columns) == 0 {
+		var cols []qualifiedColumn
+		for side, t := range tables {
+			for colIndex, col := range t.scheme {
+				cols = append(cols, qualifiedColumn{side, colIndex, t.name + "." + col.Name})
+			}
+		}
+		return cols, nil
+	}
+
+	cols := make([]qualifiedColumn, len(j.columns))
+	for i, name := range j.columns {
+		tableName, colName, found := strings.Cut(name, ".")
+		side := slices.IndexFunc(tables[:], func(t *Table) bool { return t.name == tableName })
+		if !found || side < 0 {
+			return nil, fmt.Errorf("column '%s' is not qualified by a joined table: %w", name, cm.ErrInvalidData)
+		}
+		colIndex, exists := tables[side].columnIndex[colName]
+		if !exists {
+			return nil, fmt.Errorf("column '%s': %w", name, cm.ErrColumnNotFound)
+		}
+		cols[i] = qualifiedColumn{side, colIndex, name}
+	}
+
+	return cols, nil
+}
+
+/* joinedRow is a pair of rows, the right row is nil for an unmatched row of a left join */
+type joinedRow [2]Row
+
+/* execute joins the rows, both tables are read locked in name order like the tables of a transaction */
+func (b *boundJoin) execute() []joinedRow {
+	tables := []*Table{b.left, b.right}
+	sort.Slice(tables, func(i, k int) bool { return tables[i].name < tables[k].name })
+	for _, t := range tables {
+		t.mu.RLock()
+		defer t.mu.RUnlock()
+	}
+
+	outer, _ := b.left.selectRows(b.where)
+
+	var match func(value cm.Blob) []Row
+	if b.strategy == indexNestedLoopJoin {
+		match = func(value cm.Blob) []Row {
+			return b.right.rowsByIDs(b.right.lookup(b.rightCol, value))
+		}
+	} else {
+		built := make(map[string][]Row)
+		for _, row := range b.right.rows {
+			if row != nil && !cm.IsNull(row[b.rightCol]) {
+				built[string(row[b.rightCol])] = append(built[string(row[b.rightCol])], row)
+			}
+		}
+		match = func(value cm.Blob) []Row { return built[string(value)] }
+	}
+
+	var result []joinedRow
+	for _, row := range outer {
+		var inner []Row
+		if value := row[b.leftCol]; !cm.IsNull(value) {
+			inner = match(value)
+		}
+
+		for _, innerRow := range inner {
+			result = append(result, joinedRow{row, innerRow})
+		}
+		if len(inner) == 0 && b.typ == LeftJoin {
+			result = append(result, joinedRow{row, nil})
+		}
+	}
+
+	return result
+}
+
+/* Records runs the join and returns a record per joined pair of rows keyed by the qualified column names */
+func (j *JoinQuery) Records() ([]Record, error) {
+	bound, err := j.bind()
+	if err != nil {
+		return nil, err
+	}
+	cols, err := j.bindColumns(bound)
+	if err != nil {
+		return nil, err
+	}
+
+	schemes := [2]Scheme{bound.left.scheme, bound.right.scheme}
+	joined := bound.execute()
+
+	records := make([]Record, len(joined))
+	for i, pair := range joined {
+		record := make(Record, len(cols))
+		for _, col := range cols {
+			row := pair[col.side]
+			if row == nil {
+				record[col.name] = nil
+				continue
+			}
+
+			value, err := schemes[col.side][col.colIndex].deserialize(row[col.colIndex])
+			if err != nil {
+				return nil, fmt.Errorf("row deserialization error: %w", err)
+			}
+			record[col.name] = value
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
@@ -0,0 +1,256 @@
+package flimsydb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+a JSON column is matched on a path with the selector "column->$.a.b[0]",
+the value found at the path is turned into a typed key, so values of
+different JSON types never compare equal and every type keeps its order,
+a missing path and JSON null both give NULL
+*/
+const pathSeparator = "->"
+
+const (
+	jsonBoolTag byte = iota + 1
+	jsonNumberTag
+	jsonStringTag
+	jsonContainerTag
+)
+
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+type jsonPath []pathStep
+
+func parseJSONPath(s string) (jsonPath, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("JSON path %q must start with '$': %w", s, cm.ErrInvalidData)
+	}
+
+	path := jsonPath{}
+	rest := s[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("JSON path %q has an empty key: %w", s, cm.ErrInvalidData)
+			}
+			path = append(path, pathStep{key: key})
+			rest = rest[end+1:]
+
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSON path %q has an unclosed index: %w", s, cm.ErrInvalidData)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("JSON path %q has an invalid index: %w", s, cm.ErrInvalidData)
+			}
+			path = append(path, pathStep{index: index, isIndex: true})
+			rest = rest[end+1:]
+
+		default:
+			return nil, fmt.Errorf("JSON path %q is malformed: %w", s, cm.ErrInvalidData)
+		}
+	}
+
+	return path, nil
+}
+
+func (p jsonPath) String() string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, step := range p {
+		if step.isIndex {
+			fmt.Fprintf(&sb, "[%d]", step.index)
+		} else {
+			sb.WriteString("." + step.key)
+		}
+	}
+
+	return sb.String()
+}
+
+/* splitSelector separates "column->path", ok is false for plain column names */
+func splitSelector(selector string) (string, jsonPath, bool, error) {
+	colName, rawPath, found := strings.Cut(selector, pathSeparator)
+	if !found {
+		return selector, nil, false, nil
+	}
+
+	path, err := parseJSONPath(rawPath)
+	return colName, path, true, err
+}
+
+/* extract returns the value at the path in a stored document, nil when it is missing */
+func (p jsonPath) extract(doc cm.Blob) any {
+	if cm.IsNull(doc) {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(doc, &value); err != nil {
+		return nil
+	}
+
+	for _, step := range p {
+		switch v := value.(type) {
+		case map[string]any:
+			if step.isIndex {
+				return nil
+			}
+			value = v[step.key]
+		case []any:
+			if !step.isIndex || step.index >= len(v) {
+				return nil
+			}
+			value = v[step.index]
+		default:
+			return nil
+		}
+	}
+
+	return value
+}
+
+/* jsonKey turns a value found in a document or given to a lookup into a comparable key */
+func jsonKey(value any) (cm.Blob, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return append(cm.Blob{jsonBoolTag}, cm.EncodeBool(v)...), nil
+	case string:
+		return append(cm.Blob{jsonStringTag}, cm.EncodeString(v)...), nil
+	case float64:
+		return append(cm.Blob{jsonNumberTag}, cm.EncodeFloat64(v)...), nil
+	case int:
+		return jsonKey(float64(v))
+	case int32:
+		return jsonKey(float64(v))
+	case int64:
+		return jsonKey(float64(v))
+	case map[string]any, []any:
+		doc, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(cm.Blob{jsonContainerTag}, doc...), nil
+	default:
+		return nil, fmt.Errorf("cannot match %T against a JSON value: %w", value, cm.ErrTypeMismatch)
+	}
+}
+
+func (p jsonPath) key(doc cm.Blob) cm.Blob {
+	/* values decoded from stored JSON always have a key */
+	key, _ := jsonKey(p.extract(doc))
+	return key
+}
+
+/* serializeJSON validates and compacts documents given as text, other values are marshaled */
+func serializeJSON(value any) (cm.Blob, error) {
+	var text []byte
+	switch v := value.(type) {
+	case string:
+		text = []byte(v)
+	case []byte:
+		text = v
+	case json.RawMessage:
+		text = v
+	default:
+		doc, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("value cannot be encoded as JSON: %w", err)
+		}
+		return doc, nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, text); err != nil {
+		return nil, fmt.Errorf("invalid JSON document: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+/* the caller must hold the read lock */
+func (t *Table) pathIndex(colIndex int, path jsonPath) *compositeIndex {
+	for _, idx := range t.indexes {
+		if idx.path != nil && idx.columns[0] == colIndex && idx.path.String() == path.String() {
+			return idx
+		}
+	}
+
+	return nil
+}
+
+/* CreatePathIndex indexes the values found at path in a JSON column with a hash map or a B-tree indexer */
+func (t *Table) CreatePathIndex(name string, colName string, path string, idxrType indexer.IndexerType) error {
+	if idxrType != indexer.HashMapIndexerType && idxrType != indexer.BTreeIndexerType {
+		return fmt.Errorf("path index %q needs a hash map or a B-tree indexer: %w", name, cm.ErrInvalidData)
+	}
+
+	return t.createIndex(walIndex{Name: name, Columns: []string{colName}, Path: path, IdxrType: idxrType})
+}
+
+/* findPath returns the rows whose document holds a value between minVal and maxVal at the path */
+func (t *Table) findPath(colName string, path jsonPath, minVal any, maxVal any) ([][]any, error) {
+	colIndex, exists := t.columnIndex[colName]
+	if !exists {
+		return nil, fmt.Errorf("column with name %q does not exist", colName)
+	}
+	if t.scheme[colIndex].Type != cm.JSONTType {
+		return nil, fmt.Errorf("column '%s' is not a JSON column: %w", colName, cm.ErrTypeMismatch)
+	}
+
+	minKey, err := jsonKey(minVal)
+	if err != nil {
+		return nil, err
+	}
+	maxKey, err := jsonKey(maxVal)
+	if err != nil {
+		return nil, err
+	}
+	equality := bytes.Equal(minKey, maxKey)
+
+	t.mu.RLock()
+	var ids []int
+	if idx := t.pathIndex(colIndex, path); idx != nil && (equality || idx.idxrType == indexer.BTreeIndexerType) {
+		if equality {
+			ids = idx.idxr.Find(minKey)
+		} else {
+			ids = idx.idxr.FindInRange(minKey, maxKey)
+		}
+	} else {
+		for slot, row := range t.rows {
+			if row == nil {
+				continue
+			}
+			key := path.key(row[colIndex])
+			if bytes.Compare(key, minKey) >= 0 && bytes.Compare(key, maxKey) <= 0 {
+				ids = append(ids, t.rowIDs[slot])
+			}
+		}
+	}
+	rows := t.rowsByIDs(ids)
+	t.mu.RUnlock()
+
+	return deserializeRows(t.scheme, rows)
+}
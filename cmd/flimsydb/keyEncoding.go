@@ -0,0 +1,27 @@
+package flimsydb
+
+import (
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/*
+composite keys are the concatenation of their parts, every part starts
+with a marker telling NULL from a value followed by the stored value,
+which is order-preserving and self-delimiting, so keys compare column
+by column with plain bytes.Compare
+*/
+const (
+	keyNullMarker  byte = 0x00
+	keyValueMarker byte = 0x01
+
+	/* greater than every marker, appending it bounds all keys sharing a prefix */
+	keyPrefixEnd byte = 0xff
+)
+
+func appendKeyPart(dst []byte, value cm.Blob) []byte {
+	if cm.IsNull(value) {
+		return append(dst, keyNullMarker)
+	}
+
+	return append(append(dst, keyValueMarker), value...)
+}
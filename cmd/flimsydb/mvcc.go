@@ -0,0 +1,410 @@
+package flimsydb
+
+import (
+	"sync"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+every committed write gets a timestamp from the clock, a table keeps
+the latest version of a row in its slot and the versions it replaced
+in its history for as long as some snapshot taken before may read them
+*/
+type versionClock struct {
+	mu      sync.Mutex
+	now     uint64
+	active  map[uint64]int
+	tracked map[*Table]struct{}
+}
+
+func newVersionClock() *versionClock {
+	return &versionClock{
+		active:  make(map[uint64]int),
+		tracked: make(map[*Table]struct{}),
+	}
+}
+
+func (c *versionClock) tick() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now++
+	return c.now
+}
+
+func (c *versionClock) acquire() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active[c.now]++
+	return c.now
+}
+
+/* releasing the last snapshot of a timestamp collects the versions nobody needs anymore */
+func (c *versionClock) release(ts uint64) {
+	c.mu.Lock()
+	c.active[ts]--
+	if c.active[ts] > 0 {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.active, ts)
+
+	tables := make([]*Table, 0, len(c.tracked))
+	for t := range c.tracked {
+		tables = append(tables, t)
+	}
+	c.mu.Unlock()
+
+	for _, t := range tables {
+		t.mu.Lock()
+		t.collectGarbage()
+		t.mu.Unlock()
+	}
+}
+
+/* horizon is the oldest timestamp a snapshot can still read at */
+func (c *versionClock) horizon() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	oldest := c.now
+	for ts := range c.active {
+		oldest = min(oldest, ts)
+	}
+	return oldest
+}
+
+func (c *versionClock) track(t *Table, hasHistory bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hasHistory {
+		c.tracked[t] = struct{}{}
+	} else {
+		delete(c.tracked, t)
+	}
+}
+
+type rowVersion struct {
+	row Row
+	ts  uint64
+}
+
+/* versions are ordered by timestamp, the slot is kept for rows that are already deleted */
+type rowHistory struct {
+	slot     int
+	versions []rowVersion
+}
+
+/*
+recordVersion stamps the slot with the commit timestamp of a write,
+oldRow is the version it replaced and is nil for insertions,
+the caller must hold the write lock
+*/
+func (t *Table) recordVersion(id int, slot int, oldRow Row, ts uint64) {
+	if oldRow != nil {
+		h, exists := t.history[id]
+		if !exists {
+			h = &rowHistory{slot: slot}
+			t.history[id] = h
+			t.clock.track(t, true)
+		}
+		h.versions = append(h.versions, rowVersion{row: oldRow, ts: t.commitTS[slot]})
+	}
+
+	t.commitTS[slot] = ts
+}
+
+/* a version is dropped once the version replacing it is visible to every snapshot */
+func (t *Table) collectGarbage() {
+	if len(t.history) == 0 {
+		return
+	}
+
+	horizon := t.clock.horizon()
+	if horizon == t.collectedAt {
+		return
+	}
+	t.collectedAt = horizon
+
+	for id, h := range t.history {
+		keep := len(h.versions)
+		for i := range h.versions {
+			replacedAt := t.commitTS[h.slot]
+			if i+1 < len(h.versions) {
+				replacedAt = h.versions[i+1].ts
+			}
+			if replacedAt > horizon {
+				keep = i
+				break
+			}
+		}
+
+		if keep == len(h.versions) {
+			delete(t.history, id)
+			continue
+		}
+		h.versions = h.versions[keep:]
+	}
+
+	t.clock.track(t, len(t.history) != 0)
+}
+
+/* the caller must hold the read lock, a nil row means the row is not visible at ts */
+func (t *Table) visibleRow(id int, ts uint64) Row {
+	slot, exists := t.slots[id]
+	if !exists {
+		h, exists := t.history[id]
+		if !exists {
+			return nil
+		}
+		slot = h.slot
+	}
+
+	if t.commitTS[slot] <= ts {
+		return t.rows[slot]
+	}
+
+	h, exists := t.history[id]
+	if !exists {
+		return nil
+	}
+
+	for i := len(h.versions) - 1; i >= 0; i-- {
+		if h.versions[i].ts <= ts {
+			return h.versions[i].row
+		}
+	}
+	return nil
+}
+
+/*
+candidates returns the ids of rows that may match at ts, the index only
+knows the latest versions, so rows with history are always included,
+nil means that the whole table has to be scanned
+*/
+func (t *Table) candidates(colIndex int, find func(idxr indexer.Indexer) []int) []int {
+	col := t.scheme[colIndex]
+	/* an inverted indexer is looked up by element and cannot find whole arrays */
+	if col.IdxrType == indexer.AbsentIndexerType || col.IdxrType == indexer.InvertedIndexerType || find == nil {
+		return nil
+	}
+
+	ids := find(col.Idxr)
+	for id := range t.history {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+/* the caller must hold the read lock */
+func (t *Table) snapshotRows(ts uint64, ids []int, match func(row Row) bool) []Row {
+	var rows []Row
+	seen := make(map[int]struct{}, len(ids))
+	visit := func(id int) {
+		if _, dup := seen[id]; dup {
+			return
+		}
+		seen[id] = struct{}{}
+
+		row := t.visibleRow(id, ts)
+		if row != nil && (match == nil || match(row)) {
+			rows = append(rows, row)
+		}
+	}
+
+	if ids != nil {
+		for _, id := range ids {
+			visit(id)
+		}
+		return rows
+	}
+
+	for _, id := range t.rowIDs {
+		visit(id)
+	}
+	return rows
+}
+
+/* visibleRows returns the rows visible at ts by id and their ids in table order, the caller must hold the read lock */
+func (t *Table) visibleRows(ts uint64) ([]int, map[int]Row) {
+	var ids []int
+	rows := make(map[int]Row)
+	for _, id := range t.rowIDs {
+		if _, dup := rows[id]; dup {
+			continue
+		}
+		if row := t.visibleRow(id, ts); row != nil {
+			ids = append(ids, id)
+			rows[id] = row
+		}
+	}
+
+	return ids, rows
+}
+
+/*
+snapshotIDs returns the ids of the rows matching pred at ts, the access
+path only knows the latest versions, so the rows with history are
+checked too, the caller must hold the read lock
+*/
+func (t *Table) snapshotIDs(path *accessPath, pred boundPred, ts uint64) []int {
+	candidates := t.rowIDs
+	if path != nil {
+		candidates = path.ids()
+	}
+
+	var ids []int
+	seen := make(map[int]struct{}, len(candidates))
+	visit := func(id int) {
+		if _, dup := seen[id]; dup {
+			return
+		}
+		seen[id] = struct{}{}
+
+		row := t.visibleRow(id, ts)
+		if row != nil && (pred == nil || pred.match(row)) {
+			ids = append(ids, id)
+		}
+	}
+
+	for _, id := range candidates {
+		visit(id)
+	}
+	for id := range t.history {
+		visit(id)
+	}
+	return ids
+}
+
+/* changedSince tells whether a commit after ts changed or deleted the row, the caller must hold the read lock */
+func (t *Table) changedSince(id int, ts uint64) bool {
+	slot, exists := t.slots[id]
+	if !exists {
+		h, exists := t.history[id]
+		if !exists {
+			return false
+		}
+		slot = h.slot
+	}
+
+	return t.commitTS[slot] > ts
+}
+
+/*
+Snapshot reads every table as of the moment it was taken, writers are
+not blocked by it, Release must be called once it is no longer needed
+*/
+type Snapshot struct {
+	mu       sync.Mutex
+	db       *FlimsyDB
+	ts       uint64
+	released bool
+}
+
+func (db *FlimsyDB) Snapshot() *Snapshot {
+	return &Snapshot{db: db, ts: db.clock.acquire()}
+}
+
+func (s *Snapshot) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.released {
+		return
+	}
+	s.released = true
+	s.db.clock.release(s.ts)
+}
+
+func (s *Snapshot) table(name string) (*Table, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.released {
+		return nil, cm.ErrSnapshotReleased
+	}
+	return s.db.GetTable(name)
+}
+
+func (s *Snapshot) GetRow(tableName string, id int) (Row, error) {
+	t, err := s.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	row := t.visibleRow(id, s.ts)
+	if row == nil {
+		return nil, cm.ErrRowNotFound
+	}
+	return CopyRow(row), nil
+}
+
+func (s *Snapshot) GetAll(tableName string) ([][]any, error) {
+	t, err := s.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	rows := t.snapshotRows(s.ts, nil, nil)
+	t.mu.RUnlock()
+
+	return deserializeRows(t.scheme, rows)
+}
+
+func (s *Snapshot) Find(tableName string, colName string, val any) ([][]any, error) {
+	t, err := s.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	colIndex, blobValue, err := t.prepareLookup(colName, val)
+	if err != nil {
+		return nil, err
+	}
+	compFunc := cm.GetCompareFunc(t.scheme[colIndex].Type)
+
+	t.mu.RLock()
+	ids := t.candidates(colIndex, func(idxr indexer.Indexer) []int { return idxr.Find(blobValue) })
+	rows := t.snapshotRows(s.ts, ids, func(row Row) bool {
+		return cm.Equal(row[colIndex], blobValue, compFunc)
+	})
+	t.mu.RUnlock()
+
+	return deserializeRows(t.scheme, rows)
+}
+
+func (s *Snapshot) FindInRange(tableName string, colName string, minVal any, maxVal any) ([][]any, error) {
+	t, err := s.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	colIndex, blobMinVal, blobMaxVal, err := t.prepareRangeLookup(colName, minVal, maxVal)
+	if err != nil {
+		return nil, err
+	}
+	col := t.scheme[colIndex]
+	compFunc := cm.GetCompareFunc(col.Type)
+
+	var find func(idxr indexer.Indexer) []int
+	if col.IdxrType == indexer.BTreeIndexerType {
+		find = func(idxr indexer.Indexer) []int { return idxr.FindInRange(blobMinVal, blobMaxVal) }
+	}
+
+	t.mu.RLock()
+	ids := t.candidates(colIndex, find)
+	rows := t.snapshotRows(s.ts, ids, func(row Row) bool {
+		return cm.LessOrEqual(row[colIndex], blobMaxVal, compFunc) && cm.GreaterOrEqual(row[colIndex], blobMinVal, compFunc)
+	})
+	t.mu.RUnlock()
+
+	return deserializeRows(t.scheme, rows)
+}
@@ -0,0 +1,230 @@
+package flimsydb
+
+import (
+	"bytes"
+	"sort"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+rows are ordered by comparing their stored values, which sort like the
+values themselves, when the first sort column has a B-tree indexer the
+rows are read in index order instead of being sorted, so a query with
+a limit stops as soon as it has enough rows
+*/
+type boundSortKey struct {
+	colIndex int
+	desc     bool
+}
+
+func compareRows(keys []boundSortKey, a Row, b Row) int {
+	for _, key := range keys {
+		c := bytes.Compare(a[key.colIndex], b[key.colIndex])
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+/* sortRows sorts rows and their ids by the keys and then by id */
+func sortRows(rows []Row, ids []int, keys []boundSortKey) {
+	sort.Sort(rowSorter{rows, ids, keys})
+}
+
+type rowSorter struct {
+	rows []Row
+	ids  []int
+	keys []boundSortKey
+}
+
+func (s rowSorter) Len() int {
+	return len(s.rows)
+}
+
+func (s rowSorter) Less(i, j int) bool {
+	if c := compareRows(s.keys, s.rows[i], s.rows[j]); c != 0 {
+		return c < 0
+	}
+	return s.ids[i] < s.ids[j]
+}
+
+func (s rowSorter) Swap(i, j int) {
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+	s.ids[i], s.ids[j] = s.ids[j], s.ids[i]
+}
+
+/* page applies the offset and the limit, a negative limit keeps every row */
+func page[E any](rows []E, offset int, limit int) []E {
+	rows = rows[min(offset, len(rows)):]
+	if limit >= 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+
+	return rows
+}
+
+/*
+queryPlan tells how the rows of a query are found, either by walking the
+ordered indexer or through the access path, it stays valid as long as
+the indexes of the table do not change
+*/
+type queryPlan struct {
+	indexVersion uint64
+	pred         boundPred
+	keys         []boundSortKey
+	ordered      indexer.OrderedIndexer
+	path         *accessPath
+	residual     boundPred
+	shape        *planShape
+}
+
+/* planQuery plans a query with or without a limit, the caller must hold the read lock */
+func (t *Table) planQuery(pred boundPred, keys []boundSortKey, limited bool) *queryPlan {
+	plan := &queryPlan{indexVersion: t.indexVersion, pred: pred, keys: keys}
+	plan.path, plan.residual, plan.shape = t.planShaped(pred)
+	plan.ordered = t.orderingIndexer(plan.path, pred, keys, limited)
+	return plan
+}
+
+/*
+rebind returns the plan for pred, a predicate of the same form as the
+planned one with other values, or nil when the forms differ, the choice
+of the ordered indexer depends on the form only and is kept, the caller
+must hold the read lock
+*/
+func (plan *queryPlan) rebind(t *Table, pred boundPred) *queryPlan {
+	path, residual, ok := t.replan(pred, plan.shape)
+	if !ok {
+		return nil
+	}
+
+	return &queryPlan{
+		indexVersion: plan.indexVersion,
+		pred:         pred,
+		keys:         plan.keys,
+		ordered:      plan.ordered,
+		path:         path,
+		residual:     residual,
+		shape:        plan.shape,
+	}
+}
+
+/* the caller must hold the read lock */
+func (t *Table) runQuery(plan *queryPlan, offset int, limit int) []Row {
+	if plan.ordered != nil {
+		return t.indexOrderedRows(plan.ordered, plan.pred, plan.keys, offset, limit)
+	}
+
+	rows, ids := t.selectPlanned(plan.path, plan.residual)
+	if len(plan.keys) != 0 {
+		sortRows(rows, ids, plan.keys)
+	}
+	return page(rows, offset, limit)
+}
+
+/* the caller must hold the read lock */
+func (t *Table) execute(pred boundPred, keys []boundSortKey, offset int, limit int) []Row {
+	return t.runQuery(t.planQuery(pred, keys, limit >= 0), offset, limit)
+}
+
+/* sortColumnBounds returns the bounds the predicate puts on the column, nil when it does not restrict it */
+func sortColumnBounds(pred boundPred, colIndex int) *boundRange {
+	conjuncts := []boundPred{pred}
+	if p, ok := pred.(boundAnd); ok {
+		conjuncts = flattenAnd(p.preds)
+	}
+
+	for _, conjunct := range conjuncts {
+		switch p := conjunct.(type) {
+		case boundRange:
+			if p.colIndex == colIndex {
+				return &p
+			}
+		case boundEq:
+			if p.colIndex == colIndex {
+				return &boundRange{colIndex, p.value, p.value, true, true}
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+orderingIndexer returns the indexer providing the order of the result, it
+is used when the predicate cannot use an index anyway, restricts the sort
+column itself, or when only the first rows are needed
+*/
+func (t *Table) orderingIndexer(path *accessPath, pred boundPred, keys []boundSortKey, limited bool) indexer.OrderedIndexer {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	col := t.scheme[keys[0].colIndex]
+	ordered, ok := col.Idxr.(indexer.OrderedIndexer)
+	if !ok || col.IdxrType != indexer.BTreeIndexerType {
+		return nil
+	}
+
+	switch {
+	case path == nil, sortColumnBounds(pred, keys[0].colIndex) != nil:
+		return ordered
+	case limited && path.rank >= rankRange:
+		return ordered
+	default:
+		return nil
+	}
+}
+
+/* indexOrderedRows walks the indexer of the first sort column, rows sharing a value are sorted by the other keys */
+func (t *Table) indexOrderedRows(ordered indexer.OrderedIndexer, pred boundPred, keys []boundSortKey, offset int, limit int) []Row {
+	first := keys[0]
+	bounds := sortColumnBounds(pred, first.colIndex)
+
+	var rows []Row
+	visit := func(val cm.Blob, ptrs []int) bool {
+		if bounds != nil && !bounds.inRange(val) {
+			/* past the far end of the bounds nothing can match any more */
+			if first.desc {
+				return bounds.min == nil || bytes.Compare(val, bounds.min) > 0
+			}
+			return bounds.max == nil || bytes.Compare(val, bounds.max) < 0
+		}
+
+		var group []Row
+		var ids []int
+		for _, id := range ptrs {
+			if row, exists := t.rowByID(id); exists && (pred == nil || pred.match(row)) {
+				group = append(group, row)
+				ids = append(ids, id)
+			}
+		}
+		sortRows(group, ids, keys[1:])
+		rows = append(rows, group...)
+
+		return limit < 0 || len(rows) < offset+limit
+	}
+
+	if first.desc {
+		var from cm.Blob
+		if bounds != nil {
+			from = bounds.max
+		}
+		ordered.Descend(from, visit)
+	} else {
+		var from cm.Blob
+		if bounds != nil {
+			from = bounds.min
+		}
+		ordered.Ascend(from, visit)
+	}
+
+	return page(rows, offset, limit)
+}
@@ -0,0 +1,628 @@
+package flimsydb
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+the planner turns a bound predicate into an access path, which finds the
+candidate rows through the indexes, and a residual predicate, which the
+candidates are filtered with, predicates answered exactly by an index
+are left out of the residual, without any usable index the whole table
+is scanned with the full predicate
+*/
+
+/* lower ranks are expected to find fewer rows */
+type accessRank int
+
+const (
+	rankUnique accessRank = iota
+	rankComposite
+	rankEq
+	rankIn
+	rankRange
+	rankPrefix
+)
+
+/* accessPath finds candidate rows, either by a lookup or by intersecting or uniting its children */
+type accessPath struct {
+	desc     string
+	rank     accessRank
+	lookup   func() []int
+	children []*accessPath
+	union    bool
+}
+
+/* lowestValue sorts before every value but after NULL, which is the empty blob */
+var lowestValue = cm.Blob{0x00}
+
+/* ids returns the candidate row ids without duplicates, the caller must hold the read lock */
+func (a *accessPath) ids() []int {
+	if a.lookup != nil {
+		return dedupIDs(a.lookup())
+	}
+
+	if a.union {
+		var ids []int
+		for _, child := range a.children {
+			ids = append(ids, child.ids()...)
+		}
+		return dedupIDs(ids)
+	}
+
+	/* the first child is the most selective one and gives the order of the result */
+	ids := a.children[0].ids()
+	for _, child := range a.children[1:] {
+		if len(ids) == 0 {
+			break
+		}
+
+		other := make(map[int]struct{})
+		for _, id := range child.ids() {
+			other[id] = struct{}{}
+		}
+		ids = slices.DeleteFunc(ids, func(id int) bool {
+			_, found := other[id]
+			return !found
+		})
+	}
+	return ids
+}
+
+func dedupIDs(ids []int) []int {
+	seen := make(map[int]struct{}, len(ids))
+	return slices.DeleteFunc(ids, func(id int) bool {
+		if _, dup := seen[id]; dup {
+			return true
+		}
+		seen[id] = struct{}{}
+		return false
+	})
+}
+
+/* columnIndexer returns the hash map or B-tree indexer of a column, if any */
+func (t *Table) columnIndexer(colIndex int) (indexer.Indexer, string) {
+	col := t.scheme[colIndex]
+	switch col.IdxrType {
+	case indexer.HashMapIndexerType:
+		return col.Idxr, "hash index on " + col.Name
+	case indexer.BTreeIndexerType:
+		return col.Idxr, "B-tree index on " + col.Name
+	default:
+		return nil, ""
+	}
+}
+
+func (t *Table) isPrimaryKey(colIndex int) bool {
+	return len(t.pk) == 1 && t.pk[0] == colIndex
+}
+
+/* leafAccess finds an index answering a single predicate, exact tells whether it needs no further filtering */
+func (t *Table) leafAccess(p boundPred) (path *accessPath, exact bool) {
+	switch p := p.(type) {
+	case boundEq:
+		if t.isPrimaryKey(p.colIndex) {
+			return &accessPath{desc: "primary key", rank: rankUnique, lookup: func() []int {
+				return t.lookup(p.colIndex, p.value)
+			}}, true
+		}
+		idxr, desc := t.columnIndexer(p.colIndex)
+		if idxr == nil {
+			return nil, false
+		}
+		rank := rankEq
+		if t.scheme[p.colIndex].Flags&UniqueFlag != 0 {
+			rank = rankUnique
+		}
+		return &accessPath{desc: desc, rank: rank, lookup: func() []int { return idxr.Find(p.value) }}, true
+
+	case boundIn:
+		find, desc := func(value cm.Blob) []int { return t.lookup(p.colIndex, value) }, "primary key"
+		if !t.isPrimaryKey(p.colIndex) {
+			idxr, idxrDesc := t.columnIndexer(p.colIndex)
+			if idxr == nil {
+				return nil, false
+			}
+			find, desc = idxr.Find, idxrDesc
+		}
+		return &accessPath{desc: desc, rank: rankIn, lookup: func() []int {
+			var ids []int
+			for _, value := range p.values {
+				ids = append(ids, find(value)...)
+			}
+			return ids
+		}}, true
+
+	case boundIsNull:
+		idxr, desc := t.columnIndexer(p.colIndex)
+		if idxr == nil {
+			return nil, false
+		}
+		return &accessPath{desc: desc, rank: rankEq, lookup: func() []int { return idxr.Find(nil) }}, true
+
+	case boundRange:
+		idxr, desc := t.columnIndexer(p.colIndex)
+		ordered, ok := idxr.(indexer.OrderedIndexer)
+		if !ok {
+			return nil, false
+		}
+		from := p.min
+		if from == nil {
+			from = lowestValue
+		}
+		return &accessPath{desc: desc, rank: rankRange, lookup: func() []int {
+			var ids []int
+			ordered.Ascend(from, func(val cm.Blob, ptrs []int) bool {
+				if p.max != nil && bytes.Compare(val, p.max) > 0 {
+					return false
+				}
+				if p.inRange(val) {
+					ids = append(ids, ptrs...)
+				}
+				return true
+			})
+			return ids
+		}}, true
+
+	case boundLike:
+		idxr, desc := t.columnIndexer(p.colIndex)
+		ordered, ok := idxr.(indexer.OrderedIndexer)
+		if !ok || p.prefix == "" || p.col.Type != cm.StringTType {
+			return nil, false
+		}
+		/* the encoding of a string starts with the encoding of its prefix without the terminator */
+		encoded := cm.EncodeString(p.prefix)
+		encoded = encoded[:len(encoded)-2]
+		return &accessPath{desc: desc, rank: rankPrefix, lookup: func() []int {
+			var ids []int
+			ordered.Ascend(encoded, func(val cm.Blob, ptrs []int) bool {
+				if !bytes.HasPrefix(val, encoded) {
+					return false
+				}
+				ids = append(ids, ptrs...)
+				return true
+			})
+			return ids
+		}}, false
+
+	default:
+		return nil, false
+	}
+}
+
+func conjunctsOf(p boundPred) []boundPred {
+	if and, isAnd := p.(boundAnd); isAnd {
+		return flattenAnd(and.preds)
+	}
+	return []boundPred{p}
+}
+
+/* flattenAnd lists the conjuncts of nested Ands */
+func flattenAnd(preds []boundPred) []boundPred {
+	var result []boundPred
+	for _, pred := range preds {
+		if nested, ok := pred.(boundAnd); ok {
+			result = append(result, flattenAnd(nested.preds)...)
+		} else {
+			result = append(result, pred)
+		}
+	}
+
+	return result
+}
+
+/* conjunctAccess is an access path answering some of the conjuncts of an And */
+type conjunctAccess struct {
+	path    *accessPath
+	covered []int
+	exact   bool
+	index   string     // set for a composite index
+	ranged  bool       // set when the last conjunct covered by the composite index is a range
+	child   *planShape // set for an Or conjunct
+}
+
+type shapeKind int
+
+const (
+	shapeScan shapeKind = iota
+	shapeLeaf
+	shapeAnd
+	shapeOr
+)
+
+/*
+planShape is what the planner decided for a predicate with its values
+left out, a predicate of the same form with other values is planned
+from it without looking for indexes again
+*/
+type planShape struct {
+	kind      shapeKind
+	conjuncts int              // for an And
+	accesses  []conjunctAccess // for an And, the chosen accesses without their paths
+	children  []*planShape     // for an Or
+}
+
+/*
+compositeAccess uses composite indexes whose leading columns are compared
+for equality, optionally followed by a range on the next column, a single
+column is better served by its own index and only uses a composite index
+when it has none
+*/
+func (t *Table) compositeAccess(conjuncts []boundPred) []conjunctAccess {
+	eqs := make(map[int]int)
+	ranges := make(map[int]int)
+	for i, pred := range conjuncts {
+		switch p := pred.(type) {
+		case boundEq:
+			eqs[p.colIndex] = i
+		case boundRange:
+			if _, found := ranges[p.colIndex]; !found {
+				ranges[p.colIndex] = i
+			}
+		}
+	}
+
+	names := make([]string, 0, len(t.indexes))
+	for name, idx := range t.indexes {
+		if idx.path == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var result []conjunctAccess
+	for _, name := range names {
+		idx := t.indexes[name]
+
+		var covered []int
+		for _, colIndex := range idx.columns {
+			i, found := eqs[colIndex]
+			if !found {
+				break
+			}
+			covered = append(covered, i)
+		}
+		ranged := false
+		if len(covered) < len(idx.columns) {
+			if i, found := ranges[idx.columns[len(covered)]]; found {
+				covered = append(covered, i)
+				ranged = true
+			}
+		}
+
+		if len(covered) == 0 {
+			continue
+		}
+		if own, _ := t.leafAccess(conjuncts[covered[0]]); len(covered) == 1 && own != nil {
+			continue
+		}
+
+		path, exact, _ := t.compositePath(name, idx, conjuncts, covered, ranged)
+		result = append(result, conjunctAccess{path: path, covered: covered, exact: exact, index: name, ranged: ranged})
+	}
+
+	return result
+}
+
+/*
+compositePath finds the rows through a composite index by the values of
+the covered conjuncts, a range excluding its maximum also finds the keys
+equal to it, so the path is not exact then, ok is false when a conjunct
+is not of the kind the index covers it as
+*/
+func (t *Table) compositePath(name string, idx *compositeIndex, conjuncts []boundPred, covered []int, ranged bool) (path *accessPath, exact bool, ok bool) {
+	eqs := covered
+	if ranged {
+		eqs = covered[:len(covered)-1]
+	}
+
+	var key cm.Blob
+	for _, i := range eqs {
+		eq, isEq := conjuncts[i].(boundEq)
+		if !isEq {
+			return nil, false, false
+		}
+		key = appendKeyPart(key, eq.value)
+	}
+	minKey, maxKey := key, append(slices.Clone(key), keyPrefixEnd)
+
+	desc := fmt.Sprintf("composite index %s on %d columns", name, len(eqs))
+	rank := rankComposite
+	switch len(eqs) {
+	case 0:
+		desc, rank = "composite index "+name, rankRange
+	case 1:
+		desc, rank = fmt.Sprintf("composite index %s on 1 column", name), rankEq
+	}
+
+	exact = true
+	if ranged {
+		r, isRange := conjuncts[covered[len(covered)-1]].(boundRange)
+		if !isRange {
+			return nil, false, false
+		}
+		desc += " with a range on " + t.scheme[r.colIndex].Name
+
+		/* NULL never matches a range and sorts before every value */
+		minKey = append(slices.Clone(key), keyValueMarker)
+		if r.min != nil {
+			minKey = appendKeyPart(slices.Clone(key), r.min)
+			if !r.minInclusive {
+				/* values are self-delimiting, so this passes every key holding the minimum */
+				minKey = append(minKey, keyPrefixEnd)
+			}
+		}
+		if r.max != nil {
+			maxKey = append(appendKeyPart(slices.Clone(key), r.max), keyPrefixEnd)
+			exact = r.maxInclusive
+		}
+	}
+
+	idxr := idx.idxr
+	return &accessPath{
+		desc:   desc,
+		rank:   rank,
+		lookup: func() []int { return idxr.FindInRange(minKey, maxKey) },
+	}, exact, true
+}
+
+/* planAnd plans the conjuncts of p, a predicate which is not an And is its only conjunct */
+func (t *Table) planAnd(p boundPred) (*accessPath, boundPred, *planShape) {
+	conjuncts := conjunctsOf(p)
+
+	accesses := t.compositeAccess(conjuncts)
+	for i, pred := range conjuncts {
+		if _, isOr := pred.(boundOr); isOr {
+			if path, residual, shape := t.planShaped(pred); path != nil {
+				accesses = append(accesses, conjunctAccess{path: path, covered: []int{i}, exact: residual == nil, child: shape})
+			}
+			continue
+		}
+		if path, exact := t.leafAccess(pred); path != nil {
+			accesses = append(accesses, conjunctAccess{path: path, covered: []int{i}, exact: exact})
+		}
+	}
+	if len(accesses) == 0 {
+		return nil, p, &planShape{kind: shapeScan}
+	}
+	sort.SliceStable(accesses, func(i, j int) bool { return accesses[i].path.rank < accesses[j].path.rank })
+
+	/* a unique lookup finds at most one row, intersecting it with anything else only costs time */
+	if accesses[0].path.rank == rankUnique {
+		accesses = accesses[:1]
+	}
+
+	shape := &planShape{kind: shapeAnd, conjuncts: len(conjuncts)}
+	used := make(map[int]bool)
+	var chosen []conjunctAccess
+	for _, access := range accesses {
+		if slices.ContainsFunc(access.covered, func(i int) bool { return used[i] }) {
+			continue
+		}
+		chosen = append(chosen, access)
+		for _, i := range access.covered {
+			used[i] = true
+		}
+
+		access.path = nil
+		shape.accesses = append(shape.accesses, access)
+	}
+
+	path, residual := intersectAccesses(conjuncts, chosen)
+	return path, residual, shape
+}
+
+/* intersectAccesses intersects the chosen accesses, the conjuncts they do not answer exactly are the residual */
+func intersectAccesses(conjuncts []boundPred, chosen []conjunctAccess) (*accessPath, boundPred) {
+	answered := make(map[int]bool)
+	paths := make([]*accessPath, len(chosen))
+	for i, access := range chosen {
+		paths[i] = access.path
+		for _, j := range access.covered {
+			answered[j] = access.exact
+		}
+	}
+
+	var residual []boundPred
+	for i, pred := range conjuncts {
+		if !answered[i] {
+			residual = append(residual, pred)
+		}
+	}
+
+	path := paths[0]
+	if len(paths) > 1 {
+		path = &accessPath{desc: "intersection", rank: paths[0].rank, children: paths}
+	}
+	switch len(residual) {
+	case 0:
+		return path, nil
+	case 1:
+		return path, residual[0]
+	default:
+		return path, boundAnd{residual}
+	}
+}
+
+/*
+planAccess returns the access path of a predicate, or nil when the whole
+table has to be scanned, and the residual predicate, or nil when the
+access path is exact
+*/
+func (t *Table) planAccess(p boundPred) (*accessPath, boundPred) {
+	path, residual, _ := t.planShaped(p)
+	return path, residual
+}
+
+/* planShaped plans like planAccess and returns the shape of the plan too */
+func (t *Table) planShaped(p boundPred) (*accessPath, boundPred, *planShape) {
+	switch p := p.(type) {
+	case nil:
+		return nil, nil, &planShape{kind: shapeScan}
+
+	case boundAnd:
+		return t.planAnd(p)
+
+	case boundOr:
+		shape := &planShape{kind: shapeOr}
+		if len(p.preds) == 0 {
+			return nothingPath(), nil, shape
+		}
+
+		exact := true
+		children := make([]*accessPath, len(p.preds))
+		for i, pred := range p.preds {
+			path, residual, child := t.planShaped(pred)
+			if path == nil {
+				return nil, p, &planShape{kind: shapeScan}
+			}
+			children[i] = path
+			shape.children = append(shape.children, child)
+			exact = exact && residual == nil
+		}
+
+		path, residual := unionPath(p, children, exact)
+		return path, residual, shape
+
+	default:
+		path, exact := t.leafAccess(p)
+		if path == nil {
+			/* a column without an index of its own may lead a composite index */
+			return t.planAnd(p)
+		}
+		if exact {
+			return path, nil, &planShape{kind: shapeLeaf}
+		}
+		return path, p, &planShape{kind: shapeLeaf}
+	}
+}
+
+func nothingPath() *accessPath {
+	return &accessPath{desc: "nothing", rank: rankUnique, lookup: func() []int { return nil }}
+}
+
+func unionPath(p boundOr, children []*accessPath, exact bool) (*accessPath, boundPred) {
+	path := &accessPath{desc: "union", rank: rankIn, children: children, union: true}
+	if exact {
+		return path, nil
+	}
+	return path, p
+}
+
+/*
+replan plans a predicate from the shape of the plan of a predicate of the
+same form, ok is false when the forms differ, like when a value became
+NULL and turned an equality into IS NULL
+*/
+func (t *Table) replan(p boundPred, shape *planShape) (path *accessPath, residual boundPred, ok bool) {
+	switch shape.kind {
+	case shapeScan:
+		return nil, p, true
+
+	case shapeLeaf:
+		path, exact := t.leafAccess(p)
+		switch {
+		case path == nil:
+			return nil, nil, false
+		case exact:
+			return path, nil, true
+		default:
+			return path, p, true
+		}
+
+	case shapeOr:
+		or, isOr := p.(boundOr)
+		if !isOr || len(or.preds) != len(shape.children) {
+			return nil, nil, false
+		}
+		if len(or.preds) == 0 {
+			return nothingPath(), nil, true
+		}
+
+		exact := true
+		children := make([]*accessPath, len(or.preds))
+		for i, pred := range or.preds {
+			child, residual, ok := t.replan(pred, shape.children[i])
+			if !ok || child == nil {
+				return nil, nil, false
+			}
+			children[i] = child
+			exact = exact && residual == nil
+		}
+		path, residual := unionPath(or, children, exact)
+		return path, residual, true
+	}
+
+	conjuncts := conjunctsOf(p)
+	if len(conjuncts) != shape.conjuncts {
+		return nil, nil, false
+	}
+
+	chosen := make([]conjunctAccess, len(shape.accesses))
+	for i, access := range shape.accesses {
+		switch {
+		case access.index != "":
+			idx, exists := t.indexes[access.index]
+			if !exists {
+				return nil, nil, false
+			}
+			var exact bool
+			access.path, exact, ok = t.compositePath(access.index, idx, conjuncts, access.covered, access.ranged)
+			if !ok || exact != access.exact {
+				return nil, nil, false
+			}
+
+		case access.child != nil:
+			var childResidual boundPred
+			access.path, childResidual, ok = t.replan(conjuncts[access.covered[0]], access.child)
+			if !ok || access.path == nil || (childResidual == nil) != access.exact {
+				return nil, nil, false
+			}
+
+		default:
+			var exact bool
+			access.path, exact = t.leafAccess(conjuncts[access.covered[0]])
+			if access.path == nil || exact != access.exact {
+				return nil, nil, false
+			}
+		}
+		chosen[i] = access
+	}
+
+	path, residual = intersectAccesses(conjuncts, chosen)
+	return path, residual, true
+}
+
+/* selectRows returns the rows matching the predicate and their ids, the caller must hold the read lock */
+func (t *Table) selectRows(pred boundPred) ([]Row, []int) {
+	return t.selectPlanned(t.planAccess(pred))
+}
+
+/* selectPlanned returns the rows found by the access path which match the residual, the caller must hold the read lock */
+func (t *Table) selectPlanned(path *accessPath, residual boundPred) ([]Row, []int) {
+	var rows []Row
+	var ids []int
+	if path == nil {
+		for slot, row := range t.rows {
+			if row != nil && (residual == nil || residual.match(row)) {
+				rows = append(rows, row)
+				ids = append(ids, t.rowIDs[slot])
+			}
+		}
+		return rows, ids
+	}
+
+	for _, id := range path.ids() {
+		if row, exists := t.rowByID(id); exists && (residual == nil || residual.match(row)) {
+			rows = append(rows, row)
+			ids = append(ids, id)
+		}
+	}
+	return rows, ids
+}
@@ -0,0 +1,440 @@
+package flimsydb
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/*
+a Predicate is a condition on the columns of a row, comparisons never
+match NULL, so Ne(col, v) leaves out the rows holding NULL like in SQL,
+Eq(col, nil) and Ne(col, nil) are the same as IsNull(col) and its negation,
+Not is the plain complement of its predicate
+*/
+type Predicate interface {
+	fmt.Stringer
+	bind(t *Table) (boundPred, error)
+}
+
+/* a predicate bound to the scheme of a table, with its values serialized */
+type boundPred interface {
+	match(row Row) bool
+}
+
+type compareOp int
+
+const (
+	opEq compareOp = iota
+	opNe
+	opLt
+	opLe
+	opGt
+	opGe
+)
+
+var compareOpNames = [...]string{"=", "!=", "<", "<=", ">", ">="}
+
+type comparison struct {
+	col string
+	op  compareOp
+	val any
+}
+
+func Eq(col string, val any) Predicate { return comparison{col, opEq, val} }
+func Ne(col string, val any) Predicate { return comparison{col, opNe, val} }
+func Lt(col string, val any) Predicate { return comparison{col, opLt, val} }
+func Le(col string, val any) Predicate { return comparison{col, opLe, val} }
+func Gt(col string, val any) Predicate { return comparison{col, opGt, val} }
+func Ge(col string, val any) Predicate { return comparison{col, opGe, val} }
+
+type between struct {
+	col      string
+	min, max any
+}
+
+/* Between matches the values between min and max inclusively */
+func Between(col string, min any, max any) Predicate { return between{col, min, max} }
+
+type in struct {
+	col  string
+	vals []any
+}
+
+/* In matches the values equal to one of vals, a nil value matches NULL */
+func In(col string, vals ...any) Predicate { return in{col, vals} }
+
+type like struct {
+	col     string
+	pattern string
+}
+
+/* Like matches strings and enum labels against a pattern where % is any run of characters and _ is one character */
+func Like(col string, pattern string) Predicate { return like{col, pattern} }
+
+type isNull struct {
+	col string
+}
+
+func IsNull(col string) Predicate { return isNull{col} }
+
+type and struct {
+	preds []Predicate
+}
+
+/* And matches the rows matched by every predicate, an empty And matches every row */
+func And(preds ...Predicate) Predicate { return and{preds} }
+
+type or struct {
+	preds []Predicate
+}
+
+/* Or matches the rows matched by at least one predicate, an empty Or matches no row */
+func Or(preds ...Predicate) Predicate { return or{preds} }
+
+type not struct {
+	pred Predicate
+}
+
+func Not(pred Predicate) Predicate { return not{pred} }
+
+func formatLiteral(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return nullLabel
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func (p comparison) String() string {
+	return fmt.Sprintf("%s %s %s", p.col, compareOpNames[p.op], formatLiteral(p.val))
+}
+
+func (p between) String() string {
+	return fmt.Sprintf("%s BETWEEN %s AND %s", p.col, formatLiteral(p.min), formatLiteral(p.max))
+}
+
+func (p in) String() string {
+	vals := make([]string, len(p.vals))
+	for i, val := range p.vals {
+		vals[i] = formatLiteral(val)
+	}
+	return fmt.Sprintf("%s IN (%s)", p.col, strings.Join(vals, ", "))
+}
+
+func (p like) String() string {
+	return fmt.Sprintf("%s LIKE %q", p.col, p.pattern)
+}
+
+func (p isNull) String() string {
+	return p.col + " IS NULL"
+}
+
+func joinPredicates(preds []Predicate, sep string, empty string) string {
+	if len(preds) == 0 {
+		return empty
+	}
+
+	parts := make([]string, len(preds))
+	for i, pred := range preds {
+		parts[i] = pred.String()
+		if _, nested := pred.(and); nested || isOr(pred) {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+func isOr(pred Predicate) bool {
+	_, ok := pred.(or)
+	return ok
+}
+
+func (p and) String() string {
+	return joinPredicates(p.preds, " AND ", "TRUE")
+}
+
+func (p or) String() string {
+	return joinPredicates(p.preds, " OR ", "FALSE")
+}
+
+func (p not) String() string {
+	return "NOT (" + p.pred.String() + ")"
+}
+
+/* binding */
+
+type boundEq struct {
+	colIndex int
+	value    cm.Blob
+}
+
+type boundNe struct {
+	colIndex int
+	value    cm.Blob
+}
+
+/* a nil bound leaves the range open on that side, NULL is never in a range */
+type boundRange struct {
+	colIndex     int
+	min, max     cm.Blob
+	minInclusive bool
+	maxInclusive bool
+}
+
+type boundIn struct {
+	colIndex int
+	values   []cm.Blob
+}
+
+type boundLike struct {
+	colIndex int
+	col      *Column
+	re       *regexp.Regexp
+	prefix   string
+	pattern  string
+}
+
+type boundIsNull struct {
+	colIndex int
+}
+
+type boundAnd struct {
+	preds []boundPred
+}
+
+type boundOr struct {
+	preds []boundPred
+}
+
+type boundNot struct {
+	pred boundPred
+}
+
+func (p comparison) bind(t *Table) (boundPred, error) {
+	if p.val == nil {
+		switch p.op {
+		case opEq:
+			return isNull{p.col}.bind(t)
+		case opNe:
+			return not{isNull{p.col}}.bind(t)
+		default:
+			return nil, fmt.Errorf("%v: cannot compare with NULL: %w", p, cm.ErrInvalidData)
+		}
+	}
+
+	colIndex, value, err := t.prepareLookup(p.col, p.val)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.op {
+	case opEq:
+		return boundEq{colIndex, value}, nil
+	case opNe:
+		return boundNe{colIndex, value}, nil
+	case opLt:
+		return boundRange{colIndex: colIndex, max: value}, nil
+	case opLe:
+		return boundRange{colIndex: colIndex, max: value, maxInclusive: true}, nil
+	case opGt:
+		return boundRange{colIndex: colIndex, min: value}, nil
+	default:
+		return boundRange{colIndex: colIndex, min: value, minInclusive: true}, nil
+	}
+}
+
+func (p between) bind(t *Table) (boundPred, error) {
+	colIndex, minValue, maxValue, err := t.prepareRangeLookup(p.col, p.min, p.max)
+	if err != nil {
+		return nil, err
+	}
+
+	return boundRange{colIndex, minValue, maxValue, true, true}, nil
+}
+
+func (p in) bind(t *Table) (boundPred, error) {
+	colIndex, exists := t.columnIndex[p.col]
+	if !exists {
+		return nil, fmt.Errorf("column '%s': %w", p.col, cm.ErrColumnNotFound)
+	}
+
+	bound := boundIn{colIndex: colIndex}
+	for _, val := range p.vals {
+		_, value, err := t.prepareLookup(p.col, val)
+		if err != nil {
+			return nil, err
+		}
+		bound.values = append(bound.values, value)
+	}
+	return bound, nil
+}
+
+/* likePattern turns a LIKE pattern into an anchored regular expression and returns its literal prefix */
+func likePattern(pattern string) (*regexp.Regexp, string, error) {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	prefix, literal := "", true
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+			literal = false
+		case '_':
+			sb.WriteString(".")
+			literal = false
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+			if literal {
+				prefix += string(r)
+			}
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	return re, prefix, err
+}
+
+func (p like) bind(t *Table) (boundPred, error) {
+	colIndex, exists := t.columnIndex[p.col]
+	if !exists {
+		return nil, fmt.Errorf("column '%s': %w", p.col, cm.ErrColumnNotFound)
+	}
+
+	col := t.scheme[colIndex]
+	if col.Type != cm.StringTType && col.Type != cm.EnumTType {
+		return nil, fmt.Errorf("%v: LIKE needs a string or enum column: %w", p, cm.ErrTypeMismatch)
+	}
+
+	re, prefix, err := likePattern(p.pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", p, cm.ErrInvalidData)
+	}
+	return boundLike{colIndex, col, re, prefix, p.pattern}, nil
+}
+
+func (p isNull) bind(t *Table) (boundPred, error) {
+	colIndex, exists := t.columnIndex[p.col]
+	if !exists {
+		return nil, fmt.Errorf("column '%s': %w", p.col, cm.ErrColumnNotFound)
+	}
+
+	return boundIsNull{colIndex}, nil
+}
+
+func bindAll(t *Table, preds []Predicate) ([]boundPred, error) {
+	bound := make([]boundPred, len(preds))
+	for i, pred := range preds {
+		if pred == nil {
+			return nil, fmt.Errorf("predicate %d is nil: %w", i, cm.ErrInvalidData)
+		}
+
+		var err error
+		if bound[i], err = pred.bind(t); err != nil {
+			return nil, err
+		}
+	}
+
+	return bound, nil
+}
+
+func (p and) bind(t *Table) (boundPred, error) {
+	preds, err := bindAll(t, p.preds)
+	return boundAnd{preds}, err
+}
+
+func (p or) bind(t *Table) (boundPred, error) {
+	preds, err := bindAll(t, p.preds)
+	return boundOr{preds}, err
+}
+
+func (p not) bind(t *Table) (boundPred, error) {
+	preds, err := bindAll(t, []Predicate{p.pred})
+	if err != nil {
+		return nil, err
+	}
+	return boundNot{preds[0]}, nil
+}
+
+/* matching */
+
+func (p boundEq) match(row Row) bool {
+	return bytes.Equal(row[p.colIndex], p.value)
+}
+
+func (p boundNe) match(row Row) bool {
+	return !cm.IsNull(row[p.colIndex]) && !bytes.Equal(row[p.colIndex], p.value)
+}
+
+func (p boundRange) inRange(value cm.Blob) bool {
+	if p.min != nil {
+		if c := bytes.Compare(value, p.min); c < 0 || c == 0 && !p.minInclusive {
+			return false
+		}
+	}
+	if p.max != nil {
+		if c := bytes.Compare(value, p.max); c > 0 || c == 0 && !p.maxInclusive {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p boundRange) match(row Row) bool {
+	return !cm.IsNull(row[p.colIndex]) && p.inRange(row[p.colIndex])
+}
+
+func (p boundIn) match(row Row) bool {
+	for _, value := range p.values {
+		if bytes.Equal(row[p.colIndex], value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p boundLike) match(row Row) bool {
+	value, err := p.col.deserialize(row[p.colIndex])
+	if err != nil || value == nil {
+		return false
+	}
+
+	return p.re.MatchString(value.(string))
+}
+
+func (p boundIsNull) match(row Row) bool {
+	return cm.IsNull(row[p.colIndex])
+}
+
+func (p boundAnd) match(row Row) bool {
+	for _, pred := range p.preds {
+		if !pred.match(row) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p boundOr) match(row Row) bool {
+	for _, pred := range p.preds {
+		if pred.match(row) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p boundNot) match(row Row) bool {
+	return !p.pred.match(row)
+}
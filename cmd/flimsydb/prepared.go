@@ -0,0 +1,356 @@
+package flimsydb
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/*
+a prepared statement is parsed once and resolved against the catalog
+once, its plan holds the table, the columns, the access path and, when
+the WHERE clause has no placeholders, the bound predicate, a clause with
+placeholders is bound on every run and its access path is rebuilt from
+the cached one without looking for indexes again, creating or dropping
+a table makes every plan stale and so does changing the indexes of its
+table for the access path, stale plans are rebuilt on their next run
+*/
+
+/* Stmt is a statement parsed and planned once and run many times with different arguments, it is safe for concurrent use */
+type Stmt struct {
+	db     *FlimsyDB
+	stmt   any
+	params int
+
+	mu   sync.Mutex
+	plan *sqlPlan
+}
+
+/* sqlPlan is a statement resolved against the catalog as of catalogVersion */
+type sqlPlan struct {
+	catalogVersion uint64
+	table          *Table
+	cols           []*Column // inserted or updated columns
+	where          *sqlWhere
+	projection     []int
+	columns        []string
+	keys           []boundSortKey
+}
+
+/* sqlWhere is a WHERE clause checked against the scheme, a clause without placeholders is bound once */
+type sqlWhere struct {
+	expr   sqlExpr
+	fixed  bool
+	pred   boundPred
+	access cachedPlan
+}
+
+/*
+cachedPlan keeps the plan of a query until the indexes of its table
+change, a predicate with placeholders is bound on every run and planned
+from the shape of the cached plan
+*/
+type cachedPlan struct {
+	plan atomic.Pointer[queryPlan]
+}
+
+/* the statements run by Exec and Query are cached like prepared ones, the cache is cleared when it is full */
+const maxCachedStmts = 256
+
+/* Prepare parses and plans a statement, args given to its Exec or Query fill its ? placeholders in order */
+func (db *FlimsyDB) Prepare(sql string) (*Stmt, error) {
+	stmt, params, err := parseSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stmt{db: db, stmt: stmt, params: params}
+	if _, err := s.currentPlan(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+/* cachedStmt returns the cached statement of the text, parsing it on first use */
+func (db *FlimsyDB) cachedStmt(sql string) (*Stmt, error) {
+	db.stmtMu.Lock()
+	defer db.stmtMu.Unlock()
+
+	if s, cached := db.stmts[sql]; cached {
+		return s, nil
+	}
+
+	stmt, params, err := parseSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	if db.stmts == nil || len(db.stmts) >= maxCachedStmts {
+		db.stmts = make(map[string]*Stmt)
+	}
+	s := &Stmt{db: db, stmt: stmt, params: params}
+	db.stmts[sql] = s
+	return s, nil
+}
+
+/* currentPlan returns the plan of the statement, planning it again when the catalog changed */
+func (s *Stmt) currentPlan() (*sqlPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.plan != nil && s.plan.catalogVersion == s.db.catalogVersion.Load() {
+		return s.plan, nil
+	}
+
+	plan, err := s.db.planStatement(s.stmt)
+	if err != nil {
+		return nil, err
+	}
+	s.plan = plan
+	return plan, nil
+}
+
+func (s *Stmt) checkArgs(args []any) error {
+	if s.params != len(args) {
+		return fmt.Errorf("statement has %d placeholders but %d arguments were given: %w", s.params, len(args), cm.ErrInvalidData)
+	}
+	return nil
+}
+
+/* Exec runs a statement which is not a query */
+func (s *Stmt) Exec(args ...any) (Result, error) {
+	if err := s.checkArgs(args); err != nil {
+		return Result{}, err
+	}
+	plan, err := s.currentPlan()
+	if err != nil {
+		return Result{}, err
+	}
+
+	switch stmt := s.stmt.(type) {
+	case *sqlCreateTable:
+		return Result{}, s.db.execCreateTable(stmt, args)
+	case *sqlDropTable:
+		return Result{}, s.db.execDropTable(stmt)
+	case *sqlInsert:
+		return s.db.execInsert(plan, stmt, args)
+	case *sqlUpdate:
+		return s.db.execUpdate(plan, stmt, args)
+	case *sqlDelete:
+		return s.db.execDelete(plan, stmt, args)
+	default:
+		return Result{}, fmt.Errorf("queries are run by Query: %w", cm.ErrInvalidData)
+	}
+}
+
+/* Query runs a SELECT statement or explains one */
+func (s *Stmt) Query(args ...any) (*ResultSet, error) {
+	if err := s.checkArgs(args); err != nil {
+		return nil, err
+	}
+
+	switch stmt := s.stmt.(type) {
+	case *sqlSelect:
+		plan, err := s.currentPlan()
+		if err != nil {
+			return nil, err
+		}
+		return execSelect(plan, stmt, args)
+	case *sqlExplain:
+		plan, err := s.currentPlan()
+		if err != nil {
+			return nil, err
+		}
+		return execExplain(plan, stmt, args)
+	default:
+		return nil, fmt.Errorf("only SELECT and EXPLAIN statements are queries: %w", cm.ErrInvalidData)
+	}
+}
+
+/* planStatement resolves the table and the columns of a statement, tables are created and dropped when the statement runs */
+func (db *FlimsyDB) planStatement(stmt any) (*sqlPlan, error) {
+	plan := &sqlPlan{catalogVersion: db.catalogVersion.Load()}
+	if explain, ok := stmt.(*sqlExplain); ok {
+		stmt = explain.query
+	}
+
+	var tableName string
+	switch stmt := stmt.(type) {
+	case *sqlInsert:
+		tableName = stmt.table
+	case *sqlSelect:
+		tableName = stmt.table
+	case *sqlUpdate:
+		tableName = stmt.table
+	case *sqlDelete:
+		tableName = stmt.table
+	default:
+		return plan, nil
+	}
+
+	t, err := db.GetTable(tableName)
+	if err != nil {
+		return nil, fmt.Errorf("table %q: %w", tableName, err)
+	}
+	plan.table = t
+
+	switch stmt := stmt.(type) {
+	case *sqlInsert:
+		names := stmt.columns
+		if names == nil {
+			for _, col := range t.scheme {
+				names = append(names, col.Name)
+			}
+		}
+		if plan.cols, err = t.sqlColumns(names); err != nil {
+			return nil, err
+		}
+
+	case *sqlSelect:
+		if plan.projection, err = t.bindProjection(stmt.columns); err != nil {
+			return nil, err
+		}
+		for _, colIndex := range plan.projection {
+			plan.columns = append(plan.columns, t.scheme[colIndex].Name)
+		}
+		for _, key := range stmt.order {
+			colIndex, exists := t.columnIndex[key.col]
+			if !exists {
+				return nil, fmt.Errorf("column '%s': %w", key.col, cm.ErrColumnNotFound)
+			}
+			plan.keys = append(plan.keys, boundSortKey{colIndex, key.order == Desc})
+		}
+		plan.where, err = t.planWhere(stmt.where)
+
+	case *sqlUpdate:
+		names := make([]string, len(stmt.set))
+		for i, assignment := range stmt.set {
+			names[i] = assignment.col
+		}
+		if plan.cols, err = t.sqlColumns(names); err != nil {
+			return nil, err
+		}
+		plan.where, err = t.planWhere(stmt.where)
+
+	case *sqlDelete:
+		plan.where, err = t.planWhere(stmt.where)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (t *Table) sqlColumns(names []string) ([]*Column, error) {
+	cols := make([]*Column, len(names))
+	for i, name := range names {
+		var err error
+		if cols[i], err = t.sqlColumn(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return cols, nil
+}
+
+/* planWhere checks the columns of a clause and binds it right away when it has no placeholders */
+func (t *Table) planWhere(expr sqlExpr) (*sqlWhere, error) {
+	params, err := t.checkExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &sqlWhere{expr: expr, fixed: !params}
+	if w.fixed {
+		if w.pred, err = t.bindWhere(expr, nil); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+/* checkExpr makes sure the columns of a clause exist and tells whether it has placeholders */
+func (t *Table) checkExpr(expr sqlExpr) (bool, error) {
+	var col string
+	var vals []sqlValue
+	switch e := expr.(type) {
+	case nil:
+		return false, nil
+	case sqlCompare:
+		col, vals = e.col, []sqlValue{e.val}
+	case sqlBetween:
+		col, vals = e.col, []sqlValue{e.min, e.max}
+	case sqlIn:
+		col, vals = e.col, e.vals
+	case sqlLike:
+		col, vals = e.col, []sqlValue{e.pattern}
+	case sqlIsNull:
+		col = e.col
+	case sqlNot:
+		return t.checkExpr(e.expr)
+	case sqlAnd:
+		return t.checkExprs(e.left, e.right)
+	case sqlOr:
+		return t.checkExprs(e.left, e.right)
+	}
+
+	if _, err := t.sqlColumn(col); err != nil {
+		return false, err
+	}
+	for _, val := range vals {
+		if val.param >= 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *Table) checkExprs(left sqlExpr, right sqlExpr) (bool, error) {
+	l, err := t.checkExpr(left)
+	if err != nil {
+		return false, err
+	}
+	r, err := t.checkExpr(right)
+	return l || r, err
+}
+
+/* bindWhere binds a clause with its arguments, a missing clause gives a nil predicate */
+func (t *Table) bindWhere(expr sqlExpr, args []any) (boundPred, error) {
+	pred, err := t.sqlPredicate(expr, args)
+	if err != nil || pred == nil {
+		return nil, err
+	}
+	return pred.bind(t)
+}
+
+/* bind returns the predicate of the clause for the arguments */
+func (w *sqlWhere) bind(t *Table, args []any) (boundPred, error) {
+	if w.fixed {
+		return w.pred, nil
+	}
+	return t.bindWhere(w.expr, args)
+}
+
+/* queryPlan returns the plan finding the rows, the caller must hold the read lock */
+func (w *sqlWhere) queryPlan(t *Table, pred boundPred, keys []boundSortKey, limited bool) *queryPlan {
+	return w.access.get(t, pred, keys, limited, w.fixed)
+}
+
+/* get returns the plan for pred, fixed tells that pred is the predicate the plan was made for, the caller must hold the read lock */
+func (c *cachedPlan) get(t *Table, pred boundPred, keys []boundSortKey, limited bool, fixed bool) *queryPlan {
+	if plan := c.plan.Load(); plan != nil && plan.indexVersion == t.indexVersion {
+		if fixed {
+			return plan
+		}
+		if rebound := plan.rebind(t, pred); rebound != nil {
+			return rebound
+		}
+	}
+
+	plan := t.planQuery(pred, keys, limited)
+	c.plan.Store(plan)
+	return plan
+}
@@ -0,0 +1,187 @@
+package flimsydb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/*
+the columns marked with PrimaryKeyFlag form the primary key of a table,
+in scheme order, so a table has at most one key which may be composite,
+the table always keeps an index from the encoded key to the row id
+*/
+func primaryKeyColumns(scheme Scheme) []int {
+	var pk []int
+	for i, col := range scheme {
+		if col.Flags&PrimaryKeyFlag != 0 {
+			pk = append(pk, i)
+		}
+	}
+
+	return pk
+}
+
+/* a column is unique on its own if it is flagged so or is the whole primary key */
+func isUniqueColumn(scheme Scheme, colIndex int) bool {
+	if scheme[colIndex].Flags&UniqueFlag != 0 {
+		return true
+	}
+
+	pk := primaryKeyColumns(scheme)
+	return len(pk) == 1 && pk[0] == colIndex
+}
+
+/* every part is length-prefixed, so different keys never encode to the same string */
+func encodeKey(parts []cm.Blob) string {
+	var sb strings.Builder
+	size := make([]byte, 4)
+	for _, part := range parts {
+		binary.BigEndian.PutUint32(size, uint32(len(part)))
+		sb.Write(size)
+		sb.Write(part)
+	}
+
+	return sb.String()
+}
+
+func (t *Table) rowKey(row Row) string {
+	parts := make([]cm.Blob, len(t.pk))
+	for i, colIndex := range t.pk {
+		parts[i] = row[colIndex]
+	}
+
+	return encodeKey(parts)
+}
+
+/* the caller must hold the write lock */
+func (t *Table) indexKey(id int, row Row) {
+	if len(t.pk) != 0 {
+		t.pkIndex[t.rowKey(row)] = id
+	}
+}
+
+/* the caller must hold the write lock */
+func (t *Table) unindexKey(row Row) {
+	if len(t.pk) != 0 {
+		delete(t.pkIndex, t.rowKey(row))
+	}
+}
+
+/* checkKey fails if another row than id already holds the primary key of row, the caller must hold the read lock */
+func (t *Table) checkKey(id int, row Row) error {
+	if len(t.pk) == 0 {
+		return nil
+	}
+
+	if other, exists := t.pkIndex[t.rowKey(row)]; exists && other != id {
+		return fmt.Errorf("the primary key of the row already exists: %w", cm.ErrDuplicateKey)
+	}
+
+	return nil
+}
+
+func (t *Table) prepareKey(key []any) (string, error) {
+	if len(t.pk) == 0 {
+		return "", cm.ErrNoPrimaryKey
+	}
+	if len(key) != len(t.pk) {
+		return "", fmt.Errorf("expected a key of %d values, got %d: %w", len(t.pk), len(key), cm.ErrInvalidData)
+	}
+
+	parts := make([]cm.Blob, len(key))
+	for i, colIndex := range t.pk {
+		col := t.scheme[colIndex]
+		if key[i] == nil {
+			return "", fmt.Errorf("column '%s': %w", col.Name, cm.ErrNullViolation)
+		}
+		if err := col.validate(key[i]); err != nil {
+			return "", fmt.Errorf("column '%s': %w", col.Name, cm.ErrTypeMismatch)
+		}
+
+		blobValue, err := col.serialize(key[i])
+		if err != nil {
+			return "", fmt.Errorf("value serialization error: %w", err)
+		}
+		parts[i] = blobValue
+	}
+
+	return encodeKey(parts), nil
+}
+
+func (t *Table) idByKey(key []any) (int, error) {
+	blobKey, err := t.prepareKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	id, exists := t.pkIndex[blobKey]
+	if !exists {
+		return 0, cm.ErrRowNotFound
+	}
+	return id, nil
+}
+
+/* key holds the values of the primary key columns in scheme order */
+func (t *Table) GetByPK(key ...any) (Row, error) {
+	id, err := t.idByKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.GetRow(id)
+}
+
+/*
+UpdateByPK and DeleteByPK look the key up under the same lock as the
+write, so a concurrent change of the key cannot redirect them to a row
+which no longer has it
+*/
+func (t *Table) UpdateByPK(values map[string]any, key ...any) error {
+	blobKey, err := t.prepareKey(key)
+	if err != nil {
+		return err
+	}
+
+	if db := t.linkedDB(); db != nil {
+		return db.autocommit(func(tx *Tx) error { return tx.updateByKey(t.name, blobKey, values) })
+	}
+
+	if err := t.validateTypes(values); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id, exists := t.pkIndex[blobKey]
+	if !exists {
+		return cm.ErrRowNotFound
+	}
+	return t.applyUpdate(id, values)
+}
+
+func (t *Table) DeleteByPK(key ...any) error {
+	blobKey, err := t.prepareKey(key)
+	if err != nil {
+		return err
+	}
+
+	if db := t.linkedDB(); db != nil {
+		return db.autocommit(func(tx *Tx) error { return tx.deleteByKey(t.name, blobKey) })
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id, exists := t.pkIndex[blobKey]
+	if !exists {
+		return cm.ErrRowNotFound
+	}
+	return t.applyDelete(id)
+}
@@ -0,0 +1,68 @@
+package flimsydb
+
+import (
+	"fmt"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/* Record is a result row holding the selected values by column name */
+type Record map[string]any
+
+/* bindProjection resolves the selected columns, no columns select the whole scheme */
+func (t *Table) bindProjection(cols []string) ([]int, error) {
+	if len(cols) == 0 {
+		projection := make([]int, len(t.scheme))
+		for i := range projection {
+			projection[i] = i
+		}
+		return projection, nil
+	}
+
+	projection := make([]int, len(cols))
+	for i, col := range cols {
+		colIndex, exists := t.columnIndex[col]
+		if !exists {
+			return nil, fmt.Errorf("column '%s': %w", col, cm.ErrColumnNotFound)
+		}
+		projection[i] = colIndex
+	}
+
+	return projection, nil
+}
+
+/* deserializeProjection decodes only the selected values of the rows, in the order of the projection */
+func deserializeProjection(scheme Scheme, rows []Row, projection []int) ([][]any, error) {
+	result := make([][]any, len(rows))
+	for i, row := range rows {
+		values := make([]any, len(projection))
+		for j, colIndex := range projection {
+			value, err := scheme[colIndex].deserialize(row[colIndex])
+			if err != nil {
+				return nil, fmt.Errorf("row deserialization error: %w", err)
+			}
+			values[j] = value
+		}
+		result[i] = values
+	}
+
+	return result, nil
+}
+
+func projectionRecords(scheme Scheme, rows []Row, projection []int) ([]Record, error) {
+	values, err := deserializeProjection(scheme, rows, projection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, len(values))
+	for i, row := range values {
+		record := make(Record, len(projection))
+		for j, colIndex := range projection {
+			record[scheme[colIndex].Name] = row[j]
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
@@ -0,0 +1,363 @@
+package flimsydb
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+type SortOrder int
+
+const (
+	Asc SortOrder = iota
+	Desc
+)
+
+type sortKey struct {
+	col   string
+	order SortOrder
+}
+
+/* Query selects the rows of a table, the methods configure it and return it for chaining */
+type Query struct {
+	table   *Table
+	columns []string
+	where   Predicate
+	groupBy []string
+	order   []sortKey
+	limit   int
+	offset  int
+}
+
+func (t *Table) Query() *Query {
+	return &Query{table: t, limit: -1}
+}
+
+/* Select picks the columns of the result and their order, by default every column is returned */
+func (q *Query) Select(cols ...string) *Query {
+	q.columns = append(q.columns, cols...)
+	return q
+}
+
+/* Where adds a condition, the conditions of several calls must all hold */
+func (q *Query) Where(pred Predicate) *Query {
+	if q.where == nil {
+		q.where = pred
+	} else {
+		q.where = And(q.where, pred)
+	}
+
+	return q
+}
+
+/*
+OrderBy sorts the result by a column, every call adds a key used to break
+the ties of the previous ones, NULL sorts before every value, so it comes
+first in ascending order, rows equal on every key come in row id order
+*/
+func (q *Query) OrderBy(col string, order SortOrder) *Query {
+	q.order = append(q.order, sortKey{col, order})
+	return q
+}
+
+/* Limit keeps at most n rows of the result */
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+/* Offset skips the first n rows of the result */
+func (q *Query) Offset(n int) *Query {
+	q.offset = n
+	return q
+}
+
+func (q *Query) bind() (boundPred, []boundSortKey, error) {
+	if q.limit < -1 || q.offset < 0 {
+		return nil, nil, fmt.Errorf("limit and offset cannot be negative: %w", cm.ErrInvalidData)
+	}
+
+	keys := make([]boundSortKey, len(q.order))
+	for i, key := range q.order {
+		colIndex, exists := q.table.columnIndex[key.col]
+		if !exists {
+			return nil, nil, fmt.Errorf("column '%s': %w", key.col, cm.ErrColumnNotFound)
+		}
+		keys[i] = boundSortKey{colIndex, key.order == Desc}
+	}
+
+	if q.where == nil {
+		return nil, keys, nil
+	}
+	pred, err := q.where.bind(q.table)
+	return pred, keys, err
+}
+
+func (q *Query) run() ([]Row, []int, error) {
+	projection, err := q.table.bindProjection(q.columns)
+	if err != nil {
+		return nil, nil, err
+	}
+	pred, keys, err := q.bind()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := q.table
+	t.mu.RLock()
+	rows := t.execute(pred, keys, q.offset, q.limit)
+	t.mu.RUnlock()
+
+	return rows, projection, nil
+}
+
+/* Rows runs the query and returns the selected values of every row */
+func (q *Query) Rows() ([][]any, error) {
+	rows, projection, err := q.run()
+	if err != nil {
+		return nil, err
+	}
+
+	return deserializeProjection(q.table.scheme, rows, projection)
+}
+
+/* Records runs the query and returns the rows as records of the selected columns */
+func (q *Query) Records() ([]Record, error) {
+	rows, projection, err := q.run()
+	if err != nil {
+		return nil, err
+	}
+
+	return projectionRecords(q.table.scheme, rows, projection)
+}
+
+/* Param is a placeholder standing for a value of a prepared query, Param(n) is the n-th argument counting from 1 */
+type Param int
+
+func (p Param) String() string {
+	return fmt.Sprintf("$%d", int(p))
+}
+
+/*
+PreparedQuery is a query bound to the scheme once and run many times with
+different arguments, a predicate without placeholders is bound once too,
+its plan is kept until the indexes of the table change and the plan of a
+predicate with placeholders is rebuilt from it with the values of every
+run, once its table is deleted the query fails with ErrTableNotFound, it
+is safe for concurrent use
+*/
+type PreparedQuery struct {
+	table          *Table
+	db             *FlimsyDB // set when the table belonged to a database
+	catalogVersion atomic.Uint64
+	where          Predicate
+	params         int
+	pred           boundPred // set when where has no placeholders
+	projection     []int
+	keys           []boundSortKey
+	limit          int
+	offset         int
+	access         cachedPlan
+}
+
+/* Prepare checks and binds the query, the arguments given to its Rows and Records fill its Param placeholders */
+func (q *Query) Prepare() (*PreparedQuery, error) {
+	projection, err := q.table.bindProjection(q.columns)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := q.table.checkParams(q.where)
+	if err != nil {
+		return nil, err
+	}
+
+	/* the predicate is bound below once it is known to have no placeholders */
+	unbound := *q
+	unbound.where = nil
+	_, keys, err := unbound.bind()
+	if err != nil {
+		return nil, err
+	}
+
+	pq := &PreparedQuery{
+		table:      q.table,
+		where:      q.where,
+		params:     params,
+		projection: projection,
+		keys:       keys,
+		limit:      q.limit,
+		offset:     q.offset,
+	}
+	if params == 0 && q.where != nil {
+		if pq.pred, err = q.where.bind(q.table); err != nil {
+			return nil, err
+		}
+	}
+
+	q.table.mu.RLock()
+	pq.db = q.table.db
+	q.table.mu.RUnlock()
+	if pq.db != nil {
+		pq.catalogVersion.Store(pq.db.catalogVersion.Load())
+	}
+	return pq, nil
+}
+
+/* checkTable makes sure the table of the query still belongs to its database */
+func (pq *PreparedQuery) checkTable() error {
+	if pq.db == nil {
+		return nil
+	}
+
+	version := pq.db.catalogVersion.Load()
+	if pq.catalogVersion.Load() == version {
+		return nil
+	}
+	if t, err := pq.db.GetTable(pq.table.name); err != nil || t != pq.table {
+		return fmt.Errorf("table %q: %w", pq.table.name, cm.ErrTableNotFound)
+	}
+	pq.catalogVersion.Store(version)
+	return nil
+}
+
+/* checkParams makes sure the columns of a predicate exist and returns the number of arguments its placeholders need */
+func (t *Table) checkParams(pred Predicate) (int, error) {
+	var cols []string
+	var vals []any
+	switch p := pred.(type) {
+	case nil:
+		return 0, nil
+	case comparison:
+		cols, vals = []string{p.col}, []any{p.val}
+	case between:
+		cols, vals = []string{p.col}, []any{p.min, p.max}
+	case in:
+		cols, vals = []string{p.col}, p.vals
+	case like:
+		cols = []string{p.col}
+	case isNull:
+		cols = []string{p.col}
+	case and:
+		return t.checkAllParams(p.preds)
+	case or:
+		return t.checkAllParams(p.preds)
+	case not:
+		return t.checkAllParams([]Predicate{p.pred})
+	}
+
+	for _, col := range cols {
+		if _, exists := t.columnIndex[col]; !exists {
+			return 0, fmt.Errorf("column '%s': %w", col, cm.ErrColumnNotFound)
+		}
+	}
+
+	params := 0
+	for _, val := range vals {
+		if n, ok := val.(Param); ok {
+			if n < 1 {
+				return 0, fmt.Errorf("%v: placeholders count from 1: %w", pred, cm.ErrInvalidData)
+			}
+			params = max(params, int(n))
+		}
+	}
+	return params, nil
+}
+
+func (t *Table) checkAllParams(preds []Predicate) (int, error) {
+	params := 0
+	for i, pred := range preds {
+		if pred == nil {
+			return 0, fmt.Errorf("predicate %d is nil: %w", i, cm.ErrInvalidData)
+		}
+
+		n, err := t.checkParams(pred)
+		if err != nil {
+			return 0, err
+		}
+		params = max(params, n)
+	}
+
+	return params, nil
+}
+
+/* withArgs replaces the placeholders of a predicate with their arguments */
+func withArgs(pred Predicate, args []any) Predicate {
+	arg := func(val any) any {
+		if n, ok := val.(Param); ok {
+			return args[n-1]
+		}
+		return val
+	}
+	all := func(preds []Predicate) []Predicate {
+		result := make([]Predicate, len(preds))
+		for i, p := range preds {
+			result[i] = withArgs(p, args)
+		}
+		return result
+	}
+
+	switch p := pred.(type) {
+	case comparison:
+		return comparison{p.col, p.op, arg(p.val)}
+	case between:
+		return between{p.col, arg(p.min), arg(p.max)}
+	case in:
+		vals := make([]any, len(p.vals))
+		for i, val := range p.vals {
+			vals[i] = arg(val)
+		}
+		return in{p.col, vals}
+	case and:
+		return and{all(p.preds)}
+	case or:
+		return or{all(p.preds)}
+	case not:
+		return not{withArgs(p.pred, args)}
+	default:
+		return pred
+	}
+}
+
+func (pq *PreparedQuery) run(args []any) ([]Row, error) {
+	if pq.params != len(args) {
+		return nil, fmt.Errorf("query has %d placeholders but %d arguments were given: %w", pq.params, len(args), cm.ErrInvalidData)
+	}
+	if err := pq.checkTable(); err != nil {
+		return nil, err
+	}
+
+	t := pq.table
+	pred := pq.pred
+	if pq.params != 0 {
+		var err error
+		if pred, err = withArgs(pq.where, args).bind(t); err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.runQuery(pq.access.get(t, pred, pq.keys, pq.limit >= 0, pq.params == 0), pq.offset, pq.limit), nil
+}
+
+/* Rows runs the query with the arguments of its placeholders and returns the selected values of every row */
+func (pq *PreparedQuery) Rows(args ...any) ([][]any, error) {
+	rows, err := pq.run(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return deserializeProjection(pq.table.scheme, rows, pq.projection)
+}
+
+/* Records runs the query with the arguments of its placeholders and returns the rows as records of the selected columns */
+func (pq *PreparedQuery) Records(args ...any) ([]Record, error) {
+	rows, err := pq.run(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return projectionRecords(pq.table.scheme, rows, pq.projection)
+}
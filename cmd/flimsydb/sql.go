@@ -0,0 +1,507 @@
+package flimsydb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/*
+SQL statements run on top of the table methods, writes go through a
+transaction, so a statement changing several rows changes all of them
+or none, timestamps are written as RFC 3339 strings and Go integers of
+any size are accepted for integer, float and decimal columns
+*/
+
+/* Result reports the effect of a statement run by Exec */
+type Result struct {
+	RowsAffected int
+	LastInsertID int // row id of the last row inserted by the statement
+}
+
+/* ResultSet holds the rows of a query, the values of a row follow the order of Columns */
+type ResultSet struct {
+	Columns []string
+	Rows    [][]any
+}
+
+func (rs *ResultSet) Records() []Record {
+	records := make([]Record, len(rs.Rows))
+	for i, row := range rs.Rows {
+		record := make(Record, len(rs.Columns))
+		for j, col := range rs.Columns {
+			record[col] = row[j]
+		}
+		records[i] = record
+	}
+
+	return records
+}
+
+/* Exec runs a statement which is not a query, args fill its ? placeholders in order */
+func (db *FlimsyDB) Exec(sql string, args ...any) (Result, error) {
+	s, err := db.cachedStmt(sql)
+	if err != nil {
+		return Result{}, err
+	}
+	return s.Exec(args...)
+}
+
+/* Query runs a SELECT statement, args fill its ? placeholders in order */
+func (db *FlimsyDB) Query(sql string, args ...any) (*ResultSet, error) {
+	s, err := db.cachedStmt(sql)
+	if err != nil {
+		return nil, err
+	}
+	return s.Query(args...)
+}
+
+/* resolve gives the value the type of its column */
+func (v sqlValue) resolve(col *Column, args []any) (any, error) {
+	value, err := v.convert(col, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := col.validate(value); err != nil {
+		return nil, fmt.Errorf("column '%s': %v: %w", col.Name, err, cm.ErrTypeMismatch)
+	}
+
+	return value, nil
+}
+
+func (v sqlValue) convert(col *Column, args []any) (any, error) {
+	if v.param >= 0 {
+		return coerceArg(col, args[v.param])
+	}
+	if v.number != "" {
+		return parseNumber(col, v.number)
+	}
+
+	if s, ok := v.value.(string); ok {
+		switch col.Type {
+		case cm.TimestampTType:
+			ts, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, fmt.Errorf("column '%s': %q is not an RFC 3339 timestamp: %w", col.Name, s, cm.ErrTypeMismatch)
+			}
+			return ts, nil
+		case cm.BytesTType:
+			return []byte(s), nil
+		}
+	}
+
+	return v.value, nil
+}
+
+func parseNumber(col *Column, text string) (any, error) {
+	var value any
+	var err error
+	switch col.Type {
+	case cm.Int32TType:
+		var n int64
+		n, err = strconv.ParseInt(text, 10, 32)
+		value = int32(n)
+	case cm.Int64TType:
+		value, err = strconv.ParseInt(text, 10, 64)
+	case cm.Float64TType:
+		value, err = strconv.ParseFloat(text, 64)
+	case cm.DecimalTType:
+		value, err = cm.ParseDecimal(text)
+	default:
+		return nil, fmt.Errorf("column '%s' is not numeric: %w", col.Name, cm.ErrTypeMismatch)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("column '%s': invalid number %s: %w", col.Name, text, cm.ErrTypeMismatch)
+	}
+	return value, nil
+}
+
+/* coerceArg converts Go numbers to the type of a numeric column, other arguments are used as they are */
+func coerceArg(col *Column, arg any) (any, error) {
+	rv := reflect.ValueOf(arg)
+	if arg == nil || !rv.CanInt() && !rv.CanUint() && !rv.CanFloat() {
+		return arg, nil
+	}
+
+	var n int64
+	isInt := true
+	switch {
+	case rv.CanInt():
+		n = rv.Int()
+	case rv.CanUint() && rv.Uint() <= math.MaxInt64:
+		n = int64(rv.Uint())
+	default:
+		isInt = false
+	}
+
+	switch col.Type {
+	case cm.Int32TType:
+		if isInt && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int32(n), nil
+		}
+	case cm.Int64TType:
+		if isInt {
+			return n, nil
+		}
+	case cm.Float64TType:
+		if isInt {
+			return float64(n), nil
+		}
+		return rv.Float(), nil
+	case cm.DecimalTType:
+		if isInt {
+			return cm.NewDecimal(n, 0), nil
+		}
+	default:
+		return arg, nil
+	}
+
+	return nil, fmt.Errorf("column '%s': argument %v does not fit: %w", col.Name, arg, cm.ErrTypeMismatch)
+}
+
+func (t *Table) sqlColumn(name string) (*Column, error) {
+	colIndex, exists := t.columnIndex[name]
+	if !exists {
+		return nil, fmt.Errorf("column '%s': %w", name, cm.ErrColumnNotFound)
+	}
+	return t.scheme[colIndex], nil
+}
+
+func resolveInt(v sqlValue, args []any) (int, error) {
+	if v.param >= 0 {
+		rv := reflect.ValueOf(args[v.param])
+		if rv.CanInt() {
+			return int(rv.Int()), nil
+		}
+	} else if n, err := strconv.Atoi(v.number); err == nil {
+		return n, nil
+	}
+
+	return 0, fmt.Errorf("limit and offset must be integers: %w", cm.ErrInvalidData)
+}
+
+/* sqlPredicate turns a WHERE clause into a predicate on the table, a nil clause gives a nil predicate */
+func (t *Table) sqlPredicate(expr sqlExpr, args []any) (Predicate, error) {
+	switch e := expr.(type) {
+	case nil:
+		return nil, nil
+
+	case sqlCompare:
+		col, err := t.sqlColumn(e.col)
+		if err != nil {
+			return nil, err
+		}
+		val, err := e.val.resolve(col, args)
+		if err != nil {
+			return nil, err
+		}
+		return comparison{e.col, e.op, val}, nil
+
+	case sqlBetween:
+		col, err := t.sqlColumn(e.col)
+		if err != nil {
+			return nil, err
+		}
+		min, err := e.min.resolve(col, args)
+		if err != nil {
+			return nil, err
+		}
+		max, err := e.max.resolve(col, args)
+		if err != nil {
+			return nil, err
+		}
+		return Between(e.col, min, max), nil
+
+	case sqlIn:
+		col, err := t.sqlColumn(e.col)
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]any, len(e.vals))
+		for i, v := range e.vals {
+			if vals[i], err = v.resolve(col, args); err != nil {
+				return nil, err
+			}
+		}
+		return In(e.col, vals...), nil
+
+	case sqlLike:
+		pattern := e.pattern.value
+		if e.pattern.param >= 0 {
+			pattern = args[e.pattern.param]
+		}
+		s, ok := pattern.(string)
+		if !ok || e.pattern.number != "" {
+			return nil, fmt.Errorf("LIKE needs a string pattern: %w", cm.ErrInvalidData)
+		}
+		return Like(e.col, s), nil
+
+	case sqlIsNull:
+		return IsNull(e.col), nil
+
+	case sqlNot:
+		pred, err := t.sqlPredicate(e.expr, args)
+		if err != nil {
+			return nil, err
+		}
+		return Not(pred), nil
+
+	case sqlAnd:
+		left, right, err := t.sqlPredicates(e.left, e.right, args)
+		if err != nil {
+			return nil, err
+		}
+		return And(left, right), nil
+
+	case sqlOr:
+		left, right, err := t.sqlPredicates(e.left, e.right, args)
+		if err != nil {
+			return nil, err
+		}
+		return Or(left, right), nil
+
+	default:
+		return nil, fmt.Errorf("unknown condition %T: %w", expr, cm.ErrSyntax)
+	}
+}
+
+func (t *Table) sqlPredicates(left sqlExpr, right sqlExpr, args []any) (Predicate, Predicate, error) {
+	l, err := t.sqlPredicate(left, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := t.sqlPredicate(right, args)
+	return l, r, err
+}
+
+func (db *FlimsyDB) execCreateTable(stmt *sqlCreateTable, args []any) error {
+	scheme := make(Scheme, 0, len(stmt.columns))
+	for i, def := range stmt.columns {
+		if stmt.columnIndex(def.name) != i {
+			return fmt.Errorf("column '%s' is declared twice: %w", def.name, cm.ErrInvalidData)
+		}
+
+		var defaultVal any
+		if def.def != nil {
+			/* the default is typed like the column it belongs to */
+			typed := &Column{Name: def.name, Type: def.typ}
+			for _, opt := range def.opts {
+				opt(typed)
+			}
+			var err error
+			if defaultVal, err = def.def.resolve(typed, args); err != nil {
+				return err
+			}
+		}
+
+		col, err := NewColumn(def.name, def.typ, defaultVal, def.idxrType, def.flags, def.opts...)
+		if err != nil {
+			return fmt.Errorf("column '%s': %w", def.name, err)
+		}
+		scheme = append(scheme, col)
+	}
+
+	return db.CreateTable(stmt.table, scheme)
+}
+
+func (db *FlimsyDB) execDropTable(stmt *sqlDropTable) error {
+	err := db.DeleteTable(stmt.table)
+	if stmt.ifExists && errors.Is(err, cm.ErrTableNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (db *FlimsyDB) execInsert(plan *sqlPlan, stmt *sqlInsert, args []any) (Result, error) {
+	tx := db.Begin()
+	var result Result
+	for _, row := range stmt.rows {
+		if len(row) != len(plan.cols) {
+			tx.Rollback()
+			return Result{}, fmt.Errorf("%d values for %d columns: %w", len(row), len(plan.cols), cm.ErrInvalidData)
+		}
+
+		values := make(map[string]any, len(plan.cols))
+		for i, col := range plan.cols {
+			var err error
+			if values[col.Name], err = row[i].resolve(col, args); err != nil {
+				tx.Rollback()
+				return Result{}, err
+			}
+		}
+		var err error
+		if result.LastInsertID, err = tx.InsertRow(stmt.table, values); err != nil {
+			tx.Rollback()
+			return Result{}, err
+		}
+		result.RowsAffected++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+/*
+matchingIDs returns the ids of the rows matching the WHERE clause of a
+plan as of the snapshot of the transaction, so a row changed by another
+commit afterwards makes the commit fail instead of being written blindly
+*/
+func (plan *sqlPlan) matchingIDs(tx *Tx, args []any) ([]int, error) {
+	t := plan.table
+	pred, err := plan.where.bind(t, args)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	access := plan.where.queryPlan(t, pred, nil, false)
+	ids := t.snapshotIDs(access.path, pred, tx.snapshot.ts)
+	t.mu.RUnlock()
+
+	return ids, nil
+}
+
+/* retryConflicts runs a statement again on a newer snapshot when another commit changed its rows first */
+func retryConflicts(run func() (Result, error)) (Result, error) {
+	for {
+		result, err := run()
+		if !errors.Is(err, cm.ErrTxConflict) {
+			return result, err
+		}
+	}
+}
+
+func (db *FlimsyDB) execUpdate(plan *sqlPlan, stmt *sqlUpdate, args []any) (Result, error) {
+	values := make(map[string]any, len(stmt.set))
+	for i, assignment := range stmt.set {
+		col := plan.cols[i]
+		var err error
+		if values[col.Name], err = assignment.value.resolve(col, args); err != nil {
+			return Result{}, err
+		}
+	}
+
+	return retryConflicts(func() (Result, error) {
+		tx := db.Begin()
+		ids, err := plan.matchingIDs(tx, args)
+		if err != nil {
+			tx.Rollback()
+			return Result{}, err
+		}
+
+		for _, id := range ids {
+			if err := tx.UpdateRow(stmt.table, id, values); err != nil {
+				tx.Rollback()
+				return Result{}, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return Result{}, err
+		}
+
+		return Result{RowsAffected: len(ids)}, nil
+	})
+}
+
+func (db *FlimsyDB) execDelete(plan *sqlPlan, stmt *sqlDelete, args []any) (Result, error) {
+	return retryConflicts(func() (Result, error) {
+		tx := db.Begin()
+		ids, err := plan.matchingIDs(tx, args)
+		if err != nil {
+			tx.Rollback()
+			return Result{}, err
+		}
+
+		for _, id := range ids {
+			if err := tx.DeleteRow(stmt.table, id); err != nil {
+				tx.Rollback()
+				return Result{}, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return Result{}, err
+		}
+
+		return Result{RowsAffected: len(ids)}, nil
+	})
+}
+
+/* selectQuery resolves the arguments of a query and plans it, the caller must hold the read lock of the plan's table */
+func (plan *sqlPlan) selectQuery(stmt *sqlSelect, pred boundPred, args []any) (*queryPlan, int, int, error) {
+	limit, offset := -1, 0
+	var err error
+	if stmt.limit != nil {
+		if limit, err = resolveInt(*stmt.limit, args); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	if stmt.offset != nil {
+		if offset, err = resolveInt(*stmt.offset, args); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	if limit < -1 || offset < 0 {
+		return nil, 0, 0, fmt.Errorf("limit and offset cannot be negative: %w", cm.ErrInvalidData)
+	}
+
+	return plan.where.queryPlan(plan.table, pred, plan.keys, stmt.limit != nil), offset, limit, nil
+}
+
+func execSelect(plan *sqlPlan, stmt *sqlSelect, args []any) (*ResultSet, error) {
+	t := plan.table
+	pred, err := plan.where.bind(t, args)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	access, offset, limit, err := plan.selectQuery(stmt, pred, args)
+	var rows []Row
+	if err == nil {
+		rows = t.runQuery(access, offset, limit)
+	}
+	t.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := deserializeProjection(t.scheme, rows, plan.projection)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultSet{Columns: plan.columns, Rows: values}, nil
+}
+
+/* execExplain describes a query with one line of its explanation in every row */
+func execExplain(plan *sqlPlan, stmt *sqlExplain, args []any) (*ResultSet, error) {
+	t := plan.table
+	pred, err := plan.where.bind(t, args)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	access, offset, limit, err := plan.selectQuery(stmt.query, pred, args)
+	var e *Explanation
+	if err == nil {
+		e = t.explain(access, offset, limit, stmt.analyze)
+	}
+	t.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &ResultSet{Columns: []string{"plan"}}
+	for _, line := range e.lines() {
+		rs.Rows = append(rs.Rows, []any{line})
+	}
+	return rs, nil
+}
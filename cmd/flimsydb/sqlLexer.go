@@ -0,0 +1,135 @@
+package flimsydb
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+type sqlTokenKind int
+
+const (
+	tokEOF sqlTokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokNumber
+	tokString
+	tokParam
+	tokSymbol
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+}
+
+func (tok sqlToken) String() string {
+	switch tok.kind {
+	case tokEOF:
+		return "end of statement"
+	case tokString:
+		return "'" + tok.text + "'"
+	default:
+		return fmt.Sprintf("%q", tok.text)
+	}
+}
+
+/* two-character symbols are matched before single characters */
+var sqlSymbols = []string{"<=", ">=", "<>", "!=", "=", "<", ">", "(", ")", ",", ";", "*", ".", "-", "[", "]", "?"}
+
+/*
+tokenizeSQL splits a statement into tokens, keywords are plain identifiers
+recognized by the parser, identifiers may be quoted with double quotes and
+strings with single quotes, doubling the quote escapes it, -- starts a
+comment running to the end of the line
+*/
+func tokenizeSQL(sql string) ([]sqlToken, error) {
+	var tokens []sqlToken
+
+	for pos := 0; pos < len(sql); {
+		c := rune(sql[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+
+		case strings.HasPrefix(sql[pos:], "--"):
+			if end := strings.IndexByte(sql[pos:], '\n'); end >= 0 {
+				pos += end
+			} else {
+				pos = len(sql)
+			}
+
+		case c == '\'' || c == '"':
+			text, end, err := readQuoted(sql, pos)
+			if err != nil {
+				return nil, err
+			}
+			kind := tokString
+			if c == '"' {
+				kind = tokQuotedIdent
+			}
+			tokens = append(tokens, sqlToken{kind, text, pos})
+			pos = end
+
+		case c == '_' || unicode.IsLetter(c):
+			end := pos
+			for end < len(sql) && (sql[end] == '_' || unicode.IsLetter(rune(sql[end])) || unicode.IsDigit(rune(sql[end]))) {
+				end++
+			}
+			tokens = append(tokens, sqlToken{tokIdent, sql[pos:end], pos})
+			pos = end
+
+		case unicode.IsDigit(c):
+			end := pos
+			for end < len(sql) && (unicode.IsDigit(rune(sql[end])) || sql[end] == '.' || sql[end] == 'e' || sql[end] == 'E' ||
+				(sql[end] == '-' || sql[end] == '+') && (sql[end-1] == 'e' || sql[end-1] == 'E')) {
+				end++
+			}
+			tokens = append(tokens, sqlToken{tokNumber, sql[pos:end], pos})
+			pos = end
+
+		default:
+			matched := false
+			for _, symbol := range sqlSymbols {
+				if strings.HasPrefix(sql[pos:], symbol) {
+					kind := tokSymbol
+					if symbol == "?" {
+						kind = tokParam
+					}
+					tokens = append(tokens, sqlToken{kind, symbol, pos})
+					pos += len(symbol)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d: %w", c, pos, cm.ErrSyntax)
+			}
+		}
+	}
+
+	return append(tokens, sqlToken{kind: tokEOF, pos: len(sql)}), nil
+}
+
+func readQuoted(sql string, start int) (string, int, error) {
+	quote := sql[start]
+
+	var sb strings.Builder
+	for pos := start + 1; pos < len(sql); pos++ {
+		if sql[pos] != quote {
+			sb.WriteByte(sql[pos])
+			continue
+		}
+		if pos+1 < len(sql) && sql[pos+1] == quote {
+			sb.WriteByte(quote)
+			pos++
+			continue
+		}
+		return sb.String(), pos + 1, nil
+	}
+
+	return "", 0, fmt.Errorf("unterminated quote at position %d: %w", start, cm.ErrSyntax)
+}
@@ -0,0 +1,846 @@
+package flimsydb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+the parser turns a statement into a syntax tree whose values are still
+untyped, number literals stay text and ? placeholders refer to their
+argument, the values get the type of their column when the statement
+is executed against the scheme of its table
+*/
+
+/* sqlValue is a literal or a placeholder, param is the argument position of a placeholder and -1 for literals */
+type sqlValue struct {
+	param  int
+	number string
+	value  any
+}
+
+type sqlColumnDef struct {
+	name     string
+	typ      cm.TabularType
+	def      *sqlValue
+	flags    FlagsType
+	idxrType indexer.IndexerType
+	opts     []ColumnOption
+}
+
+type sqlCreateTable struct {
+	table   string
+	columns []sqlColumnDef
+}
+
+type sqlDropTable struct {
+	table    string
+	ifExists bool
+}
+
+type sqlInsert struct {
+	table   string
+	columns []string
+	rows    [][]sqlValue
+}
+
+type sqlOrderKey struct {
+	col   string
+	order SortOrder
+}
+
+type sqlSelect struct {
+	table   string
+	columns []string
+	where   sqlExpr
+	order   []sqlOrderKey
+	limit   *sqlValue
+	offset  *sqlValue
+}
+
+/* sqlExplain describes a query instead of running it, with analyze the query runs step by step */
+type sqlExplain struct {
+	analyze bool
+	query   *sqlSelect
+}
+
+type sqlAssignment struct {
+	col   string
+	value sqlValue
+}
+
+type sqlUpdate struct {
+	table string
+	set   []sqlAssignment
+	where sqlExpr
+}
+
+type sqlDelete struct {
+	table string
+	where sqlExpr
+}
+
+/* conditions of a WHERE clause */
+type sqlExpr interface{}
+
+type sqlCompare struct {
+	col string
+	op  compareOp
+	val sqlValue
+}
+
+type sqlBetween struct {
+	col      string
+	min, max sqlValue
+}
+
+type sqlIn struct {
+	col  string
+	vals []sqlValue
+}
+
+type sqlLike struct {
+	col     string
+	pattern sqlValue
+}
+
+type sqlIsNull struct {
+	col string
+}
+
+type sqlAnd struct {
+	left, right sqlExpr
+}
+
+type sqlOr struct {
+	left, right sqlExpr
+}
+
+type sqlNot struct {
+	expr sqlExpr
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+	params int
+}
+
+/* parseSQL parses a single statement and returns it with the number of its placeholders */
+func parseSQL(sql string) (any, int, error) {
+	tokens, err := tokenizeSQL(sql)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	p := &sqlParser{tokens: tokens}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	p.acceptSymbol(";")
+	if p.peek().kind != tokEOF {
+		return nil, 0, p.unexpected()
+	}
+
+	return stmt, p.params, nil
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sqlParser) next() sqlToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *sqlParser) unexpected() error {
+	tok := p.peek()
+	return fmt.Errorf("unexpected %v at position %d: %w", tok, tok.pos, cm.ErrSyntax)
+}
+
+func (p *sqlParser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokIdent && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *sqlParser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectKeyword(keywords ...string) error {
+	for _, keyword := range keywords {
+		if !p.acceptKeyword(keyword) {
+			tok := p.peek()
+			return fmt.Errorf("expected %s, got %v at position %d: %w", keyword, tok, tok.pos, cm.ErrSyntax)
+		}
+	}
+	return nil
+}
+
+func (p *sqlParser) acceptSymbol(symbol string) bool {
+	if tok := p.peek(); tok.kind == tokSymbol && tok.text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		tok := p.peek()
+		return fmt.Errorf("expected %q, got %v at position %d: %w", symbol, tok, tok.pos, cm.ErrSyntax)
+	}
+	return nil
+}
+
+func (p *sqlParser) parseIdent() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokIdent && tok.kind != tokQuotedIdent {
+		return "", fmt.Errorf("expected a name, got %v at position %d: %w", tok, tok.pos, cm.ErrSyntax)
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+/* parseList parses items separated by commas */
+func (p *sqlParser) parseList(item func() error) error {
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		if !p.acceptSymbol(",") {
+			return nil
+		}
+	}
+}
+
+func (p *sqlParser) parseIdentList() ([]string, error) {
+	var names []string
+	err := p.parseList(func() error {
+		name, err := p.parseIdent()
+		names = append(names, name)
+		return err
+	})
+	return names, err
+}
+
+func (p *sqlParser) parseValue() (sqlValue, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == tokParam:
+		p.params++
+		return sqlValue{param: p.params - 1}, nil
+	case tok.kind == tokNumber:
+		return sqlValue{param: -1, number: tok.text}, nil
+	case tok.kind == tokSymbol && tok.text == "-" && p.peek().kind == tokNumber:
+		return sqlValue{param: -1, number: "-" + p.next().text}, nil
+	case tok.kind == tokString:
+		return sqlValue{param: -1, value: tok.text}, nil
+	case tok.kind == tokIdent && strings.EqualFold(tok.text, "NULL"):
+		return sqlValue{param: -1}, nil
+	case tok.kind == tokIdent && strings.EqualFold(tok.text, "TRUE"):
+		return sqlValue{param: -1, value: true}, nil
+	case tok.kind == tokIdent && strings.EqualFold(tok.text, "FALSE"):
+		return sqlValue{param: -1, value: false}, nil
+	default:
+		return sqlValue{}, fmt.Errorf("expected a value, got %v at position %d: %w", tok, tok.pos, cm.ErrSyntax)
+	}
+}
+
+func (p *sqlParser) parseValueList() ([]sqlValue, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+
+	var vals []sqlValue
+	err := p.parseList(func() error {
+		val, err := p.parseValue()
+		vals = append(vals, val)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return vals, p.expectSymbol(")")
+}
+
+func (p *sqlParser) parseStatement() (any, error) {
+	switch {
+	case p.acceptKeyword("CREATE"):
+		if err := p.expectKeyword("TABLE"); err != nil {
+			return nil, err
+		}
+		return p.parseCreateTable()
+	case p.acceptKeyword("DROP"):
+		if err := p.expectKeyword("TABLE"); err != nil {
+			return nil, err
+		}
+		return p.parseDropTable()
+	case p.acceptKeyword("INSERT"):
+		if err := p.expectKeyword("INTO"); err != nil {
+			return nil, err
+		}
+		return p.parseInsert()
+	case p.acceptKeyword("SELECT"):
+		return p.parseSelect()
+	case p.acceptKeyword("EXPLAIN"):
+		explain := &sqlExplain{analyze: p.acceptKeyword("ANALYZE")}
+		if err := p.expectKeyword("SELECT"); err != nil {
+			return nil, err
+		}
+		query, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		explain.query = query
+		return explain, nil
+	case p.acceptKeyword("UPDATE"):
+		return p.parseUpdate()
+	case p.acceptKeyword("DELETE"):
+		if err := p.expectKeyword("FROM"); err != nil {
+			return nil, err
+		}
+		return p.parseDelete()
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+func (p *sqlParser) parseCreateTable() (*sqlCreateTable, error) {
+	table, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &sqlCreateTable{table: table}
+
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	err = p.parseList(func() error {
+		/* a table constraint declares a primary key over several columns */
+		if p.acceptKeyword("PRIMARY") {
+			if err := p.expectKeyword("KEY"); err != nil {
+				return err
+			}
+			if err := p.expectSymbol("("); err != nil {
+				return err
+			}
+			names, err := p.parseIdentList()
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				i := stmt.columnIndex(name)
+				if i < 0 {
+					return fmt.Errorf("primary key column '%s': %w", name, cm.ErrColumnNotFound)
+				}
+				stmt.columns[i].flags |= PrimaryKeyFlag
+			}
+			return p.expectSymbol(")")
+		}
+
+		col, err := p.parseColumnDef()
+		stmt.columns = append(stmt.columns, col)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt, p.expectSymbol(")")
+}
+
+func (stmt *sqlCreateTable) columnIndex(name string) int {
+	for i, col := range stmt.columns {
+		if col.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+/* sqlTypes maps the type names to column types, a name followed by [] is an array of that type */
+var sqlTypes = map[string]cm.TabularType{
+	"TEXT":      cm.StringTType,
+	"STRING":    cm.StringTType,
+	"VARCHAR":   cm.StringTType,
+	"INT":       cm.Int32TType,
+	"INTEGER":   cm.Int32TType,
+	"INT32":     cm.Int32TType,
+	"BIGINT":    cm.Int64TType,
+	"INT64":     cm.Int64TType,
+	"FLOAT":     cm.Float64TType,
+	"DOUBLE":    cm.Float64TType,
+	"REAL":      cm.Float64TType,
+	"FLOAT64":   cm.Float64TType,
+	"BOOL":      cm.BoolTType,
+	"BOOLEAN":   cm.BoolTType,
+	"TIMESTAMP": cm.TimestampTType,
+	"BYTES":     cm.BytesTType,
+	"BLOB":      cm.BytesTType,
+	"DECIMAL":   cm.DecimalTType,
+	"NUMERIC":   cm.DecimalTType,
+	"JSON":      cm.JSONTType,
+	"ENUM":      cm.EnumTType,
+}
+
+var sqlArrayTypes = map[cm.TabularType]cm.TabularType{
+	cm.StringTType: cm.StringArrayTType,
+	cm.Int32TType:  cm.Int32ArrayTType,
+	cm.Int64TType:  cm.Int64ArrayTType,
+}
+
+var sqlIndexers = map[string]indexer.IndexerType{
+	"HASH":     indexer.HashMapIndexerType,
+	"BTREE":    indexer.BTreeIndexerType,
+	"INVERTED": indexer.InvertedIndexerType,
+}
+
+var sqlReferenceActions = map[string]ReferenceAction{
+	"RESTRICT": RestrictAction,
+	"CASCADE":  CascadeAction,
+	"SET":      SetNullAction,
+}
+
+func (p *sqlParser) parseColumnDef() (sqlColumnDef, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return sqlColumnDef{}, err
+	}
+	col := sqlColumnDef{name: name}
+	if err := p.parseColumnType(&col); err != nil {
+		return col, err
+	}
+
+	for {
+		switch {
+		case p.acceptKeyword("NOT"):
+			if err := p.expectKeyword("NULL"); err != nil {
+				return col, err
+			}
+			col.flags |= NotNullFlag
+		case p.acceptKeyword("NULL"):
+		case p.acceptKeyword("UNIQUE"):
+			col.flags |= UniqueFlag
+		case p.acceptKeyword("PRIMARY"):
+			if err := p.expectKeyword("KEY"); err != nil {
+				return col, err
+			}
+			col.flags |= PrimaryKeyFlag
+		case p.acceptKeyword("DEFAULT"):
+			def, err := p.parseValue()
+			if err != nil {
+				return col, err
+			}
+			col.def = &def
+		case p.acceptKeyword("INDEX"):
+			if err := p.expectKeyword("USING"); err != nil {
+				return col, err
+			}
+			method, err := p.parseIdent()
+			idxrType, known := sqlIndexers[strings.ToUpper(method)]
+			if err != nil || !known {
+				return col, fmt.Errorf("unknown index method %q: %w", method, cm.ErrSyntax)
+			}
+			col.idxrType = idxrType
+		case p.acceptKeyword("REFERENCES"):
+			if err := p.parseReference(&col); err != nil {
+				return col, err
+			}
+		default:
+			return col, nil
+		}
+	}
+}
+
+func (p *sqlParser) parseColumnType(col *sqlColumnDef) error {
+	typeName, err := p.parseIdent()
+	if err != nil {
+		return err
+	}
+	typ, known := sqlTypes[strings.ToUpper(typeName)]
+	if !known {
+		return fmt.Errorf("unknown type %q: %w", typeName, cm.ErrSyntax)
+	}
+	col.typ = typ
+
+	switch {
+	case typ == cm.EnumTType:
+		labels, err := p.parseValueList()
+		if err != nil {
+			return err
+		}
+		names := make([]string, len(labels))
+		for i, label := range labels {
+			name, ok := label.value.(string)
+			if !ok {
+				return fmt.Errorf("enum labels must be strings: %w", cm.ErrSyntax)
+			}
+			names[i] = name
+		}
+		col.opts = append(col.opts, WithEnum(names...))
+
+	case typ == cm.DecimalTType:
+		if err := p.expectSymbol("("); err != nil {
+			return err
+		}
+		precision, err := p.parseInt()
+		if err != nil {
+			return err
+		}
+		scale := 0
+		if p.acceptSymbol(",") {
+			if scale, err = p.parseInt(); err != nil {
+				return err
+			}
+		}
+		col.opts = append(col.opts, WithDecimal(precision, scale))
+		if err := p.expectSymbol(")"); err != nil {
+			return err
+		}
+
+	case p.acceptSymbol("("):
+		/* the length of VARCHAR(n) is accepted and ignored */
+		if _, err := p.parseInt(); err != nil {
+			return err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return err
+		}
+	}
+
+	if p.acceptSymbol("[") {
+		arrayType, ok := sqlArrayTypes[col.typ]
+		if !ok {
+			return fmt.Errorf("type %q has no array type: %w", typeName, cm.ErrSyntax)
+		}
+		col.typ = arrayType
+		return p.expectSymbol("]")
+	}
+
+	return nil
+}
+
+func (p *sqlParser) parseInt() (int, error) {
+	tok := p.next()
+	n, err := strconv.Atoi(tok.text)
+	if tok.kind != tokNumber || err != nil {
+		return 0, fmt.Errorf("expected an integer, got %v at position %d: %w", tok, tok.pos, cm.ErrSyntax)
+	}
+	return n, nil
+}
+
+func (p *sqlParser) parseReference(col *sqlColumnDef) error {
+	table, err := p.parseIdent()
+	if err != nil {
+		return err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return err
+	}
+	column, err := p.parseIdent()
+	if err != nil {
+		return err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return err
+	}
+
+	action := RestrictAction
+	if p.acceptKeyword("ON") {
+		if err := p.expectKeyword("DELETE"); err != nil {
+			return err
+		}
+		name, err := p.parseIdent()
+		var known bool
+		if action, known = sqlReferenceActions[strings.ToUpper(name)]; err != nil || !known {
+			return fmt.Errorf("unknown reference action %q: %w", name, cm.ErrSyntax)
+		}
+		if action == SetNullAction {
+			if err := p.expectKeyword("NULL"); err != nil {
+				return err
+			}
+		}
+	}
+
+	col.opts = append(col.opts, WithReference(table, column, action))
+	return nil
+}
+
+func (p *sqlParser) parseDropTable() (*sqlDropTable, error) {
+	stmt := &sqlDropTable{}
+	if p.acceptKeyword("IF") {
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.ifExists = true
+	}
+
+	var err error
+	stmt.table, err = p.parseIdent()
+	return stmt, err
+}
+
+func (p *sqlParser) parseInsert() (*sqlInsert, error) {
+	table, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &sqlInsert{table: table}
+
+	if p.acceptSymbol("(") {
+		if stmt.columns, err = p.parseIdentList(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	err = p.parseList(func() error {
+		row, err := p.parseValueList()
+		stmt.rows = append(stmt.rows, row)
+		return err
+	})
+
+	return stmt, err
+}
+
+func (p *sqlParser) parseSelect() (*sqlSelect, error) {
+	stmt := &sqlSelect{}
+	if !p.acceptSymbol("*") {
+		var err error
+		if stmt.columns, err = p.parseIdentList(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.table, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+
+	if stmt.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		err := p.parseList(func() error {
+			col, err := p.parseIdent()
+			key := sqlOrderKey{col: col}
+			if p.acceptKeyword("DESC") {
+				key.order = Desc
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			stmt.order = append(stmt.order, key)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		limit, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		stmt.limit = &limit
+	}
+	if p.acceptKeyword("OFFSET") {
+		offset, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		stmt.offset = &offset
+	}
+
+	return stmt, nil
+}
+
+func (p *sqlParser) parseUpdate() (*sqlUpdate, error) {
+	table, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &sqlUpdate{table: table}
+
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	err = p.parseList(func() error {
+		col, err := p.parseIdent()
+		if err != nil {
+			return err
+		}
+		if err := p.expectSymbol("="); err != nil {
+			return err
+		}
+		value, err := p.parseValue()
+		stmt.set = append(stmt.set, sqlAssignment{col, value})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stmt.where, err = p.parseWhere()
+	return stmt, err
+}
+
+func (p *sqlParser) parseDelete() (*sqlDelete, error) {
+	table, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &sqlDelete{table: table}
+
+	stmt.where, err = p.parseWhere()
+	return stmt, err
+}
+
+/* parseWhere returns nil without a WHERE clause */
+func (p *sqlParser) parseWhere() (sqlExpr, error) {
+	if !p.acceptKeyword("WHERE") {
+		return nil, nil
+	}
+	return p.parseOr()
+}
+
+func (p *sqlParser) parseOr() (sqlExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.acceptKeyword("OR") {
+		var right sqlExpr
+		right, err = p.parseAnd()
+		left = sqlOr{left, right}
+	}
+	return left, err
+}
+
+func (p *sqlParser) parseAnd() (sqlExpr, error) {
+	left, err := p.parseNot()
+	for err == nil && p.acceptKeyword("AND") {
+		var right sqlExpr
+		right, err = p.parseNot()
+		left = sqlAnd{left, right}
+	}
+	return left, err
+}
+
+func (p *sqlParser) parseNot() (sqlExpr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		return sqlNot{expr}, err
+	}
+
+	if p.acceptSymbol("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expectSymbol(")")
+	}
+
+	return p.parseCondition()
+}
+
+var sqlCompareOps = map[string]compareOp{
+	"=":  opEq,
+	"!=": opNe,
+	"<>": opNe,
+	"<":  opLt,
+	"<=": opLe,
+	">":  opGt,
+	">=": opGe,
+}
+
+/* parseCondition parses a condition on a column, the column comes first */
+func (p *sqlParser) parseCondition() (sqlExpr, error) {
+	col, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind == tokSymbol {
+		op, ok := sqlCompareOps[tok.text]
+		if !ok {
+			return nil, p.unexpected()
+		}
+		p.pos++
+		val, err := p.parseValue()
+		return sqlCompare{col, op, val}, err
+	}
+
+	if p.acceptKeyword("IS") {
+		negated := p.acceptKeyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		if negated {
+			return sqlNot{sqlIsNull{col}}, nil
+		}
+		return sqlIsNull{col}, nil
+	}
+
+	negated := p.acceptKeyword("NOT")
+	var expr sqlExpr
+	switch {
+	case p.acceptKeyword("BETWEEN"):
+		min, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		max, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		expr = sqlBetween{col, min, max}
+	case p.acceptKeyword("IN"):
+		vals, err := p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+		expr = sqlIn{col, vals}
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		expr = sqlLike{col, pattern}
+	default:
+		return nil, p.unexpected()
+	}
+
+	if negated {
+		return sqlNot{expr}, nil
+	}
+	return expr, nil
+}
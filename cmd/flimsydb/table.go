@@ -1,6 +1,7 @@
 package flimsydb
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
@@ -11,23 +12,200 @@ import (
 type Row []cm.Blob
 
 type Table struct {
-	mu          sync.RWMutex
-	scheme      Scheme
-	columnIndex map[string]int
-	rows        []Row
+	mu           sync.RWMutex
+	name         string
+	scheme       Scheme
+	columnIndex  map[string]int
+	rows         []Row // deleted rows stay as nil tombstones until the table is vacuumed
+	rowIDs       []int
+	commitTS     []uint64
+	slots        map[int]int
+	nextRowID    int
+	pk           []int
+	pkIndex      map[string]int
+	indexes      map[string]*compositeIndex
+	indexVersion uint64 // changes with the composite indexes, so cached query plans know they are stale
+	tombstones   int
+	history      map[int]*rowHistory
+	clock        *versionClock
+	collectedAt  uint64
+	wal          *WAL
+	closed       bool      // set when its database is closed, writes fail from then on
+	db           *FlimsyDB // set while the table belongs to a database
 	// rowMutexes  map[int]sync.RWMutex
 }
 
+/* the table compacts itself once it holds this many tombstones and they make up half of the rows */
+const autoVacuumThreshold = 1024
+
 func NewTable(scheme Scheme) *Table {
+	return newTable("", scheme, nil, newVersionClock())
+}
+
+func newTable(name string, scheme Scheme, wal *WAL, clock *versionClock) *Table {
 	columnIndex := make(map[string]int, len(scheme))
 	for i, col := range scheme {
 		columnIndex[col.Name] = i
 	}
 
 	return &Table{
+		name:        name,
 		scheme:      scheme,
 		columnIndex: columnIndex,
 		rows:        []Row{},
+		rowIDs:      []int{},
+		commitTS:    []uint64{},
+		slots:       make(map[int]int),
+		pk:          primaryKeyColumns(scheme),
+		pkIndex:     make(map[string]int),
+		indexes:     make(map[string]*compositeIndex),
+		history:     make(map[int]*rowHistory),
+		clock:       clock,
+		wal:         wal,
+	}
+}
+
+/* the caller must hold the write lock, so records reach the log in the order they are applied */
+func (t *Table) logWrite(rec *walRecord) error {
+	if t.closed {
+		return cm.ErrClosed
+	}
+	if t.wal == nil {
+		return nil
+	}
+
+	rec.Table = t.name
+	if err := t.wal.append(rec); err != nil {
+		return fmt.Errorf("logging failed: %w", err)
+	}
+
+	return nil
+}
+
+func (t *Table) applyRecord(rec *walRecord) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	/* composite indexes are filled by RestoreIndexing like the column indexers */
+	if (rec.Op == walCreateIndex || rec.Op == walDropIndex) && rec.Index == nil {
+		return fmt.Errorf("%w: table %q: index record without an index", cm.ErrLogCorrupted, t.name)
+	}
+	switch rec.Op {
+	case walCreateIndex:
+		if _, err := t.addIndex(*rec.Index); err != nil {
+			return fmt.Errorf("%w: table %q: %w", cm.ErrLogCorrupted, t.name, err)
+		}
+		return nil
+	case walDropIndex:
+		delete(t.indexes, rec.Index.Name)
+		return nil
+	}
+
+	if rec.Op == walInsertRow && t.rowExists(rec.RowID) {
+		return fmt.Errorf("%w: table %q: row %d inserted twice", cm.ErrLogCorrupted, t.name, rec.RowID)
+	}
+	if rec.Op != walInsertRow && !t.rowExists(rec.RowID) {
+		return fmt.Errorf("%w: table %q: row %d: %w", cm.ErrLogCorrupted, t.name, rec.RowID, cm.ErrRowNotFound)
+	}
+	if rec.Op != walDeleteRow && len(rec.Row) != len(t.scheme) {
+		return fmt.Errorf("%w: table %q: row does not match the scheme", cm.ErrLogCorrupted, t.name)
+	}
+
+	switch rec.Op {
+	case walInsertRow:
+		t.appendRow(rec.RowID, rec.Row)
+	case walUpdateRow:
+		t.rows[t.slots[rec.RowID]] = rec.Row
+	case walDeleteRow:
+		t.removeRow(rec.RowID)
+	default:
+		return fmt.Errorf("%w: unknown operation %d", cm.ErrLogCorrupted, rec.Op)
+	}
+
+	return nil
+}
+
+func (t *Table) rowExists(id int) bool {
+	_, exists := t.slots[id]
+	return exists
+}
+
+func (t *Table) rowByID(id int) (Row, bool) {
+	slot, exists := t.slots[id]
+	if !exists {
+		return nil, false
+	}
+
+	return t.rows[slot], true
+}
+
+func (t *Table) appendRow(id int, row Row) {
+	t.slots[id] = len(t.rows)
+	t.rows = append(t.rows, row)
+	t.rowIDs = append(t.rowIDs, id)
+	t.commitTS = append(t.commitTS, 0)
+	t.nextRowID = max(t.nextRowID, id+1)
+}
+
+func (t *Table) removeRow(id int) {
+	slot := t.slots[id]
+	t.rows[slot] = nil
+	delete(t.slots, id)
+	t.tombstones++
+}
+
+/*
+Vacuum drops the tombstones left by deletions and the row versions
+no snapshot needs anymore, row ids and indexers are not affected
+*/
+func (t *Table) Vacuum() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.collectGarbage()
+	t.vacuum()
+}
+
+/* tombstones of rows that snapshots may still read are kept */
+func (t *Table) vacuum() {
+	if t.tombstones == 0 {
+		return
+	}
+
+	kept := 0
+	tombstones := 0
+	for slot, row := range t.rows {
+		id := t.rowIDs[slot]
+		h, hasHistory := t.history[id]
+		if row == nil && !hasHistory {
+			continue
+		}
+
+		if row == nil {
+			tombstones++
+		} else {
+			t.slots[id] = kept
+		}
+		if hasHistory {
+			h.slot = kept
+		}
+
+		t.rows[kept] = row
+		t.rowIDs[kept] = id
+		t.commitTS[kept] = t.commitTS[slot]
+		kept++
+	}
+
+	clear(t.rows[kept:])
+	t.rows = t.rows[:kept]
+	t.rowIDs = t.rowIDs[:kept]
+	t.commitTS = t.commitTS[:kept]
+	t.tombstones = tombstones
+}
+
+func (t *Table) maybeVacuum() {
+	if t.tombstones >= autoVacuumThreshold && t.tombstones*2 >= len(t.rows) {
+		t.vacuum()
 	}
 }
 
@@ -42,7 +220,7 @@ func (t *Table) validateTypes(vals map[string]any) error {
 		}
 
 		col := t.scheme[colIndex]
-		if err := validateType(colVal, col.Type); err != nil {
+		if err := col.validate(colVal); err != nil {
 			return fmt.Errorf("column '%s': %w", col.Name, cm.ErrTypeMismatch)
 		}
 	}
@@ -50,25 +228,70 @@ func (t *Table) validateTypes(vals map[string]any) error {
 	return nil
 }
 
-func (t *Table) indexInBounds(index int) error {
+/*
+linkedDB returns the database of a table linked to others by foreign keys,
+writes to such tables go through a transaction, so the reference checks
+and actions are applied atomically with them
+*/
+func (t *Table) linkedDB() *FlimsyDB {
 	t.mu.RLock()
-	defer t.mu.RUnlock()
-
-	if index < 0 || index >= len(t.rows) {
-		return cm.ErrIndexOutOfBounds
+	db := t.db
+	t.mu.RUnlock()
+	if db == nil {
+		return nil
 	}
 
-	return nil
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if !db.isLinked(t) {
+		return nil
+	}
+	return db
 }
 
-func (t *Table) InsertRow(values map[string]any) error {
+func (t *Table) InsertRow(values map[string]any) (int, error) {
+	if db := t.linkedDB(); db != nil {
+		var id int
+		err := db.autocommit(func(tx *Tx) error {
+			var err error
+			id, err = tx.InsertRow(t.name, values)
+			return err
+		})
+		return id, err
+	}
+
 	if err := t.validateTypes(values); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return 0, fmt.Errorf("validation failed: %w", err)
 	}
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	row, err := t.prepareInsert(values)
+	if err != nil {
+		return 0, err
+	}
+
+	/* a write is logged once it applied, so the log never holds one that failed, a write the log refused is undone */
+	id := t.nextRowID
+	if err := t.insertRow(id, row); err != nil {
+		return 0, err
+	}
+
+	if err := t.logWrite(&walRecord{Op: walInsertRow, RowID: id, Row: row}); err != nil {
+		_, undoErr := t.deleteRow(id)
+		return 0, errors.Join(err, undoErr)
+	}
+
+	t.recordVersion(id, t.slots[id], nil, t.clock.tick())
+	t.collectGarbage()
+
+	return id, nil
+}
+
+/* prepare* and the lowercase write methods below require the caller to hold the write lock */
+func (t *Table) prepareInsert(values map[string]any) (Row, error) {
 	row := make(Row, len(t.scheme))
 
 	for i, col := range t.scheme {
@@ -79,50 +302,68 @@ func (t *Table) InsertRow(values map[string]any) error {
 		if !exists {
 			blobValue = col.Default
 		} else {
-			blobValue, err = Serialize(col.Type, value)
+			blobValue, err = col.serialize(value)
 			if err != nil {
-				return fmt.Errorf("serialization failed: %w", cm.ErrInvalidData)
+				return nil, fmt.Errorf("serialization failed: %w", cm.ErrInvalidData)
 			}
 		}
 
-		if col.Flags&UniqueFlag != 0 {
-			rows, err := t.Find(col.Name, value)
-			if err != nil {
-				return fmt.Errorf("error when checking value for uniqueness")
-			}
-			if len(rows) != 0 {
-				return fmt.Errorf("the field contains the \"unique\" flag, but the supplied value %v already exists", value)
+		if col.Flags&NotNullFlag != 0 && cm.IsNull(blobValue) {
+			return nil, fmt.Errorf("column '%s': %w", col.Name, cm.ErrNullViolation)
+		}
+
+		/* like in SQL, any number of rows may hold NULL in a unique column */
+		if col.Flags&UniqueFlag != 0 && !cm.IsNull(blobValue) {
+			if len(t.lookup(i, blobValue)) != 0 {
+				return nil, fmt.Errorf("the field contains the \"unique\" flag, but the supplied value %v already exists", value)
 			}
 		}
 
 		row[i] = blobValue
 	}
 
-	if err := IdxrAddRow(t.scheme, row, len(t.rows)); err != nil {
-		return fmt.Errorf("indexation failed during add: %w", err)
+	if err := t.checkKey(-1, row); err != nil {
+		return nil, err
 	}
 
-	t.rows = append(t.rows, row)
+	return row, nil
+}
 
+func (t *Table) insertRow(id int, row Row) error {
+	if err := IdxrAddRow(t.scheme, row, id); err != nil {
+		return fmt.Errorf("indexation failed during add: %w", err)
+	}
+
+	t.appendRow(id, row)
+	t.indexKey(id, row)
+	t.indexComposites(id, row)
 	return nil
 }
 
-func (t *Table) GetRow(index int) (Row, error) {
-	if err := t.indexInBounds(index); err != nil {
-		return nil, err
-	}
+func (t *Table) reserveRowID() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
+	id := t.nextRowID
+	t.nextRowID++
+	return id
+}
+
+func (t *Table) GetRow(id int) (Row, error) {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
-	rowCopy := CopyRow(t.rows[index])
+	row, exists := t.rowByID(id)
+	if !exists {
+		return nil, cm.ErrRowNotFound
+	}
 
-	return rowCopy, nil
+	return CopyRow(row), nil
 }
 
-func (t *Table) UpdateRow(index int, values map[string]any) error {
-	if err := t.indexInBounds(index); err != nil {
-		return err
+func (t *Table) UpdateRow(id int, values map[string]any) error {
+	if db := t.linkedDB(); db != nil {
+		return db.autocommit(func(tx *Tx) error { return tx.UpdateRow(t.name, id, values) })
 	}
 
 	if err := t.validateTypes(values); err != nil {
@@ -132,75 +373,147 @@ func (t *Table) UpdateRow(index int, values map[string]any) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	oldRow := CopyRow(t.rows[index])
-	newRow := CopyRow(t.rows[index])
+	return t.applyUpdate(id, values)
+}
+
+func (t *Table) applyUpdate(id int, values map[string]any) error {
+	oldRow, newRow, err := t.prepareUpdate(id, values)
+	if err != nil {
+		return err
+	}
+
+	if err := t.updateRow(id, oldRow, newRow); err != nil {
+		return err
+	}
+
+	if err := t.logWrite(&walRecord{Op: walUpdateRow, RowID: id, Row: newRow}); err != nil {
+		return errors.Join(err, t.updateRow(id, newRow, oldRow))
+	}
+
+	t.recordVersion(id, t.slots[id], oldRow, t.clock.tick())
+	t.collectGarbage()
+
+	return nil
+}
+
+func (t *Table) prepareUpdate(id int, values map[string]any) (Row, Row, error) {
+	row, exists := t.rowByID(id)
+	if !exists {
+		return nil, nil, cm.ErrRowNotFound
+	}
+
+	oldRow := CopyRow(row)
+	newRow := CopyRow(row)
 
 	for colName, newValue := range values {
 		colIndex := t.columnIndex[colName]
 		col := t.scheme[colIndex]
 
-		blobValue, err := Serialize(col.Type, newValue)
+		blobValue, err := col.serialize(newValue)
 		if err != nil {
-			return fmt.Errorf("serialization failed: %w", cm.ErrInvalidData)
+			return nil, nil, fmt.Errorf("serialization failed: %w", cm.ErrInvalidData)
 		}
 
 		if col.Flags&ImmutableFlag != 0 {
-			return fmt.Errorf("error when trying to change a field marked with the \"immutable\" flag")
+			return nil, nil, fmt.Errorf("error when trying to change a field marked with the \"immutable\" flag")
 		}
 
-		if col.Flags&UniqueFlag != 0 {
-			rows, err := t.Find(col.Name, newValue)
-			if err != nil {
-				return fmt.Errorf("error when checking value for uniqueness")
-			}
-			if cm.Equal(newRow[colIndex], blobValue, cm.GetCompareFunc(col.Type)) {
-				if len(rows) != 1 {
-					return fmt.Errorf("the field contains the \"unique\" flag, but the supplied value %v already exists", newValue)
+		if col.Flags&NotNullFlag != 0 && cm.IsNull(blobValue) {
+			return nil, nil, fmt.Errorf("column '%s': %w", col.Name, cm.ErrNullViolation)
+		}
+
+		if col.Flags&UniqueFlag != 0 && !cm.IsNull(blobValue) {
+			for _, otherID := range t.lookup(colIndex, blobValue) {
+				if otherID != id {
+					return nil, nil, fmt.Errorf("the field contains the \"unique\" flag, but the supplied value %v already exists", newValue)
 				}
-			} else if len(rows) != 0 {
-				return fmt.Errorf("the field contains the \"unique\" flag, but the supplied value %v already exists", newValue)
 			}
 		}
 
 		newRow[colIndex] = blobValue
 	}
 
-	if err := IdxrUpdateRow(t.scheme, oldRow, newRow, index); err != nil {
-		return fmt.Errorf("indexation failed during update: %w", err)
+	if err := t.checkKey(id, newRow); err != nil {
+		return nil, nil, err
 	}
 
-	t.rows[index] = newRow
+	return oldRow, newRow, nil
+}
 
+func (t *Table) updateRow(id int, oldRow Row, newRow Row) error {
+	if err := IdxrUpdateRow(t.scheme, oldRow, newRow, id); err != nil {
+		return fmt.Errorf("indexation failed during update: %w", err)
+	}
+
+	t.unindexKey(oldRow)
+	t.indexKey(id, newRow)
+	t.unindexComposites(id, oldRow)
+	t.indexComposites(id, newRow)
+	t.rows[t.slots[id]] = newRow
 	return nil
 }
 
-func (t *Table) DeleteRow(index int) error {
-	if err := t.indexInBounds(index); err != nil {
-		return err
+func (t *Table) DeleteRow(id int) error {
+	if db := t.linkedDB(); db != nil {
+		return db.autocommit(func(tx *Tx) error { return tx.DeleteRow(t.name, id) })
 	}
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	oldRow := CopyRow(t.rows[index])
+	return t.applyDelete(id)
+}
 
-	if err := IdxrDeleteRow(t.scheme, oldRow, index); err != nil {
-		return fmt.Errorf("indexation failed during delete: %w", err)
+func (t *Table) applyDelete(id int) error {
+	slot, exists := t.slots[id]
+	if !exists {
+		return cm.ErrRowNotFound
 	}
 
-	for i := index + 1; i < len(t.rows); i++ {
-		row := t.rows[i]
-		if err := IdxrDeleteRow(t.scheme, row, i); err != nil {
-			return fmt.Errorf("indexation failed during update: %w", err)
-		}
+	oldRow, err := t.deleteRow(id)
+	if err != nil {
+		return err
+	}
 
-		if err := IdxrAddRow(t.scheme, row, i-1); err != nil {
-			return fmt.Errorf("indexation failed during re-add: %w", err)
-		}
+	if err := t.logWrite(&walRecord{Op: walDeleteRow, RowID: id}); err != nil {
+		return errors.Join(err, t.restoreRow(id, slot, oldRow))
+	}
+
+	t.recordVersion(id, slot, oldRow, t.clock.tick())
+	t.collectGarbage()
+	t.maybeVacuum()
+
+	return nil
+}
+
+/* deleteRow returns the removed row so that it can be brought back with restoreRow */
+func (t *Table) deleteRow(id int) (Row, error) {
+	row, exists := t.rowByID(id)
+	if !exists {
+		return nil, cm.ErrRowNotFound
 	}
 
-	t.rows = append(t.rows[:index], t.rows[index+1:]...)
+	if err := IdxrDeleteRow(t.scheme, row, id); err != nil {
+		return nil, fmt.Errorf("indexation failed during delete: %w", err)
+	}
+
+	t.unindexKey(row)
+	t.unindexComposites(id, row)
+	t.removeRow(id)
+	return row, nil
+}
+
+/* the row must have been deleted without vacuuming the table in between */
+func (t *Table) restoreRow(id int, slot int, row Row) error {
+	if err := IdxrAddRow(t.scheme, row, id); err != nil {
+		return fmt.Errorf("indexation failed during restore: %w", err)
+	}
 
+	t.indexKey(id, row)
+	t.indexComposites(id, row)
+	t.rows[slot] = row
+	t.slots[id] = slot
+	t.tombstones--
 	return nil
 }
 
@@ -209,134 +522,196 @@ func (t *Table) RestoreIndexing() error {
 		col.Idxr = indexer.NewIndexer(col.IdxrType, col.Type)
 	}
 
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	for i, row := range t.rows {
-		if err := IdxrAddRow(t.scheme, row, i); err != nil {
-			return fmt.Errorf("re-indexing failed at row %d: %w", i, err)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.indexVersion++
+	clear(t.pkIndex)
+	for _, idx := range t.indexes {
+		idx.idxr = newIndexIdxr(idx.idxrType)
+	}
+	for slot, row := range t.rows {
+		if row == nil {
+			continue
+		}
+
+		id := t.rowIDs[slot]
+		t.indexKey(id, row)
+		t.indexComposites(id, row)
+		if err := IdxrAddRow(t.scheme, row, id); err != nil {
+			return fmt.Errorf("re-indexing failed at row %d: %w", id, err)
 		}
 	}
 
 	return nil
 }
 
-func (t *Table) Find(colName string, val any) ([][]any, error) {
-	colIndex, exists := t.columnIndex[colName]
-	if !exists {
-		return nil, fmt.Errorf("column with name %q does not exist", colName)
+/* the caller must hold the read lock */
+func (t *Table) lookup(colIndex int, blobValue cm.Blob) []int {
+	if len(t.pk) == 1 && t.pk[0] == colIndex {
+		if id, exists := t.pkIndex[encodeKey([]cm.Blob{blobValue})]; exists {
+			return []int{id}
+		}
+		return nil
 	}
 
 	col := t.scheme[colIndex]
-
-	if err := validateType(val, col.Type); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+	if col.IdxrType != indexer.AbsentIndexerType && col.IdxrType != indexer.InvertedIndexerType {
+		return col.Idxr.Find(blobValue)
 	}
 
-	blobValue, err := Serialize(col.Type, val)
-	if err != nil {
-		return nil, fmt.Errorf("value serialization error: %w", err)
+	var ids []int
+	for slot, row := range t.rows {
+		if row == nil {
+			continue
+		}
+		if cm.Equal(row[colIndex], blobValue, cm.GetCompareFunc(col.Type)) {
+			ids = append(ids, t.rowIDs[slot])
+			if col.Flags&UniqueFlag != 0 {
+				break
+			}
+		}
 	}
 
-	var indexes []int
-	if col.IdxrType == indexer.AbsentIndexerType {
-		t.mu.RLock()
-		if col.Flags&UniqueFlag != 0 {
-			for i, row := range t.rows {
-				if cm.Equal(row[colIndex], blobValue, cm.GetCompareFunc(col.Type)) {
-					indexes = append(indexes, i)
-					break
-				}
-			}
-		} else {
-			for i, row := range t.rows {
-				if cm.Equal(row[colIndex], blobValue, cm.GetCompareFunc(col.Type)) {
-					indexes = append(indexes, i)
-				}
-			}
+	return ids
+}
+
+/* the caller must hold the read lock */
+func (t *Table) rowsByIDs(ids []int) []Row {
+	rows := make([]Row, 0, len(ids))
+	for _, id := range ids {
+		if row, exists := t.rowByID(id); exists {
+			rows = append(rows, row)
 		}
-		t.mu.RUnlock()
-	} else {
-		indexes = col.Idxr.Find(blobValue)
 	}
 
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	result := make([][]any, len(indexes))
-	for i, rowIndex := range indexes {
-		result[i], err = DeserializeRow(t.scheme, CopyRow(t.rows[rowIndex]))
+	return rows
+}
+
+/* stored rows are never modified in place, so they can be deserialized after the lock is released */
+func deserializeRows(scheme Scheme, rows []Row) ([][]any, error) {
+	result := make([][]any, len(rows))
+	for i, row := range rows {
+		values, err := DeserializeRow(scheme, row)
 		if err != nil {
 			return nil, fmt.Errorf("row deserialization error: %w", err)
 		}
+		result[i] = values
 	}
 
 	return result, nil
 }
 
-func (t *Table) FindInRange(colName string, minVal any, maxVal any) ([][]any, error) {
+func (t *Table) prepareLookup(colName string, val any) (int, cm.Blob, error) {
 	colIndex, exists := t.columnIndex[colName]
 	if !exists {
-		return nil, fmt.Errorf("column with name %q does not exist", colName)
+		return 0, nil, fmt.Errorf("column with name %q does not exist", colName)
 	}
 
 	col := t.scheme[colIndex]
 
-	if err := validateType(minVal, col.Type); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+	if err := col.validate(val); err != nil {
+		return 0, nil, fmt.Errorf("validation error: %w", err)
 	}
 
-	if err := validateType(maxVal, col.Type); err != nil {
-		return nil, fmt.Errorf("validation error: %w", err)
+	blobValue, err := col.serialize(val)
+	if err != nil {
+		return 0, nil, fmt.Errorf("value serialization error: %w", err)
 	}
 
-	blobMinVal, err := Serialize(col.Type, minVal)
+	return colIndex, blobValue, nil
+}
+
+func (t *Table) prepareRangeLookup(colName string, minVal any, maxVal any) (int, cm.Blob, cm.Blob, error) {
+	if minVal == nil || maxVal == nil {
+		return 0, nil, nil, fmt.Errorf("range bounds cannot be NULL: %w", cm.ErrInvalidData)
+	}
+
+	colIndex, blobMinVal, err := t.prepareLookup(colName, minVal)
 	if err != nil {
-		return nil, fmt.Errorf("value serialization error: %w", err)
+		return 0, nil, nil, err
 	}
 
-	blobMaxVal, err := Serialize(col.Type, maxVal)
+	_, blobMaxVal, err := t.prepareLookup(colName, maxVal)
 	if err != nil {
-		return nil, fmt.Errorf("value serialization error: %w", err)
+		return 0, nil, nil, err
 	}
 
-	var indexes []int
-	if col.IdxrType == indexer.AbsentIndexerType || col.IdxrType == indexer.HashMapIndexerType {
-		t.mu.RLock()
-		for i, row := range t.rows {
-			compFunc := cm.GetCompareFunc(col.Type)
-			if cm.LessOrEqual(row[colIndex], blobMaxVal, compFunc) && cm.GreaterOrEqual(row[colIndex], blobMinVal, compFunc) {
-				indexes = append(indexes, i)
-			}
+	return colIndex, blobMinVal, blobMaxVal, nil
+}
+
+/*
+a nil value finds the rows holding NULL in the column, a JSON column
+is matched on a path with the selector "column->$.path"
+*/
+func (t *Table) Find(colName string, val any) ([][]any, error) {
+	if colName, path, ok, err := splitSelector(colName); ok || err != nil {
+		if err != nil {
+			return nil, err
 		}
-		t.mu.RUnlock()
-	} else {
-		indexes = col.Idxr.FindInRange(blobMinVal, blobMaxVal)
+		return t.findPath(colName, path, val, val)
+	}
+
+	colIndex, blobValue, err := t.prepareLookup(colName, val)
+	if err != nil {
+		return nil, err
 	}
 
 	t.mu.RLock()
-	defer t.mu.RUnlock()
-	result := make([][]any, len(indexes))
-	for i, rowIndex := range indexes {
-		result[i], err = DeserializeRow(t.scheme, CopyRow(t.rows[rowIndex]))
+	rows := t.rowsByIDs(t.lookup(colIndex, blobValue))
+	t.mu.RUnlock()
+
+	return deserializeRows(t.scheme, rows)
+}
+
+func (t *Table) FindInRange(colName string, minVal any, maxVal any) ([][]any, error) {
+	if colName, path, ok, err := splitSelector(colName); ok || err != nil {
 		if err != nil {
-			return nil, fmt.Errorf("row deserialization error: %w", err)
+			return nil, err
+		}
+		if minVal == nil || maxVal == nil {
+			return nil, fmt.Errorf("range bounds cannot be NULL: %w", cm.ErrInvalidData)
 		}
+		return t.findPath(colName, path, minVal, maxVal)
 	}
 
-	return result, nil
+	colIndex, blobMinVal, blobMaxVal, err := t.prepareRangeLookup(colName, minVal, maxVal)
+	if err != nil {
+		return nil, err
+	}
+
+	col := t.scheme[colIndex]
+
+	t.mu.RLock()
+	var ids []int
+	if col.IdxrType != indexer.BTreeIndexerType {
+		compFunc := cm.GetCompareFunc(col.Type)
+		for slot, row := range t.rows {
+			if row == nil {
+				continue
+			}
+			if cm.LessOrEqual(row[colIndex], blobMaxVal, compFunc) && cm.GreaterOrEqual(row[colIndex], blobMinVal, compFunc) {
+				ids = append(ids, t.rowIDs[slot])
+			}
+		}
+	} else {
+		ids = col.Idxr.FindInRange(blobMinVal, blobMaxVal)
+	}
+	rows := t.rowsByIDs(ids)
+	t.mu.RUnlock()
+
+	return deserializeRows(t.scheme, rows)
 }
 
 func (t *Table) GetAll() ([][]any, error) {
 	t.mu.RLock()
-	defer t.mu.RUnlock()
-
-	result := make([][]any, len(t.rows))
-	for i, row := range t.rows {
-		deserializedRow, err := DeserializeRow(t.scheme, CopyRow(row))
-		if err != nil {
-			return nil, fmt.Errorf("row deserialization error: %w", err)
+	rows := make([]Row, 0, len(t.slots))
+	for _, row := range t.rows {
+		if row != nil {
+			rows = append(rows, row)
 		}
-		result[i] = deserializedRow
 	}
+	t.mu.RUnlock()
 
-	return result, nil
+	return deserializeRows(t.scheme, rows)
 }
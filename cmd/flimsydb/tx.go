@@ -0,0 +1,507 @@
+package flimsydb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+type txOp struct {
+	op     walOp
+	table  string
+	rowID  int
+	key    string // set when the row is named by its primary key, the key is looked up on Commit
+	values map[string]any
+}
+
+/* undo entries are applied in reverse order when a commit fails halfway */
+type txUndo struct {
+	op     walOp
+	table  *Table
+	rowID  int
+	slot   int
+	oldRow Row
+	newRow Row
+}
+
+/*
+Tx buffers row operations on one or more tables, they are validated
+and applied together on Commit, nobody sees them before that, reads
+inside the transaction see the database as of Begin together with the
+transaction's own writes, this is snapshot isolation: Commit fails with
+ErrTxConflict when a row it updates or deletes was changed by another
+commit after Begin, so read-modify-write cycles cannot lose updates
+*/
+type Tx struct {
+	mu       sync.Mutex
+	db       *FlimsyDB
+	snapshot *Snapshot
+	ops      []txOp
+	done     bool
+	blind    bool // set for autocommitted writes, which read nothing and cannot conflict
+}
+
+func (db *FlimsyDB) Begin() *Tx {
+	return &Tx{db: db, snapshot: db.Snapshot()}
+}
+
+/* tableOps returns the buffered operations on a table */
+func (tx *Tx) tableOps(tableName string) []txOp {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	var ops []txOp
+	for _, op := range tx.ops {
+		if op.table == tableName {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+/* overlay applies a buffered write to the row it changes, a nil row is one that does not exist */
+func (t *Table) overlay(row Row, op txOp) (Row, error) {
+	switch op.op {
+	case walDeleteRow:
+		return nil, nil
+	case walInsertRow:
+		row = make(Row, len(t.scheme))
+		for i, col := range t.scheme {
+			row[i] = col.Default
+		}
+	default:
+		if row == nil {
+			return nil, nil
+		}
+		row = CopyRow(row)
+	}
+
+	for colName, value := range op.values {
+		colIndex := t.columnIndex[colName]
+		blobValue, err := t.scheme[colIndex].serialize(value)
+		if err != nil {
+			return nil, fmt.Errorf("serialization failed: %w", cm.ErrInvalidData)
+		}
+		row[colIndex] = blobValue
+	}
+	return row, nil
+}
+
+/* view returns the rows of a table the transaction sees, matching rows are kept in table order followed by its own inserts */
+func (tx *Tx) view(tableName string, ops []txOp, match func(row Row) bool) (*Table, []Row, error) {
+	t, err := tx.snapshot.table(tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.mu.RLock()
+	ids, rows := t.visibleRows(tx.snapshot.ts)
+	t.mu.RUnlock()
+
+	for _, op := range ops {
+		if op.op == walInsertRow {
+			ids = append(ids, op.rowID)
+		}
+		if rows[op.rowID], err = t.overlay(rows[op.rowID], op); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var result []Row
+	for _, id := range ids {
+		if row := rows[id]; row != nil && (match == nil || match(row)) {
+			result = append(result, row)
+		}
+	}
+	return t, result, nil
+}
+
+func (tx *Tx) GetRow(tableName string, id int) (Row, error) {
+	ops := tx.tableOps(tableName)
+	if len(ops) == 0 {
+		return tx.snapshot.GetRow(tableName, id)
+	}
+
+	t, err := tx.snapshot.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	row := t.visibleRow(id, tx.snapshot.ts)
+	t.mu.RUnlock()
+
+	for _, op := range ops {
+		if op.rowID != id {
+			continue
+		}
+		if row, err = t.overlay(row, op); err != nil {
+			return nil, err
+		}
+	}
+
+	if row == nil {
+		return nil, cm.ErrRowNotFound
+	}
+	return CopyRow(row), nil
+}
+
+func (tx *Tx) GetAll(tableName string) ([][]any, error) {
+	ops := tx.tableOps(tableName)
+	if len(ops) == 0 {
+		return tx.snapshot.GetAll(tableName)
+	}
+
+	t, rows, err := tx.view(tableName, ops, nil)
+	if err != nil {
+		return nil, err
+	}
+	return deserializeRows(t.scheme, rows)
+}
+
+func (tx *Tx) Find(tableName string, colName string, val any) ([][]any, error) {
+	ops := tx.tableOps(tableName)
+	if len(ops) == 0 {
+		return tx.snapshot.Find(tableName, colName, val)
+	}
+
+	table, err := tx.db.GetTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	colIndex, blobValue, err := table.prepareLookup(colName, val)
+	if err != nil {
+		return nil, err
+	}
+	compFunc := cm.GetCompareFunc(table.scheme[colIndex].Type)
+
+	t, rows, err := tx.view(tableName, ops, func(row Row) bool {
+		return cm.Equal(row[colIndex], blobValue, compFunc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deserializeRows(t.scheme, rows)
+}
+
+func (tx *Tx) FindInRange(tableName string, colName string, minVal any, maxVal any) ([][]any, error) {
+	ops := tx.tableOps(tableName)
+	if len(ops) == 0 {
+		return tx.snapshot.FindInRange(tableName, colName, minVal, maxVal)
+	}
+
+	table, err := tx.db.GetTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	colIndex, blobMinVal, blobMaxVal, err := table.prepareRangeLookup(colName, minVal, maxVal)
+	if err != nil {
+		return nil, err
+	}
+	compFunc := cm.GetCompareFunc(table.scheme[colIndex].Type)
+
+	t, rows, err := tx.view(tableName, ops, func(row Row) bool {
+		return cm.LessOrEqual(row[colIndex], blobMaxVal, compFunc) && cm.GreaterOrEqual(row[colIndex], blobMinVal, compFunc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deserializeRows(t.scheme, rows)
+}
+
+/* the row id is reserved right away, it stays unused if the transaction does not commit */
+func (tx *Tx) InsertRow(tableName string, values map[string]any) (int, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	table, err := tx.table(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := table.validateTypes(values); err != nil {
+		return 0, fmt.Errorf("validation failed: %w", err)
+	}
+
+	id := table.reserveRowID()
+	tx.ops = append(tx.ops, txOp{op: walInsertRow, table: tableName, rowID: id, values: values})
+	return id, nil
+}
+
+func (tx *Tx) UpdateRow(tableName string, id int, values map[string]any) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	table, err := tx.table(tableName)
+	if err != nil {
+		return err
+	}
+
+	if err := table.validateTypes(values); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tx.ops = append(tx.ops, txOp{op: walUpdateRow, table: tableName, rowID: id, values: values})
+	return nil
+}
+
+func (tx *Tx) DeleteRow(tableName string, id int) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if _, err := tx.table(tableName); err != nil {
+		return err
+	}
+
+	tx.ops = append(tx.ops, txOp{op: walDeleteRow, table: tableName, rowID: id})
+	return nil
+}
+
+/* updateByKey buffers an update of the row which has the primary key when the transaction commits */
+func (tx *Tx) updateByKey(tableName string, key string, values map[string]any) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	table, err := tx.table(tableName)
+	if err != nil {
+		return err
+	}
+
+	if err := table.validateTypes(values); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	tx.ops = append(tx.ops, txOp{op: walUpdateRow, table: tableName, key: key, values: values})
+	return nil
+}
+
+func (tx *Tx) deleteByKey(tableName string, key string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if _, err := tx.table(tableName); err != nil {
+		return err
+	}
+
+	tx.ops = append(tx.ops, txOp{op: walDeleteRow, table: tableName, key: key})
+	return nil
+}
+
+func (tx *Tx) table(name string) (*Table, error) {
+	if tx.done {
+		return nil, cm.ErrTxDone
+	}
+
+	return tx.db.GetTable(name)
+}
+
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return cm.ErrTxDone
+	}
+
+	tx.done = true
+	tx.ops = nil
+	tx.snapshot.Release()
+	return nil
+}
+
+/*
+Commit locks every involved table in name order, applies the operations
+one by one and logs them as a single record, on any failure the already
+applied operations are undone and the transaction has no effect, a
+closed database refuses every commit
+*/
+func (tx *Tx) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return cm.ErrTxDone
+	}
+	tx.done = true
+
+	/* deferred first, so the snapshot is released after the tables are unlocked */
+	defer tx.snapshot.Release()
+
+	db := tx.db
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return cm.ErrClosed
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+
+	tables := make(map[string]*Table)
+	for _, op := range tx.ops {
+		table, exists := db.tables[op.table]
+		if !exists {
+			return fmt.Errorf("table %q: %w", op.table, cm.ErrTableNotFound)
+		}
+		tables[op.table] = table
+	}
+	db.linkedTables(tables)
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tables[name].mu.Lock()
+		defer tables[name].mu.Unlock()
+	}
+
+	a := &txApplier{db: db, tables: tables}
+	for _, op := range tx.ops {
+		if op.key != "" {
+			id, exists := tables[op.table].pkIndex[op.key]
+			if !exists {
+				return errors.Join(fmt.Errorf("transaction aborted on table %q: %w", op.table, cm.ErrRowNotFound), rollbackTx(a.undo))
+			}
+			op.rowID = id
+		}
+		if !tx.blind && op.op != walInsertRow && tables[op.table].changedSince(op.rowID, tx.snapshot.ts) {
+			err := fmt.Errorf("row %d: %w", op.rowID, cm.ErrTxConflict)
+			return errors.Join(fmt.Errorf("transaction aborted on table %q: %w", op.table, err), rollbackTx(a.undo))
+		}
+		if err := a.apply(op); err != nil {
+			return errors.Join(fmt.Errorf("transaction aborted on table %q: %w", op.table, err), rollbackTx(a.undo))
+		}
+	}
+
+	if err := db.logWrite(&walRecord{Op: walCommitTx, Batch: a.records}); err != nil {
+		return errors.Join(fmt.Errorf("logging failed: %w", err), rollbackTx(a.undo))
+	}
+
+	ts := db.clock.tick()
+	for _, entry := range a.undo {
+		entry.table.recordVersion(entry.rowID, entry.slot, entry.oldRow, ts)
+	}
+
+	for _, table := range tables {
+		table.collectGarbage()
+		table.maybeVacuum()
+	}
+
+	return nil
+}
+
+/*
+txApplier applies operations to the locked tables, together with the rows
+changed by foreign key actions, and remembers how to undo and log them
+*/
+type txApplier struct {
+	db      *FlimsyDB
+	tables  map[string]*Table
+	undo    []txUndo
+	records []walRecord
+}
+
+func (a *txApplier) apply(op txOp) error {
+	table := a.tables[op.table]
+
+	switch op.op {
+	case walInsertRow:
+		return a.insert(table, op.rowID, op.values)
+	case walUpdateRow:
+		return a.update(table, op.rowID, op.values)
+	default:
+		return a.delete(table, op.rowID)
+	}
+}
+
+/* foreign keys are checked after the row is applied, so a row may refer to itself */
+func (a *txApplier) insert(table *Table, id int, values map[string]any) error {
+	row, err := table.prepareInsert(values)
+	if err != nil {
+		return err
+	}
+	if err := table.insertRow(id, row); err != nil {
+		return err
+	}
+
+	a.undo = append(a.undo, txUndo{op: walInsertRow, table: table, rowID: id, slot: table.slots[id]})
+	a.records = append(a.records, walRecord{Op: walInsertRow, Table: table.name, RowID: id, Row: row})
+
+	return a.checkParents(table, nil, row)
+}
+
+func (a *txApplier) update(table *Table, id int, values map[string]any) error {
+	oldRow, newRow, err := table.prepareUpdate(id, values)
+	if err != nil {
+		return err
+	}
+	if err := a.checkChildren(table, oldRow, newRow); err != nil {
+		return err
+	}
+	if err := table.updateRow(id, oldRow, newRow); err != nil {
+		return err
+	}
+
+	a.undo = append(a.undo, txUndo{op: walUpdateRow, table: table, rowID: id, slot: table.slots[id], oldRow: oldRow, newRow: newRow})
+	a.records = append(a.records, walRecord{Op: walUpdateRow, Table: table.name, RowID: id, Row: newRow})
+
+	return a.checkParents(table, oldRow, newRow)
+}
+
+func (a *txApplier) delete(table *Table, id int) error {
+	slot, exists := table.slots[id]
+	if !exists {
+		return cm.ErrRowNotFound
+	}
+	oldRow, err := table.deleteRow(id)
+	if err != nil {
+		return err
+	}
+
+	a.undo = append(a.undo, txUndo{op: walDeleteRow, table: table, rowID: id, slot: slot, oldRow: oldRow})
+	a.records = append(a.records, walRecord{Op: walDeleteRow, Table: table.name, RowID: id})
+
+	return a.onDelete(table, oldRow)
+}
+
+/* autocommit runs fn in a transaction of its own and commits it */
+func (db *FlimsyDB) autocommit(fn func(tx *Tx) error) error {
+	tx := db.Begin()
+	tx.blind = true
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func rollbackTx(undo []txUndo) error {
+	var errs []error
+	for i := len(undo) - 1; i >= 0; i-- {
+		entry := undo[i]
+
+		var err error
+		switch entry.op {
+		case walInsertRow:
+			_, err = entry.table.deleteRow(entry.rowID)
+		case walUpdateRow:
+			err = entry.table.updateRow(entry.rowID, entry.newRow, entry.oldRow)
+		case walDeleteRow:
+			err = entry.table.restoreRow(entry.rowID, entry.slot, entry.oldRow)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rollback failed for row %d: %w", entry.rowID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
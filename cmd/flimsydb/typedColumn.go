@@ -0,0 +1,119 @@
+package flimsydb
+
+import (
+	"fmt"
+	"reflect"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/*
+the lookups of a TypedTable name their column by a string and take any
+values, so a misspelled column or a value of the wrong type only shows
+up as an error when they run, a column handle is taken from the struct
+field itself:
+
+	name, err := Field(employees, func(e *Employee) *string { return &e.Name })
+	found, err := name.Find("Carol")
+
+so the compiler checks that the field exists and that the values have
+its type, whether the field is mapped to a column is checked once when
+the handle is made
+*/
+
+/* ElementValue lists the element types of array fields */
+type ElementValue interface {
+	~string | ~int32 | ~int64
+}
+
+/* Col is the column of a field of type V in the struct T */
+type Col[T any, V any] struct {
+	tt       *TypedTable[T]
+	colIndex int
+}
+
+/* ArrayCol is the array column of a field of type []E in the struct T */
+type ArrayCol[T any, E ElementValue] struct {
+	Col[T, []E]
+}
+
+/* Field returns the column of the field sel points to, sel must return the address of a field of its argument */
+func Field[T any, V any](tt *TypedTable[T], sel func(*T) *V) (Col[T, V], error) {
+	var v T
+	ptr := sel(&v)
+	rv := reflect.ValueOf(&v).Elem()
+	for _, f := range tt.fields {
+		fv, err := rv.FieldByIndexErr(f.index)
+		if err != nil {
+			continue
+		}
+		if fieldPtr, ok := fv.Addr().Interface().(*V); ok && fieldPtr == ptr {
+			return Col[T, V]{tt: tt, colIndex: f.colIndex}, nil
+		}
+	}
+
+	return Col[T, V]{}, fmt.Errorf("selector of %v does not return a mapped field: %w", rv.Type(), cm.ErrColumnNotFound)
+}
+
+/* ArrayField returns the array column of the field sel points to */
+func ArrayField[T any, E ElementValue](tt *TypedTable[T], sel func(*T) *[]E) (ArrayCol[T, E], error) {
+	col, err := Field(tt, sel)
+	if err != nil {
+		return ArrayCol[T, E]{}, err
+	}
+	return ArrayCol[T, E]{col}, nil
+}
+
+func (c Col[T, V]) Name() string {
+	return c.column().Name
+}
+
+func (c Col[T, V]) column() *Column {
+	return c.tt.table.scheme[c.colIndex]
+}
+
+func (c Col[T, V]) value(v V) any {
+	return columnValue(c.column(), reflect.ValueOf(&v).Elem())
+}
+
+/* Get returns the row whose primary key is made of this column alone and equals v */
+func (c Col[T, V]) Get(v V) (T, error) {
+	var zero T
+	id, err := c.tt.table.idByKey([]any{c.value(v)})
+	if err != nil {
+		return zero, err
+	}
+
+	return c.tt.Get(id)
+}
+
+func (c Col[T, V]) Find(v V) ([]T, error) {
+	return c.tt.records(c.tt.table.Find(c.Name(), c.value(v)))
+}
+
+func (c Col[T, V]) FindInRange(minVal V, maxVal V) ([]T, error) {
+	return c.tt.records(c.tt.table.FindInRange(c.Name(), c.value(minVal), c.value(maxVal)))
+}
+
+func (c ArrayCol[T, E]) FindContaining(elem E) ([]T, error) {
+	elemType, _ := cm.ElementType(c.column().Type)
+	value := reflect.ValueOf(elem).Convert(goTypes[elemType]).Interface()
+	return c.tt.records(c.tt.table.FindContaining(c.Name(), value))
+}
+
+/* columnValue converts a field value to the value of its column, nil pointers and slices are NULL */
+func columnValue(col *Column, fv reflect.Value) any {
+	switch fv.Kind() {
+	case reflect.Pointer:
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	case reflect.Slice:
+		if fv.IsNil() {
+			return nil
+		}
+	}
+
+	return fv.Convert(goTypes[col.Type]).Interface()
+}
@@ -0,0 +1,419 @@
+package flimsydb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/*
+a TypedTable maps the exported fields of a struct to the columns of a
+table, the column of a field is described by its tag:
+
+	Name   string          `flimsy:"name,pk"`
+	Salary cm.Decimal      `flimsy:"salary,decimal=10.2,index=btree"`
+	Level  string          `flimsy:"level,enum=junior|senior,notnull"`
+	Boss   *int64          `flimsy:"boss,ref=employees.id,ondelete=setnull"`
+	Tags   []string        `flimsy:"tags,index=inverted"`
+	Notes  json.RawMessage `flimsy:"-"`
+
+the column name defaults to the field name and the column type follows
+from the field type, pointer, slice and json.RawMessage fields hold NULL
+as nil, other fields read NULL as their zero value
+*/
+const typedTableTag = "flimsy"
+
+var (
+	timeType    = reflect.TypeFor[time.Time]()
+	decimalType = reflect.TypeFor[cm.Decimal]()
+	rawJSONType = reflect.TypeFor[json.RawMessage]()
+)
+
+/* fieldType returns the column type stored in a field of type typ */
+func fieldType(typ reflect.Type) (cm.TabularType, bool) {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch typ {
+	case timeType:
+		return cm.TimestampTType, true
+	case decimalType:
+		return cm.DecimalTType, true
+	case rawJSONType:
+		return cm.JSONTType, true
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return cm.StringTType, true
+	case reflect.Int32:
+		return cm.Int32TType, true
+	case reflect.Int64:
+		return cm.Int64TType, true
+	case reflect.Float64:
+		return cm.Float64TType, true
+	case reflect.Bool:
+		return cm.BoolTType, true
+	case reflect.Slice:
+		switch typ.Elem().Kind() {
+		case reflect.Uint8:
+			return cm.BytesTType, true
+		case reflect.String:
+			return cm.StringArrayTType, true
+		case reflect.Int32:
+			return cm.Int32ArrayTType, true
+		case reflect.Int64:
+			return cm.Int64ArrayTType, true
+		}
+	}
+
+	return 0, false
+}
+
+/* goTypes holds the Go type of the values of every column type, named field types are converted to it */
+var goTypes = map[cm.TabularType]reflect.Type{
+	cm.StringTType:      reflect.TypeFor[string](),
+	cm.Int32TType:       reflect.TypeFor[int32](),
+	cm.Float64TType:     reflect.TypeFor[float64](),
+	cm.Int64TType:       reflect.TypeFor[int64](),
+	cm.BoolTType:        reflect.TypeFor[bool](),
+	cm.TimestampTType:   timeType,
+	cm.BytesTType:       reflect.TypeFor[[]byte](),
+	cm.DecimalTType:     decimalType,
+	cm.JSONTType:        rawJSONType,
+	cm.StringArrayTType: reflect.TypeFor[[]string](),
+	cm.Int32ArrayTType:  reflect.TypeFor[[]int32](),
+	cm.Int64ArrayTType:  reflect.TypeFor[[]int64](),
+	cm.EnumTType:        reflect.TypeFor[string](),
+}
+
+var indexerNames = map[string]indexer.IndexerType{
+	"hash":     indexer.HashMapIndexerType,
+	"btree":    indexer.BTreeIndexerType,
+	"inverted": indexer.InvertedIndexerType,
+}
+
+var flagNames = map[string]FlagsType{
+	"pk":        PrimaryKeyFlag,
+	"unique":    UniqueFlag,
+	"notnull":   NotNullFlag,
+	"immutable": ImmutableFlag,
+}
+
+var actionNames = map[string]ReferenceAction{
+	"restrict": RestrictAction,
+	"cascade":  CascadeAction,
+	"setnull":  SetNullAction,
+}
+
+/* fieldColumn builds the column described by the tag of a struct field */
+func fieldColumn(field reflect.StructField, tag string) (*Column, error) {
+	options := strings.Split(tag, ",")
+	name := options[0]
+	if name == "" {
+		name = field.Name
+	}
+
+	valType, ok := fieldType(field.Type)
+	if !ok {
+		return nil, fmt.Errorf("field %s: type %v has no column type", field.Name, field.Type)
+	}
+
+	idxrType := indexer.AbsentIndexerType
+	var flags FlagsType
+	var opts []ColumnOption
+	var ref *Reference
+	for _, option := range options[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "index":
+			if idxrType, ok = indexerNames[value]; !ok {
+				return nil, fmt.Errorf("field %s: unknown indexer %q", field.Name, value)
+			}
+
+		case "pk", "unique", "notnull", "immutable":
+			flags |= flagNames[key]
+
+		case "decimal":
+			precision, scale, _ := strings.Cut(value, ".")
+			p, pErr := strconv.Atoi(precision)
+			s, sErr := strconv.Atoi(scale)
+			if pErr != nil || sErr != nil {
+				return nil, fmt.Errorf("field %s: decimal needs precision.scale, got %q", field.Name, value)
+			}
+			opts = append(opts, WithDecimal(p, s))
+
+		case "enum":
+			if valType != cm.StringTType {
+				return nil, fmt.Errorf("field %s: enum needs a string field", field.Name)
+			}
+			valType = cm.EnumTType
+			opts = append(opts, WithEnum(strings.Split(value, "|")...))
+
+		case "ref":
+			table, column, found := strings.Cut(value, ".")
+			if !found {
+				return nil, fmt.Errorf("field %s: ref needs table.column, got %q", field.Name, value)
+			}
+			ref = &Reference{Table: table, Column: column}
+
+		case "ondelete":
+			action, known := actionNames[value]
+			if !known || ref == nil {
+				return nil, fmt.Errorf("field %s: ondelete needs a preceding ref and one of restrict, cascade or setnull", field.Name)
+			}
+			ref.OnDelete = action
+
+		default:
+			return nil, fmt.Errorf("field %s: unknown tag option %q", field.Name, option)
+		}
+	}
+	if ref != nil {
+		opts = append(opts, WithReference(ref.Table, ref.Column, ref.OnDelete))
+	}
+
+	col, err := NewColumn(name, valType, nil, idxrType, flags, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", field.Name, err)
+	}
+	return col, nil
+}
+
+/* visitFields calls visit for the exported struct fields of T that are not tagged "-" */
+func visitFields[T any](visit func(field reflect.StructField, tag string) error) error {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("typed tables need a struct type, got %v", typ)
+	}
+
+	for _, field := range reflect.VisibleFields(typ) {
+		tag := field.Tag.Get(typedTableTag)
+		if !field.IsExported() || field.Anonymous || tag == "-" {
+			continue
+		}
+		if err := visit(field, tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/* SchemeOf derives a scheme from the fields of T */
+func SchemeOf[T any]() (Scheme, error) {
+	var scheme Scheme
+	err := visitFields[T](func(field reflect.StructField, tag string) error {
+		col, err := fieldColumn(field, tag)
+		if err != nil {
+			return err
+		}
+		scheme = append(scheme, col)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scheme, nil
+}
+
+type typedField struct {
+	index     []int
+	colIndex  int
+	nullable  bool
+	immutable bool
+}
+
+/* TypedTable reads and writes the rows of a table as values of T */
+type TypedTable[T any] struct {
+	table  *Table
+	fields []typedField
+}
+
+/* CreateTypedTable creates a table with the scheme derived from T */
+func CreateTypedTable[T any](db *FlimsyDB, name string) (*TypedTable[T], error) {
+	scheme, err := SchemeOf[T]()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.CreateTable(name, scheme); err != nil {
+		return nil, err
+	}
+
+	table, err := db.GetTable(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewTypedTable[T](table)
+}
+
+/*
+NewTypedTable binds T to an existing table, every field needs a column
+of the same name and type, columns without a field keep their defaults
+*/
+func NewTypedTable[T any](table *Table) (*TypedTable[T], error) {
+	tt := &TypedTable[T]{table: table}
+	err := visitFields[T](func(field reflect.StructField, tag string) error {
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		colIndex, exists := table.columnIndex[name]
+		if !exists {
+			return fmt.Errorf("field %s: column '%s': %w", field.Name, name, cm.ErrColumnNotFound)
+		}
+		col := table.scheme[colIndex]
+		valType, ok := fieldType(field.Type)
+		if valType == cm.StringTType && col.Type == cm.EnumTType {
+			valType = cm.EnumTType
+		}
+		if !ok || valType != col.Type {
+			return fmt.Errorf("field %s: column '%s': %w", field.Name, name, cm.ErrTypeMismatch)
+		}
+
+		kind := field.Type.Kind()
+		tt.fields = append(tt.fields, typedField{
+			index:     field.Index,
+			colIndex:  colIndex,
+			nullable:  kind == reflect.Pointer || kind == reflect.Slice,
+			immutable: col.Flags&ImmutableFlag != 0,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tt, nil
+}
+
+func (tt *TypedTable[T]) Table() *Table {
+	return tt.table
+}
+
+/* values converts v to the values of its columns, nil fields are left out when skipNull is set */
+func (tt *TypedTable[T]) values(v T, skipNull bool, skipImmutable bool) map[string]any {
+	rv := reflect.ValueOf(v)
+	values := make(map[string]any, len(tt.fields))
+	for _, f := range tt.fields {
+		if skipImmutable && f.immutable {
+			continue
+		}
+
+		name := tt.table.scheme[f.colIndex].Name
+		fv := rv.FieldByIndex(f.index)
+		switch {
+		case f.nullable && fv.IsNil():
+			if !skipNull {
+				values[name] = nil
+			}
+		default:
+			values[name] = columnValue(tt.table.scheme[f.colIndex], fv)
+		}
+	}
+
+	return values
+}
+
+/* record builds a T from deserialized row values */
+func (tt *TypedTable[T]) record(row []any) T {
+	var v T
+	rv := reflect.ValueOf(&v).Elem()
+	for _, f := range tt.fields {
+		value := row[f.colIndex]
+		if value == nil {
+			continue
+		}
+
+		fv := rv.FieldByIndex(f.index)
+		if fv.Kind() == reflect.Pointer {
+			ptr := reflect.New(fv.Type().Elem())
+			ptr.Elem().Set(reflect.ValueOf(value).Convert(fv.Type().Elem()))
+			fv.Set(ptr)
+		} else {
+			fv.Set(reflect.ValueOf(value).Convert(fv.Type()))
+		}
+	}
+
+	return v
+}
+
+func (tt *TypedTable[T]) records(rows [][]any, err error) ([]T, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]T, len(rows))
+	for i, row := range rows {
+		result[i] = tt.record(row)
+	}
+	return result, nil
+}
+
+/* Insert adds v as a new row, nil fields take the default of their column */
+func (tt *TypedTable[T]) Insert(v T) (int, error) {
+	return tt.table.InsertRow(tt.values(v, true, false))
+}
+
+/* Update overwrites the row with the fields of v, nil fields store NULL and immutable columns are kept */
+func (tt *TypedTable[T]) Update(id int, v T) error {
+	return tt.table.UpdateRow(id, tt.values(v, false, true))
+}
+
+func (tt *TypedTable[T]) Delete(id int) error {
+	return tt.table.DeleteRow(id)
+}
+
+func (tt *TypedTable[T]) Get(id int) (T, error) {
+	var v T
+	row, err := tt.table.GetRow(id)
+	if err != nil {
+		return v, err
+	}
+
+	values, err := DeserializeRow(tt.table.scheme, row)
+	if err != nil {
+		return v, err
+	}
+	return tt.record(values), nil
+}
+
+/*
+GetByPK and the lookups below name their column by a string and take
+values of any type, both are checked when they run, the handles made by
+Field and ArrayField are checked by the compiler instead
+*/
+func (tt *TypedTable[T]) GetByPK(key ...any) (T, error) {
+	var v T
+	id, err := tt.table.idByKey(key)
+	if err != nil {
+		return v, err
+	}
+
+	return tt.Get(id)
+}
+
+func (tt *TypedTable[T]) Find(colName string, val any) ([]T, error) {
+	return tt.records(tt.table.Find(colName, val))
+}
+
+func (tt *TypedTable[T]) FindInRange(colName string, minVal any, maxVal any) ([]T, error) {
+	return tt.records(tt.table.FindInRange(colName, minVal, maxVal))
+}
+
+func (tt *TypedTable[T]) FindContaining(colName string, elem any) ([]T, error) {
+	return tt.records(tt.table.FindContaining(colName, elem))
+}
+
+func (tt *TypedTable[T]) All() ([]T, error) {
+	return tt.records(tt.table.GetAll())
+}
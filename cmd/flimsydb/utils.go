@@ -1,17 +1,24 @@
 package flimsydb
 
 import (
-	"bytes"
-	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"slices"
 	"strings"
+	"time"
 
 	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
 )
 
+/* nil stands for NULL and is accepted for every type, NotNullFlag is checked by the table */
 func validateType(val any, expType cm.TabularType) error {
+	if val == nil {
+		return nil
+	}
+
 	var isValid bool
 	var typeName string
 
@@ -25,6 +32,38 @@ func validateType(val any, expType cm.TabularType) error {
 	case cm.Float64TType:
 		_, isValid = val.(float64)
 		typeName = "float64"
+	case cm.Int64TType:
+		_, isValid = val.(int64)
+		typeName = "int64"
+	case cm.BoolTType:
+		_, isValid = val.(bool)
+		typeName = "bool"
+	case cm.TimestampTType:
+		_, isValid = val.(time.Time)
+		typeName = "time.Time"
+	case cm.BytesTType:
+		_, isValid = val.([]byte)
+		typeName = "[]byte"
+	case cm.DecimalTType:
+		_, err := cm.ToDecimal(val)
+		isValid = err == nil
+		typeName = "decimal"
+	case cm.JSONTType:
+		_, err := serializeJSON(val)
+		isValid = err == nil
+		typeName = "JSON document"
+	case cm.StringArrayTType:
+		_, isValid = val.([]string)
+		typeName = "[]string"
+	case cm.Int32ArrayTType:
+		_, isValid = val.([]int32)
+		typeName = "[]int32"
+	case cm.Int64ArrayTType:
+		_, isValid = val.([]int64)
+		typeName = "[]int64"
+	case cm.EnumTType:
+		_, isValid = val.(string)
+		typeName = "enum label"
 	default:
 		return errors.New("type is not tabular")
 	}
@@ -35,8 +74,17 @@ func validateType(val any, expType cm.TabularType) error {
 	return nil
 }
 
+/* the range of time.Time values that fit into int64 nanoseconds */
+var (
+	minTimestamp = time.Unix(0, math.MinInt64)
+	maxTimestamp = time.Unix(0, math.MaxInt64)
+)
+
+/* NULL is stored as an empty blob, no value of any type serializes to zero bytes */
 func Serialize(valueType cm.TabularType, value any) (cm.Blob, error) {
-	buf := new(bytes.Buffer)
+	if value == nil {
+		return nil, nil
+	}
 
 	switch valueType {
 	case cm.Int32TType:
@@ -44,78 +92,161 @@ func Serialize(valueType cm.TabularType, value any) (cm.Blob, error) {
 		if !ok {
 			return nil, errors.New("value does not match int32 type")
 		}
-		if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-			return nil, err
-		}
+		return cm.EncodeInt32(v), nil
 
 	case cm.Float64TType:
 		v, ok := value.(float64)
 		if !ok {
 			return nil, errors.New("value does not match float64 type")
 		}
-		if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
-			return nil, err
-		}
+		return cm.EncodeFloat64(v), nil
 
 	case cm.StringTType:
 		v, ok := value.(string)
 		if !ok {
 			return nil, errors.New("value does not match string type")
 		}
-		strBytes := []byte(v)
-		strLen := int32(len(strBytes))
-		if err := binary.Write(buf, binary.LittleEndian, strLen); err != nil {
-			return nil, err
+		return cm.EncodeString(v), nil
+
+	case cm.Int64TType:
+		v, ok := value.(int64)
+		if !ok {
+			return nil, errors.New("value does not match int64 type")
 		}
-		if _, err := buf.Write(strBytes); err != nil {
-			return nil, err
+		return cm.EncodeInt64(v), nil
+
+	case cm.BoolTType:
+		v, ok := value.(bool)
+		if !ok {
+			return nil, errors.New("value does not match bool type")
+		}
+		return cm.EncodeBool(v), nil
+
+	case cm.TimestampTType:
+		v, ok := value.(time.Time)
+		if !ok {
+			return nil, errors.New("value does not match time.Time type")
+		}
+		if v.Before(minTimestamp) || v.After(maxTimestamp) {
+			return nil, fmt.Errorf("timestamp %v is out of the supported range", v)
 		}
+		return cm.EncodeTimestamp(v), nil
+
+	case cm.BytesTType:
+		v, ok := value.([]byte)
+		if !ok {
+			return nil, errors.New("value does not match []byte type")
+		}
+		return cm.EncodeBytes(v), nil
+
+	case cm.DecimalTType:
+		v, ok := value.(cm.Decimal)
+		if !ok {
+			return nil, errors.New("value does not match decimal type")
+		}
+		if v.Scale < 0 || v.Scale > cm.MaxDecimalPrecision {
+			return nil, fmt.Errorf("decimal scale %d is out of range", v.Scale)
+		}
+		return cm.EncodeDecimal(v), nil
+
+	case cm.JSONTType:
+		return serializeJSON(value)
+
+	case cm.StringArrayTType:
+		v, ok := value.([]string)
+		if !ok {
+			return nil, errors.New("value does not match []string type")
+		}
+		return serializeArray(v, cm.EncodeString), nil
+
+	case cm.Int32ArrayTType:
+		v, ok := value.([]int32)
+		if !ok {
+			return nil, errors.New("value does not match []int32 type")
+		}
+		return serializeArray(v, cm.EncodeInt32), nil
+
+	case cm.Int64ArrayTType:
+		v, ok := value.([]int64)
+		if !ok {
+			return nil, errors.New("value does not match []int64 type")
+		}
+		return serializeArray(v, cm.EncodeInt64), nil
+
+	case cm.EnumTType:
+		return nil, errors.New("enum values are serialized by their column")
 
 	default:
 		return nil, errors.New("unknown data type")
 	}
-
-	return buf.Bytes(), nil
 }
 
 func Deserialize(valueType cm.TabularType, value cm.Blob) (any, error) {
-	buf := bytes.NewReader(value)
+	if cm.IsNull(value) {
+		return nil, nil
+	}
 
 	switch valueType {
 	case cm.Int32TType:
-		var v int32
-		if err := binary.Read(buf, binary.LittleEndian, &v); err != nil {
-			return nil, err
-		}
-		return v, nil
-
+		return cm.DecodeInt32(value)
 	case cm.Float64TType:
-		var v float64
-		if err := binary.Read(buf, binary.LittleEndian, &v); err != nil {
-			return nil, err
-		}
-		return v, nil
-
+		return cm.DecodeFloat64(value)
 	case cm.StringTType:
-		var strLen int32
-		if err := binary.Read(buf, binary.LittleEndian, &strLen); err != nil {
-			return nil, err
-		}
-		strBytes := make([]byte, strLen)
-		if _, err := buf.Read(strBytes); err != nil {
-			return nil, err
-		}
-		return string(strBytes), nil
-
+		return cm.DecodeString(value)
+	case cm.Int64TType:
+		return cm.DecodeInt64(value)
+	case cm.BoolTType:
+		return cm.DecodeBool(value)
+	case cm.TimestampTType:
+		return cm.DecodeTimestamp(value)
+	case cm.BytesTType:
+		return cm.DecodeBytes(value)
+	case cm.DecimalTType:
+		return cm.DecodeDecimal(value)
+	case cm.JSONTType:
+		return json.RawMessage(slices.Clone(value)), nil
+	case cm.StringArrayTType:
+		return deserializeArray(cm.StringTType, value, cm.DecodeString)
+	case cm.Int32ArrayTType:
+		return deserializeArray(cm.Int32TType, value, cm.DecodeInt32)
+	case cm.Int64ArrayTType:
+		return deserializeArray(cm.Int64TType, value, cm.DecodeInt64)
+	case cm.EnumTType:
+		return nil, errors.New("enum values are deserialized by their column")
 	default:
 		return nil, errors.New("unknown data type")
 	}
 }
 
+func serializeArray[E any](values []E, encode func(E) cm.Blob) cm.Blob {
+	elems := make([]cm.Blob, len(values))
+	for i, v := range values {
+		elems[i] = encode(v)
+	}
+
+	return cm.EncodeArray(elems)
+}
+
+func deserializeArray[E any](elemType cm.TabularType, value cm.Blob, decode func(cm.Blob) (E, error)) ([]E, error) {
+	elems, err := cm.DecodeArray(elemType, value)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]E, len(elems))
+	for i, elem := range elems {
+		if values[i], err = decode(elem); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
 func DeserializeRow(scheme Scheme, row Row) ([]any, error) {
 	result := make([]any, len(scheme))
 	for i, col := range scheme {
-		value, err := Deserialize(col.Type, row[i])
+		value, err := col.deserialize(row[i])
 		if err != nil {
 			return nil, fmt.Errorf("deserialization error: %w", err)
 		}
@@ -138,6 +269,31 @@ func CopyRow(row Row) Row {
 	return rowCopy
 }
 
+const nullLabel = "NULL"
+
+func formatValue(valType cm.TabularType, value any) string {
+	if value == nil {
+		return nullLabel
+	}
+
+	switch valType {
+	case cm.Float64TType:
+		return fmt.Sprintf("%.2f", value)
+	case cm.TimestampTType:
+		return value.(time.Time).Format(time.RFC3339Nano)
+	case cm.BytesTType:
+		return fmt.Sprintf("0x%x", value)
+	case cm.JSONTType:
+		return string(value.(json.RawMessage))
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+func isNumeric(valType cm.TabularType) bool {
+	return valType == cm.Int32TType || valType == cm.Int64TType || valType == cm.Float64TType || valType == cm.DecimalTType
+}
+
 func getColumnWidths(t *Table) []int {
 	widths := make([]int, len(t.scheme))
 
@@ -146,12 +302,16 @@ func getColumnWidths(t *Table) []int {
 	}
 
 	for _, row := range t.rows {
+		if row == nil {
+			continue
+		}
+
 		for i, col := range t.scheme {
-			value, err := Deserialize(col.Type, row[i])
+			value, err := col.deserialize(row[i])
 			if err != nil {
 				continue
 			}
-			width := len(fmt.Sprintf("%v", value))
+			width := len(formatValue(col.Type, value))
 			if width > widths[i] {
 				widths[i] = width
 			}
@@ -189,21 +349,25 @@ func PrintTable(t *Table) {
 	printLine()
 
 	for _, row := range t.rows {
+		if row == nil {
+			continue
+		}
+
 		fmt.Print("|")
 		for i, col := range t.scheme {
-			value, err := Deserialize(col.Type, row[i])
+			value, err := col.deserialize(row[i])
 			if err != nil {
 				fmt.Printf(" %-*s |", widths[i], "ERROR")
 				continue
 			}
 
-			switch col.Type {
-			case cm.Float64TType:
-				fmt.Printf(" %*.*f |", widths[i], 2, value)
-			case cm.Int32TType:
-				fmt.Printf(" %*v |", widths[i], value)
+			switch {
+			case value == nil:
+				fmt.Printf(" %-*s |", widths[i], nullLabel)
+			case isNumeric(col.Type):
+				fmt.Printf(" %*s |", widths[i], formatValue(col.Type, value))
 			default:
-				fmt.Printf(" %-*v |", widths[i], value)
+				fmt.Printf(" %-*s |", widths[i], formatValue(col.Type, value))
 			}
 		}
 		fmt.Println()
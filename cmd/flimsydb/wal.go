@@ -0,0 +1,259 @@
+package flimsydb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+type walOp uint8
+
+const (
+	walCreateTable walOp = iota + 1
+	walDeleteTable
+	walInsertRow
+	walUpdateRow
+	walDeleteRow
+	walCheckpoint
+	walCommitTx
+	walCreateIndex
+	walDropIndex
+)
+
+type walColumn struct {
+	Name     string
+	Type     cm.TabularType
+	Default  cm.Blob
+	IdxrType indexer.IndexerType
+	Flags    FlagsType
+	Ref      *Reference `json:",omitempty"`
+
+	Precision int `json:",omitempty"`
+	Scale     int `json:",omitempty"`
+
+	Labels []string `json:",omitempty"`
+}
+
+type walIndex struct {
+	Name     string
+	Columns  []string
+	Path     string              `json:",omitempty"`
+	IdxrType indexer.IndexerType `json:",omitempty"`
+}
+
+type walRecord struct {
+	LSN    uint64 `json:",omitempty"`
+	Op     walOp
+	Table  string
+	Scheme []walColumn `json:",omitempty"`
+	NextID int         `json:",omitempty"`
+	RowID  int         `json:",omitempty"`
+	Row    Row         `json:",omitempty"`
+	Batch  []walRecord `json:",omitempty"`
+
+	Index   *walIndex  `json:",omitempty"`
+	Indexes []walIndex `json:",omitempty"`
+}
+
+/*
+every record is framed as a big-endian uint32 payload length,
+a crc32 of the payload and the json encoded payload itself,
+so a torn write at the tail of the log can be detected and cut off
+*/
+const walHeaderSize = 8
+
+type WAL struct {
+	mu   sync.Mutex
+	file *os.File
+	lsn  uint64
+}
+
+func openWAL(path string) (*WAL, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+
+	return &WAL{file: file}, nil
+}
+
+func writeRecord(dst io.Writer, rec *walRecord) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode log record: %w", err)
+	}
+
+	frame := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[walHeaderSize:], payload)
+
+	if _, err := dst.Write(frame); err != nil {
+		return fmt.Errorf("failed to write log record: %w", err)
+	}
+
+	return nil
+}
+
+var errDamagedRecord = errors.New("damaged record")
+
+/*
+readRecords feeds every intact record to apply and returns the offset
+just past the last one, errDamagedRecord reports where a damaged record starts
+*/
+func readRecords(src io.Reader, apply func(rec *walRecord) error) (int64, error) {
+	reader := bufio.NewReader(src)
+	var offset int64
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, errDamagedRecord
+			}
+			return offset, err
+		}
+
+		payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, errDamagedRecord
+			}
+			return offset, err
+		}
+
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return offset, errDamagedRecord
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return offset, errDamagedRecord
+		}
+
+		if err := apply(&rec); err != nil {
+			return offset, fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+
+		offset += int64(walHeaderSize + len(payload))
+	}
+}
+
+func (w *WAL) append(rec *walRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rec.LSN = w.lsn + 1
+	if err := writeRecord(w.file, rec); err != nil {
+		return err
+	}
+	w.lsn = rec.LSN
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+
+	return nil
+}
+
+/* replay stops at the first damaged record and truncates the log there */
+func (w *WAL) replay(apply func(rec *walRecord) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	offset, err := readRecords(w.file, func(rec *walRecord) error {
+		w.lsn = max(w.lsn, rec.LSN)
+		return apply(rec)
+	})
+	if errors.Is(err, errDamagedRecord) {
+		return w.truncate(offset)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+/* reset drops every record, it is used once a checkpoint made them redundant */
+func (w *WAL) reset() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.truncate(0); err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+func (w *WAL) truncate(offset int64) error {
+	if err := w.file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate write-ahead log: %w", err)
+	}
+
+	_, err := w.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
+
+func schemeToWAL(scheme Scheme) []walColumn {
+	cols := make([]walColumn, len(scheme))
+	for i, col := range scheme {
+		cols[i] = walColumn{
+			Name:     col.Name,
+			Type:     col.Type,
+			Default:  col.Default,
+			IdxrType: col.IdxrType,
+			Flags:    col.Flags,
+			Ref:      col.Ref,
+
+			Precision: col.Precision,
+			Scale:     col.Scale,
+			Labels:    col.Labels,
+		}
+	}
+
+	return cols
+}
+
+func schemeFromWAL(cols []walColumn) Scheme {
+	scheme := make(Scheme, len(cols))
+	for i, c := range cols {
+		scheme[i] = &Column{
+			Name:     c.Name,
+			Type:     c.Type,
+			Default:  c.Default,
+			IdxrType: c.IdxrType,
+			Flags:    c.Flags,
+			Ref:      c.Ref,
+
+			Precision: c.Precision,
+			Scale:     c.Scale,
+			Labels:    c.Labels,
+		}
+	}
+
+	return scheme
+}
@@ -26,12 +26,12 @@ func main() {
 		fmt.Println(err)
 	}
 
-	col4, err := fdb.NewColumn("Position", cm.StringTType, "", indexer.HashMapIndexerType, 0)
+	col4, err := fdb.NewColumn("Position", cm.EnumTType, positions[0], indexer.HashMapIndexerType, 0, fdb.WithEnum(positions...))
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	col5, err := fdb.NewColumn("Department", cm.StringTType, "", indexer.BTreeIndexerType, 0)
+	col5, err := fdb.NewColumn("Department", cm.EnumTType, departments[0], indexer.BTreeIndexerType, 0, fdb.WithEnum(departments...))
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -41,7 +41,7 @@ func main() {
 		fmt.Println(err)
 	}
 
-	col7, err := fdb.NewColumn("Country", cm.StringTType, "", indexer.HashMapIndexerType, 0)
+	col7, err := fdb.NewColumn("Country", cm.EnumTType, countries[0], indexer.HashMapIndexerType, 0, fdb.WithEnum(countries...))
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -61,7 +61,7 @@ func main() {
 			"Country":    randomCountry(),
 		}
 
-		if err := table.InsertRow(row); err != nil {
+		if _, err := table.InsertRow(row); err != nil {
 			fmt.Println("Row adding error:", err)
 		}
 	}
@@ -105,17 +105,20 @@ func randomName() string {
 	return names[rand.Intn(len(names))]
 }
 
+var (
+	positions   = []string{"Engineer", "Manager", "Analyst", "Director", "Consultant", "Developer"}
+	departments = []string{"Finance", "Engineering", "HR", "Sales", "Marketing", "Support"}
+	countries   = []string{"USA", "Germany", "Canada", "UK", "Australia", "India"}
+)
+
 func randomPosition() string {
-	positions := []string{"Engineer", "Manager", "Analyst", "Director", "Consultant", "Developer"}
 	return positions[rand.Intn(len(positions))]
 }
 
 func randomDepartment() string {
-	departments := []string{"Finance", "Engineering", "HR", "Sales", "Marketing", "Support"}
 	return departments[rand.Intn(len(departments))]
 }
 
 func randomCountry() string {
-	countries := []string{"USA", "Germany", "Canada", "UK", "Australia", "India"}
 	return countries[rand.Intn(len(countries))]
 }
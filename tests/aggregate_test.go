@@ -0,0 +1,257 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/* expectedAggregates computes the aggregates of age and score over the rows like the application code would */
+type expectedAggregates struct {
+	rows, ages     int
+	sumAge         int64
+	minAge, maxAge int32
+	sumScore       float64
+	scores         int
+}
+
+func (e *expectedAggregates) add(row []any) {
+	e.rows++
+	if age, ok := row[2].(int32); ok {
+		e.ages++
+		e.sumAge += int64(age)
+		if e.ages == 1 || age < e.minAge {
+			e.minAge = age
+		}
+		if e.ages == 1 || age > e.maxAge {
+			e.maxAge = age
+		}
+	}
+	if score, ok := row[4].(float64); ok {
+		e.scores++
+		e.sumScore += score
+	}
+}
+
+var peopleAggregates = []flimsydb.Aggregate{
+	flimsydb.Count("*").As("rows"),
+	flimsydb.Count("age"),
+	flimsydb.Sum("age"),
+	flimsydb.Min("age"),
+	flimsydb.Max("age"),
+	flimsydb.Avg("score"),
+}
+
+func checkAggregates(t *testing.T, record flimsydb.Record, want *expectedAggregates) {
+	t.Helper()
+
+	if record["rows"] != want.rows || record["count(age)"] != want.ages {
+		t.Errorf("%v: expected %d rows and %d ages", record, want.rows, want.ages)
+	}
+	if want.ages == 0 {
+		if record["sum(age)"] != nil || record["min(age)"] != nil || record["max(age)"] != nil {
+			t.Errorf("%v: expected NULL aggregates", record)
+		}
+		return
+	}
+	if record["sum(age)"] != want.sumAge || record["min(age)"] != want.minAge || record["max(age)"] != want.maxAge {
+		t.Errorf("%v: expected sum %d, min %d and max %d of age", record, want.sumAge, want.minAge, want.maxAge)
+	}
+	if avg, ok := record["avg(score)"].(float64); !ok || math.Abs(avg-want.sumScore/float64(want.scores)) > 1e-9 {
+		t.Errorf("%v: expected average score %v", record, want.sumScore/float64(want.scores))
+	}
+}
+
+func TestAggregateMatchesApplicationCode(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("indexed=%v", indexed), func(t *testing.T) {
+			table := newPeopleTable(t, indexed)
+			all, err := table.GetAll()
+			if err != nil {
+				t.Fatalf("Failed to get rows: %v", err)
+			}
+
+			total := &expectedAggregates{}
+			groups := make(map[[2]any]*expectedAggregates)
+			for _, row := range all {
+				total.add(row)
+				key := [2]any{row[1], row[3]}
+				if groups[key] == nil {
+					groups[key] = &expectedAggregates{}
+				}
+				groups[key].add(row)
+			}
+
+			records, err := table.Query().Aggregate(peopleAggregates...)
+			if err != nil {
+				t.Fatalf("Failed to aggregate: %v", err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("Expected a single record, got %d", len(records))
+			}
+			checkAggregates(t, records[0], total)
+
+			records, err = table.Query().GroupBy("city", "level").Aggregate(peopleAggregates...)
+			if err != nil {
+				t.Fatalf("Failed to aggregate groups: %v", err)
+			}
+			if len(records) != len(groups) {
+				t.Fatalf("Expected %d groups, got %d", len(groups), len(records))
+			}
+			for i, record := range records {
+				want := groups[[2]any{record["city"], record["level"]}]
+				if want == nil {
+					t.Fatalf("Unexpected group %v", record)
+				}
+				checkAggregates(t, record, want)
+
+				/* groups come sorted by their columns, NULL first */
+				if i > 0 {
+					prev := records[i-1]
+					if c := compareNullable[string](prev["city"], record["city"]); c > 0 || c == 0 && compareNullable[int](levelPosition(prev["level"]), levelPosition(record["level"])) >= 0 {
+						t.Fatalf("Groups out of order: %v before %v", prev, record)
+					}
+				}
+			}
+		})
+	}
+}
+
+func levelPosition(level any) any {
+	for i, l := range queryLevels {
+		if l == level {
+			return i
+		}
+	}
+	return nil
+}
+
+func TestAggregateWhereOrderAndLimit(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("indexed=%v", indexed), func(t *testing.T) {
+			table := newPeopleTable(t, indexed)
+
+			/* COUNT(*) of an indexed equality is answered from the index */
+			records, err := table.Query().Where(flimsydb.Eq("level", "senior")).Aggregate(flimsydb.Count("*"))
+			if err != nil {
+				t.Fatalf("Failed to aggregate: %v", err)
+			}
+			if want := len(queryIDs(t, table, flimsydb.Eq("level", "senior"))); records[0]["count(*)"] != want {
+				t.Errorf("Expected %d seniors, got %v", want, records[0])
+			}
+
+			/* COUNT(col) leaves out NULL whether it is answered from the index or not */
+			known, err := table.Query().Select("age").Where(flimsydb.Ne("age", nil)).Limit(1).Rows()
+			if err != nil || len(known) != 1 {
+				t.Fatalf("Failed to get an age: %v, %v", known, err)
+			}
+			for _, pred := range []flimsydb.Predicate{flimsydb.And(), flimsydb.Eq("level", "senior"), flimsydb.Eq("age", known[0][0])} {
+				rows, err := table.Query().Where(pred).Rows()
+				if err != nil {
+					t.Fatalf("Query %v failed: %v", pred, err)
+				}
+				cities, ages := 0, 0
+				for _, row := range rows {
+					if row[1] != nil {
+						cities++
+					}
+					if row[2] != nil {
+						ages++
+					}
+				}
+
+				records, err := table.Query().Where(pred).Aggregate(flimsydb.Count("city"), flimsydb.Count("age"))
+				if err != nil {
+					t.Fatalf("Failed to aggregate: %v", err)
+				}
+				if records[0]["count(city)"] != cities || records[0]["count(age)"] != ages {
+					t.Errorf("%v: expected %d cities and %d ages, got %v", pred, cities, ages, records[0])
+				}
+			}
+			records, err = table.Query().Aggregate(flimsydb.Count("age"))
+			if want := len(queryIDs(t, table, flimsydb.Ne("age", nil))); err != nil || records[0]["count(age)"] != want {
+				t.Errorf("Expected %d ages in the whole table, got %v, %v", want, records, err)
+			}
+
+			records, err = table.Query().
+				Where(flimsydb.Ne("city", nil)).
+				GroupBy("city").
+				OrderBy("city", flimsydb.Desc).
+				Offset(1).
+				Limit(2).
+				Aggregate(flimsydb.Count("*").As("n"))
+			if err != nil {
+				t.Fatalf("Failed to aggregate groups: %v", err)
+			}
+			if len(records) != 2 || records[0]["city"] != "Porto" || records[1]["city"] != "Paris" {
+				t.Fatalf("Expected Porto and Paris, got %v", records)
+			}
+			for _, record := range records {
+				if want := len(queryIDs(t, table, flimsydb.Eq("city", record["city"]))); record["n"] != want {
+					t.Errorf("%v: expected %d rows", record, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateEmptyAndDecimal(t *testing.T) {
+	salary, err := flimsydb.NewColumn("salary", cm.DecimalTType, nil, indexer.BTreeIndexerType, 0, flimsydb.WithDecimal(10, 2))
+	if err != nil {
+		t.Fatalf("Failed to create column: %v", err)
+	}
+	table := flimsydb.NewTable(flimsydb.Scheme{salary})
+	aggs := []flimsydb.Aggregate{flimsydb.Count("*"), flimsydb.Sum("salary"), flimsydb.Min("salary"), flimsydb.Max("salary")}
+
+	records, err := table.Query().Aggregate(aggs...)
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if records[0]["count(*)"] != 0 || records[0]["sum(salary)"] != nil || records[0]["min(salary)"] != nil || records[0]["max(salary)"] != nil {
+		t.Errorf("Unexpected aggregates of an empty table: %v", records[0])
+	}
+
+	for _, s := range []any{"10.25", "-3.50", nil, "100"} {
+		if _, err := table.InsertRow(map[string]any{"salary": s}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	records, err = table.Query().Aggregate(aggs...)
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	want := flimsydb.Record{
+		"count(*)":    4,
+		"sum(salary)": cm.NewDecimal(10675, 2),
+		"min(salary)": cm.NewDecimal(-350, 2),
+		"max(salary)": cm.NewDecimal(10000, 2),
+	}
+	for name, value := range want {
+		if records[0][name] != value {
+			t.Errorf("%s: expected %v, got %v", name, value, records[0][name])
+		}
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	table := newPeopleTable(t, true)
+
+	if _, err := table.Query().Aggregate(flimsydb.Sum("city")); !errors.Is(err, cm.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v", err)
+	}
+	if _, err := table.Query().Aggregate(flimsydb.Max("salary")); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected ErrColumnNotFound, got %v", err)
+	}
+	if _, err := table.Query().GroupBy("salary").Aggregate(flimsydb.Count("*")); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected ErrColumnNotFound for the grouping column, got %v", err)
+	}
+	if _, err := table.Query().GroupBy("city").OrderBy("age", flimsydb.Asc).Aggregate(flimsydb.Count("*")); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for ordering by a column which is not grouped, got %v", err)
+	}
+}
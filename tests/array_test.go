@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+func newUsersWithTags(t *testing.T, db *flimsydb.FlimsyDB, idxrType indexer.IndexerType) *flimsydb.Table {
+	name, err := flimsydb.NewColumn("name", cm.StringTType, nil, indexer.AbsentIndexerType, flimsydb.PrimaryKeyFlag)
+	if err != nil {
+		t.Fatalf("Failed to create column 'name': %v", err)
+	}
+	tags, err := flimsydb.NewColumn("tags", cm.StringArrayTType, []string{}, idxrType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'tags': %v", err)
+	}
+	roles, err := flimsydb.NewColumn("roles", cm.Int32ArrayTType, nil, indexer.AbsentIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'roles': %v", err)
+	}
+	if err := db.CreateTable("users", flimsydb.Scheme{name, tags, roles}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("users")
+
+	for _, values := range []map[string]any{
+		{"name": "alice", "tags": []string{"admin", "dev", "dev"}, "roles": []int32{1, 2}},
+		{"name": "bob", "tags": []string{"dev"}, "roles": []int32{2}},
+		{"name": "carol", "tags": []string{"ops", ""}},
+		{"name": "dave"},
+	} {
+		if _, err := table.InsertRow(values); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	return table
+}
+
+func names(rows [][]any) []string {
+	result := make([]string, len(rows))
+	for i, row := range rows {
+		result[i] = row[0].(string)
+	}
+	slices.Sort(result)
+	return result
+}
+
+func TestArrayColumns(t *testing.T) {
+	for _, idxrType := range []indexer.IndexerType{indexer.AbsentIndexerType, indexer.InvertedIndexerType} {
+		db := flimsydb.NewFlimsyDB()
+		table := newUsersWithTags(t, db, idxrType)
+
+		found, err := table.Find("name", "carol")
+		if err != nil || len(found) != 1 {
+			t.Fatalf("Failed to find carol: %v, %v", found, err)
+		}
+		if values := found[0]; !slices.Equal(values[1].([]string), []string{"ops", ""}) || values[2] != nil {
+			t.Errorf("Expected the arrays to round-trip, got %v", values)
+		}
+
+		for elem, expected := range map[string][]string{
+			"dev":   {"alice", "bob"},
+			"admin": {"alice"},
+			"":      {"carol"},
+			"qa":    {},
+		} {
+			rows, err := table.FindContaining("tags", elem)
+			if err != nil || !slices.Equal(names(rows), expected) {
+				t.Errorf("Expected %v to be tagged %q (indexer %v), got %v, %v", expected, elem, idxrType, names(rows), err)
+			}
+		}
+
+		rows, err := table.FindContaining("roles", int32(2))
+		if err != nil || !slices.Equal(names(rows), []string{"alice", "bob"}) {
+			t.Errorf("Expected alice and bob to have role 2, got %v, %v", rows, err)
+		}
+
+		rows, err = table.Find("tags", []string{})
+		if err != nil || !slices.Equal(names(rows), []string{"dave"}) {
+			t.Errorf("Expected dave to have the default empty array, got %v, %v", rows, err)
+		}
+
+		if err := table.UpdateByPK(map[string]any{"tags": []string{"admin", "ops"}}, "bob"); err != nil {
+			t.Fatalf("Failed to update row: %v", err)
+		}
+		if rows, _ := table.FindContaining("tags", "dev"); !slices.Equal(names(rows), []string{"alice"}) {
+			t.Errorf("Expected only alice to be tagged dev after the update, got %v", names(rows))
+		}
+		if rows, _ := table.FindContaining("tags", "admin"); !slices.Equal(names(rows), []string{"alice", "bob"}) {
+			t.Errorf("Expected alice and bob to be tagged admin after the update, got %v", names(rows))
+		}
+
+		if err := table.DeleteByPK("alice"); err != nil {
+			t.Fatalf("Failed to delete row: %v", err)
+		}
+		if rows, _ := table.FindContaining("tags", "dev"); len(rows) != 0 {
+			t.Errorf("Expected nobody to be tagged dev after the delete, got %v", names(rows))
+		}
+
+		if _, err := table.FindContaining("tags", int32(1)); err == nil {
+			t.Error("Expected an element of the wrong type to be rejected")
+		}
+		if _, err := table.FindContaining("name", "alice"); !errors.Is(err, cm.ErrTypeMismatch) {
+			t.Errorf("Expected ErrTypeMismatch for a non-array column, got %v", err)
+		}
+	}
+
+	if _, err := flimsydb.NewColumn("name", cm.StringTType, nil, indexer.InvertedIndexerType, 0); err == nil {
+		t.Error("Expected an inverted indexer on a string column to be rejected")
+	}
+}
+
+func TestInvertedIndexRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	newUsersWithTags(t, db, indexer.InvertedIndexerType)
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	table, _ := db.GetTable("users")
+	rows, err := table.FindContaining("tags", "dev")
+	if err != nil || !slices.Equal(names(rows), []string{"alice", "bob"}) {
+		t.Errorf("Expected the inverted index to be rebuilt, got %v, %v", rows, err)
+	}
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	if err := db.CreateTable("users", newWALTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("users")
+	for i, name := range []string{"Alice", "Bob", "Carol"} {
+		if _, err := table.InsertRow(map[string]any{"id": int32(i), "name": name}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	if err := db.Checkpoint(); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "wal.log"))
+	if err != nil {
+		t.Fatalf("Failed to stat log: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Expected empty log after checkpoint, got %d bytes", info.Size())
+	}
+
+	if err := table.DeleteRow(0); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	table, err = db.GetTable("users")
+	if err != nil {
+		t.Fatalf("Failed to get restored table: %v", err)
+	}
+
+	rows, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 2 || rows[0][1] != "Bob" {
+		t.Errorf("Unexpected rows after checkpoint and replay: %v", rows)
+	}
+
+	found, err := table.Find("name", "Carol")
+	if err != nil {
+		t.Fatalf("Failed to find by restored index: %v", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("Expected restored index to find Carol, got %v", found)
+	}
+}
+
+func TestCheckpointInterruptedBeforeTruncation(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "wal.log")
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.CreateTable("users", newWALTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("users")
+	if _, err := table.InsertRow(map[string]any{"id": int32(1), "name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	staleLog, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+
+	if err := db.Checkpoint(); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	db.Close()
+
+	if err := os.WriteFile(logPath, staleLog, 0o644); err != nil {
+		t.Fatalf("Failed to restore stale log: %v", err)
+	}
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	table, _ = db.GetTable("users")
+	rows, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Expected log records covered by the snapshot to be skipped, got %d rows", len(rows))
+	}
+}
+
+func TestCheckpointInMemory(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	if err := db.Checkpoint(); !errors.Is(err, cm.ErrNotPersistent) {
+		t.Errorf("Expected ErrNotPersistent, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+func newEmployeesTable(t *testing.T, db *flimsydb.FlimsyDB) *flimsydb.Table {
+	var scheme flimsydb.Scheme
+	for _, def := range []struct {
+		name string
+		typ  cm.TabularType
+	}{
+		{"department", cm.StringTType},
+		{"position", cm.StringTType},
+		{"level", cm.Int32TType},
+	} {
+		col, err := flimsydb.NewColumn(def.name, def.typ, nil, indexer.AbsentIndexerType, 0)
+		if err != nil {
+			t.Fatalf("Failed to create column '%s': %v", def.name, err)
+		}
+		scheme = append(scheme, col)
+	}
+
+	if err := db.CreateTable("employees", scheme); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("employees")
+
+	for _, values := range []map[string]any{
+		{"department": "sales", "position": "manager", "level": int32(3)},
+		{"department": "sales", "position": "clerk", "level": int32(-1)},
+		{"department": "sales", "position": "clerk", "level": int32(2)},
+		{"department": "salesforce", "position": "clerk", "level": int32(1)},
+		{"department": "it", "position": "clerk", "level": int32(1)},
+		{"department": "sales", "position": nil, "level": int32(0)},
+	} {
+		if _, err := table.InsertRow(values); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	return table
+}
+
+func TestCompositeIndex(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	table := newEmployeesTable(t, db)
+
+	if err := table.CreateIndex("by_role", "department", "position", "level"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := table.CreateIndex("by_role", "level"); !errors.Is(err, cm.ErrIndexExists) {
+		t.Errorf("Expected ErrIndexExists, got %v", err)
+	}
+	if err := table.CreateIndex("broken", "salary"); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected ErrColumnNotFound, got %v", err)
+	}
+
+	rows, err := table.FindByIndex("by_role", "sales")
+	if err != nil {
+		t.Fatalf("Failed to find by prefix: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Expected 4 sales rows, got %v", rows)
+	}
+	if rows[0][1] != nil || rows[1][1] != "clerk" || rows[3][1] != "manager" {
+		t.Errorf("Expected rows in index order, got %v", rows)
+	}
+
+	rows, err = table.FindByIndex("by_role", "sales", "clerk")
+	if err != nil {
+		t.Fatalf("Failed to find by prefix: %v", err)
+	}
+	if len(rows) != 2 || rows[0][2] != int32(-1) || rows[1][2] != int32(2) {
+		t.Errorf("Expected clerks ordered by level, got %v", rows)
+	}
+
+	rows, err = table.FindInRangeByIndex("by_role", []any{"sales", "clerk"}, int32(-5), int32(0))
+	if err != nil {
+		t.Fatalf("Failed to find in range: %v", err)
+	}
+	if len(rows) != 1 || rows[0][2] != int32(-1) {
+		t.Errorf("Expected the clerk with a negative level, got %v", rows)
+	}
+
+	rows, err = table.FindInRangeByIndex("by_role", []any{"sales"}, "a", "d")
+	if err != nil {
+		t.Fatalf("Failed to find in range: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Errorf("Expected 2 clerks, got %v", rows)
+	}
+
+	if err := table.UpdateRow(0, map[string]any{"position": "clerk"}); err != nil {
+		t.Fatalf("Failed to update row: %v", err)
+	}
+	if err := table.DeleteRow(1); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	rows, _ = table.FindByIndex("by_role", "sales", "clerk")
+	if len(rows) != 2 || rows[0][2] != int32(2) || rows[1][2] != int32(3) {
+		t.Errorf("Expected the index to follow writes, got %v", rows)
+	}
+
+	if _, err := table.FindByIndex("by_role", "sales", "clerk", int32(1), int32(2)); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for too many values, got %v", err)
+	}
+	if err := table.DropIndex("by_role"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if _, err := table.FindByIndex("by_role", "sales"); !errors.Is(err, cm.ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound, got %v", err)
+	}
+}
+
+func TestCompositeIndexPlanning(t *testing.T) {
+	table := newEmployeesTable(t, flimsydb.NewFlimsyDB())
+	scan := newEmployeesTable(t, flimsydb.NewFlimsyDB())
+	if err := table.CreateIndex("by_role", "department", "position", "level"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	for _, tc := range []struct {
+		pred   flimsydb.Predicate
+		access string
+		rows   int
+	}{
+		/* the columns have no index of their own, so a single leading column uses the composite one */
+		{flimsydb.Eq("department", "sales"), "composite index by_role on 1 column", 4},
+		{flimsydb.Ge("department", "sales"), "composite index by_role with a range on department", 5},
+		{flimsydb.Gt("department", "sales"), "composite index by_role with a range on department", 1},
+		{flimsydb.Lt("department", "sales"), "composite index by_role with a range on department", 1},
+		{flimsydb.And(flimsydb.Eq("department", "sales"), flimsydb.Between("position", "a", "d")), "composite index by_role on 1 column with a range on position", 2},
+		{flimsydb.And(flimsydb.Eq("department", "sales"), flimsydb.Eq("position", "clerk"), flimsydb.Gt("level", int32(-1))), "composite index by_role on 2 columns with a range on level", 1},
+		{flimsydb.And(flimsydb.Eq("department", "sales"), flimsydb.Eq("position", "clerk"), flimsydb.Le("level", int32(2))), "composite index by_role on 2 columns with a range on level", 2},
+		{flimsydb.And(flimsydb.Eq("department", "sales"), flimsydb.Eq("position", "clerk"), flimsydb.Lt("level", int32(2))), "composite index by_role on 2 columns with a range on level", 1},
+		{flimsydb.And(flimsydb.Eq("department", "sales"), flimsydb.Eq("position", "clerk"), flimsydb.Eq("level", int32(2))), "composite index by_role on 3 columns", 1},
+		{flimsydb.Eq("position", "clerk"), "full scan", 4},
+	} {
+		e, err := table.Query().Where(tc.pred).Explain()
+		if err != nil {
+			t.Fatalf("%v: Explain failed: %v", tc.pred, err)
+		}
+		if e.AccessPath != tc.access {
+			t.Errorf("%v: expected access path %q, got %q", tc.pred, tc.access, e.AccessPath)
+		}
+
+		rows, err := table.Query().Where(tc.pred).OrderBy("level", flimsydb.Asc).Rows()
+		if err != nil || len(rows) != tc.rows {
+			t.Errorf("%v: expected %d rows, got %v, %v", tc.pred, tc.rows, rows, err)
+		}
+		want, _ := scan.Query().Where(tc.pred).OrderBy("level", flimsydb.Asc).Rows()
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("%v: expected the rows of a scan %v, got %v", tc.pred, want, rows)
+		}
+	}
+
+	/* an exclusive maximum is filtered again, the other bounds are answered by the index */
+	e, _ := table.Query().Where(flimsydb.And(flimsydb.Eq("department", "sales"), flimsydb.Gt("position", "a"))).Explain()
+	if len(e.Filters) != 0 {
+		t.Errorf("Expected no filters, got %v", e.Filters)
+	}
+	e, _ = table.Query().Where(flimsydb.And(flimsydb.Eq("department", "sales"), flimsydb.Lt("position", "m"))).Explain()
+	if len(e.Filters) != 2 {
+		t.Errorf("Expected the covered conjuncts to be filtered, got %v", e.Filters)
+	}
+
+	q, err := table.Query().
+		Where(flimsydb.And(flimsydb.Eq("department", flimsydb.Param(1)), flimsydb.Ge("position", flimsydb.Param(2)))).
+		Prepare()
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	for _, tc := range []struct {
+		department, position string
+		rows                 int
+	}{{"sales", "clerk", 3}, {"sales", "d", 1}, {"it", "a", 1}, {"salesforce", "d", 0}} {
+		if rows, err := q.Rows(tc.department, tc.position); err != nil || len(rows) != tc.rows {
+			t.Errorf("%s, %s: expected %d rows, got %v, %v", tc.department, tc.position, tc.rows, rows, err)
+		}
+	}
+}
+
+func TestCompositeIndexRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	table := newEmployeesTable(t, db)
+	if err := table.CreateIndex("by_role", "department", "position"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := table.CreateIndex("by_level", "level"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	if err := table.DropIndex("by_level"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	table, _ = db.GetTable("employees")
+	rows, err := table.FindByIndex("by_role", "sales", "clerk")
+	if err != nil {
+		t.Fatalf("Failed to find by restored index: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Errorf("Expected 2 rows, got %v", rows)
+	}
+	if _, err := table.FindByIndex("by_level", int32(1)); !errors.Is(err, cm.ErrIndexNotFound) {
+		t.Errorf("Expected dropped index to stay dropped, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+/* scanAll follows the cursors to the end and returns the ids in scan order */
+func scanAll(t *testing.T, table *flimsydb.Table, col string, opts flimsydb.ScanOptions) []int32 {
+	var ids []int32
+	var cursor flimsydb.Cursor
+	for pages := 0; ; pages++ {
+		if pages > 1000 {
+			t.Fatal("Scan does not terminate")
+		}
+
+		rows, next, err := table.Scan(col, cursor, opts)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if len(rows) > opts.Limit || next != "" && len(rows) != opts.Limit {
+			t.Fatalf("Expected full pages of %d rows before the last one, got %d", opts.Limit, len(rows))
+		}
+		for _, row := range rows {
+			ids = append(ids, row[0].(int32))
+		}
+		if next == "" {
+			return ids
+		}
+		cursor = next
+	}
+}
+
+func TestScanMatchesOrderBy(t *testing.T) {
+	table := newPeopleTable(t, true)
+
+	for _, tc := range []struct {
+		name  string
+		opts  flimsydb.ScanOptions
+		order flimsydb.SortOrder
+		where flimsydb.Predicate
+	}{
+		{"ascending", flimsydb.ScanOptions{Limit: 7}, flimsydb.Asc, nil},
+		{"descending", flimsydb.ScanOptions{Limit: 7, Order: flimsydb.Desc}, flimsydb.Desc, nil},
+		{"filtered", flimsydb.ScanOptions{Limit: 4, Where: flimsydb.Eq("level", "junior")}, flimsydb.Asc, flimsydb.Eq("level", "junior")},
+		{"one row per page", flimsydb.ScanOptions{Limit: 1, Order: flimsydb.Desc, Where: flimsydb.Like("city", "B%")}, flimsydb.Desc, flimsydb.Like("city", "B%")},
+		{"single page", flimsydb.ScanOptions{Limit: 1000}, flimsydb.Asc, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q := table.Query().OrderBy("age", tc.order)
+			if tc.where != nil {
+				q = q.Where(tc.where)
+			}
+
+			want := orderedIDs(t, q)
+			if got := scanAll(t, table, "age", tc.opts); !slices.Equal(got, want) {
+				t.Errorf("Expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestScanIsStableUnderWrites(t *testing.T) {
+	table := newPeopleTable(t, true)
+	before, _ := table.GetAll()
+
+	opts := flimsydb.ScanOptions{Limit: 10, Where: flimsydb.Ne("age", nil)}
+	seen := make(map[int32]int)
+	var rows [][]any
+	var cursor flimsydb.Cursor
+	var err error
+	for range 5 {
+		if rows, cursor, err = table.Scan("age", cursor, opts); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		for _, row := range rows {
+			seen[row[0].(int32)]++
+		}
+	}
+	lastAge := rows[len(rows)-1][2]
+	if lastAge == int32(18) {
+		t.Fatal("Expected the first pages to get past the youngest age")
+	}
+
+	/* rows with the same key as the cursor, before it and after it */
+	for i, age := range []any{lastAge, int32(18), int32(67), nil} {
+		if _, err := table.InsertRow(map[string]any{"id": int32(1000 + i), "age": age}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+	deleted, _ := table.Query().Where(flimsydb.Eq("age", int32(66))).Rows()
+	for _, row := range deleted {
+		if err := table.DeleteByPK(row[0]); err != nil {
+			t.Fatalf("Failed to delete row: %v", err)
+		}
+	}
+
+	for cursor != "" {
+		if rows, cursor, err = table.Scan("age", cursor, opts); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		for _, row := range rows {
+			seen[row[0].(int32)]++
+		}
+	}
+
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("Row %d was returned %d times", id, n)
+		}
+	}
+	for _, row := range before {
+		id := row[0].(int32)
+		if row[2] == nil {
+			continue
+		}
+		wasDeleted := slices.ContainsFunc(deleted, func(d []any) bool { return d[0] == id })
+		if _, found := seen[id]; found == wasDeleted {
+			t.Errorf("Row %d: expected to be seen %v, deleted %v", id, !wasDeleted, wasDeleted)
+		}
+	}
+	for _, id := range []int32{1000, 1002} {
+		if seen[id] != 1 {
+			t.Errorf("Expected row %d inserted after the cursor to be returned", id)
+		}
+	}
+	if seen[1001] != 0 || seen[1003] != 0 {
+		t.Error("Expected rows inserted before the cursor not to be returned")
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	table := newPeopleTable(t, true)
+
+	if _, _, err := table.Scan("score", "", flimsydb.ScanOptions{Limit: 5}); !errors.Is(err, cm.ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound for a column without a B-tree, got %v", err)
+	}
+	if _, _, err := table.Scan("age", "", flimsydb.ScanOptions{}); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a zero limit to be rejected, got %v", err)
+	}
+	if _, _, err := table.Scan("age", "not a cursor!", flimsydb.ScanOptions{Limit: 5}); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a malformed cursor to be rejected, got %v", err)
+	}
+
+	_, cursor, err := table.Scan("age", "", flimsydb.ScanOptions{Limit: 5})
+	if err != nil || cursor == "" {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if _, _, err := table.Scan("city", cursor, flimsydb.ScanOptions{Limit: 5}); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a cursor of another column to be rejected, got %v", err)
+	}
+	if _, _, err := table.Scan("age", cursor, flimsydb.ScanOptions{Limit: 5, Order: flimsydb.Desc}); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a cursor of another order to be rejected, got %v", err)
+	}
+	if _, _, err := table.Scan("age", cursor[:len(cursor)-2], flimsydb.ScanOptions{Limit: 5}); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a truncated cursor to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+func newSalaryTable(t *testing.T) *flimsydb.Table {
+	name, err := flimsydb.NewColumn("name", cm.StringTType, nil, indexer.AbsentIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'name': %v", err)
+	}
+	salary, err := flimsydb.NewColumn("salary", cm.DecimalTType, "0", indexer.BTreeIndexerType, 0, flimsydb.WithDecimal(10, 2))
+	if err != nil {
+		t.Fatalf("Failed to create column 'salary': %v", err)
+	}
+
+	return flimsydb.NewTable(flimsydb.Scheme{name, salary})
+}
+
+func TestDecimalColumnOptions(t *testing.T) {
+	if _, err := flimsydb.NewColumn("salary", cm.DecimalTType, nil, indexer.AbsentIndexerType, 0); err == nil {
+		t.Error("Expected a decimal column without precision to be rejected")
+	}
+	if _, err := flimsydb.NewColumn("salary", cm.DecimalTType, nil, indexer.AbsentIndexerType, 0, flimsydb.WithDecimal(4, 5)); err == nil {
+		t.Error("Expected a scale above the precision to be rejected")
+	}
+	if _, err := flimsydb.NewColumn("salary", cm.Int32TType, nil, indexer.AbsentIndexerType, 0, flimsydb.WithDecimal(4, 2)); err == nil {
+		t.Error("Expected precision on a non-decimal column to be rejected")
+	}
+	if _, err := flimsydb.NewColumn("salary", cm.DecimalTType, "1.234", indexer.AbsentIndexerType, 0, flimsydb.WithDecimal(4, 2)); err == nil {
+		t.Error("Expected a default that needs rounding to be rejected")
+	}
+}
+
+func TestDecimalValues(t *testing.T) {
+	table := newSalaryTable(t)
+
+	for _, values := range []map[string]any{
+		{"name": "Alice", "salary": "1234.5"},
+		{"name": "Bob", "salary": int64(-20)},
+		{"name": "Carol", "salary": cm.NewDecimal(19990, 3)},
+		{"name": "Dave", "salary": "0.10"},
+		{"name": "Eve"},
+	} {
+		if _, err := table.InsertRow(values); err != nil {
+			t.Fatalf("Failed to insert %v: %v", values, err)
+		}
+	}
+
+	invalid := []any{"1.005", "123456789.00", float64(1.5), "12a"}
+	for _, v := range invalid {
+		if _, err := table.InsertRow(map[string]any{"name": "Mallory", "salary": v}); err == nil {
+			t.Errorf("Expected %v to be rejected", v)
+		}
+	}
+
+	rows, err := table.FindInRange("salary", "-100", "1")
+	if err != nil {
+		t.Fatalf("Failed to find range: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 salaries in range, got %v", rows)
+	}
+	if got := []string{rows[0][1].(cm.Decimal).String(), rows[1][1].(cm.Decimal).String(), rows[2][1].(cm.Decimal).String()}; got[0] != "-20.00" || got[1] != "0.00" || got[2] != "0.10" {
+		t.Errorf("Unexpected ordered salaries %v", got)
+	}
+
+	found, err := table.Find("salary", "1234.50")
+	if err != nil || len(found) != 1 || found[0][0] != "Alice" {
+		t.Errorf("Expected to find Alice by an equal decimal, got %v, %v", found, err)
+	}
+
+	flimsydb.PrintTable(table)
+}
+
+func TestDecimalString(t *testing.T) {
+	tests := map[cm.Decimal]string{
+		cm.NewDecimal(0, 2):      "0.00",
+		cm.NewDecimal(5, 2):      "0.05",
+		cm.NewDecimal(-5, 2):     "-0.05",
+		cm.NewDecimal(123456, 2): "1234.56",
+		cm.NewDecimal(-7, 0):     "-7",
+	}
+	for d, want := range tests {
+		if got := d.String(); got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+
+	d, err := cm.ParseDecimal("-0.30")
+	if err != nil || d != cm.NewDecimal(-30, 2) {
+		t.Errorf("Unexpected parsed decimal %v, %v", d, err)
+	}
+	if _, err := cm.ParseDecimal("99999999999999999999"); err == nil {
+		t.Error("Expected overflow to be reported")
+	}
+}
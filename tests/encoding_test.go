@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"bytes"
+	"cmp"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/* every TabularType comes with a generator biased towards edge cases and the order of its values */
+type encodingCase struct {
+	name     string
+	typ      cm.TabularType
+	generate func(r *rand.Rand) any
+	compare  func(a, b any) int
+	options  []flimsydb.ColumnOption
+}
+
+func pick[T any](r *rand.Rand, edges []T, random func() T) T {
+	if r.Intn(3) == 0 {
+		return edges[r.Intn(len(edges))]
+	}
+	return random()
+}
+
+func randomString(r *rand.Rand) string {
+	alphabet := []byte{0x00, 0x01, 'a', 'b', 0xfe, 0xff}
+	b := make([]byte, r.Intn(6))
+	for i := range b {
+		b[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+var encodingCases = []encodingCase{
+	{
+		name: "int32",
+		typ:  cm.Int32TType,
+		generate: func(r *rand.Rand) any {
+			return pick(r, []int32{math.MinInt32, -256, -1, 0, 1, 255, math.MaxInt32}, func() int32 { return int32(r.Uint32()) })
+		},
+		compare: func(a, b any) int { return cmp.Compare(a.(int32), b.(int32)) },
+	},
+	{
+		name: "float64",
+		typ:  cm.Float64TType,
+		generate: func(r *rand.Rand) any {
+			edges := []float64{math.Inf(-1), -math.MaxFloat64, -1, -math.SmallestNonzeroFloat64, 0, math.SmallestNonzeroFloat64, 1, math.MaxFloat64, math.Inf(1)}
+			return pick(r, edges, func() float64 { return r.NormFloat64() * math.Pow(10, float64(r.Intn(40)-20)) })
+		},
+		compare: func(a, b any) int { return cmp.Compare(a.(float64), b.(float64)) },
+	},
+	{
+		name: "string",
+		typ:  cm.StringTType,
+		generate: func(r *rand.Rand) any {
+			return pick(r, []string{"", "\x00", "a", "a\x00", "ab", "b"}, func() string { return randomString(r) })
+		},
+		compare: func(a, b any) int { return strings.Compare(a.(string), b.(string)) },
+	},
+	{
+		name: "int64",
+		typ:  cm.Int64TType,
+		generate: func(r *rand.Rand) any {
+			return pick(r, []int64{math.MinInt64, math.MinInt32 - 1, -1, 0, 1, math.MaxInt32 + 1, math.MaxInt64}, func() int64 { return int64(r.Uint64()) })
+		},
+		compare: func(a, b any) int { return cmp.Compare(a.(int64), b.(int64)) },
+	},
+	{
+		name: "bool",
+		typ:  cm.BoolTType,
+		generate: func(r *rand.Rand) any {
+			return r.Intn(2) == 0
+		},
+		compare: func(a, b any) int {
+			toInt := func(v bool) int {
+				if v {
+					return 1
+				}
+				return 0
+			}
+			return cmp.Compare(toInt(a.(bool)), toInt(b.(bool)))
+		},
+	},
+	{
+		name: "timestamp",
+		typ:  cm.TimestampTType,
+		generate: func(r *rand.Rand) any {
+			edges := []time.Time{time.Unix(0, math.MinInt64), time.Unix(0, -1), time.Unix(0, 0), time.Unix(0, math.MaxInt64)}
+			return pick(r, edges, func() time.Time { return time.Unix(0, int64(r.Uint64())) })
+		},
+		compare: func(a, b any) int { return a.(time.Time).Compare(b.(time.Time)) },
+	},
+	{
+		name: "bytes",
+		typ:  cm.BytesTType,
+		generate: func(r *rand.Rand) any {
+			return pick(r, [][]byte{{}, {0x00}, {0x00, 0x00}, {0xff}}, func() []byte { return []byte(randomString(r)) })
+		},
+		compare: func(a, b any) int { return bytes.Compare(a.([]byte), b.([]byte)) },
+	},
+	{
+		name: "decimal",
+		typ:  cm.DecimalTType,
+		generate: func(r *rand.Rand) any {
+			const limit = 999_999_999_999_999_999
+			edges := []int64{-limit, -100, -1, 0, 1, 100, limit}
+			return cm.NewDecimal(pick(r, edges, func() int64 { return (int64(r.Uint64()) >> r.Intn(64)) % limit }), 2)
+		},
+		compare: func(a, b any) int { return cmp.Compare(a.(cm.Decimal).Unscaled, b.(cm.Decimal).Unscaled) },
+		options: []flimsydb.ColumnOption{flimsydb.WithDecimal(cm.MaxDecimalPrecision, 2)},
+	},
+	{
+		name: "string array",
+		typ:  cm.StringArrayTType,
+		generate: func(r *rand.Rand) any {
+			v := make([]string, r.Intn(4))
+			for i := range v {
+				v[i] = randomString(r)
+			}
+			return v
+		},
+		/* arrays sort by length first */
+		compare: func(a, b any) int {
+			x, y := a.([]string), b.([]string)
+			return cmp.Or(cmp.Compare(len(x), len(y)), slices.Compare(x, y))
+		},
+	},
+}
+
+func sign(n int) int {
+	return cmp.Compare(n, 0)
+}
+
+func TestEncodingPreservesOrder(t *testing.T) {
+	for _, tc := range encodingCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &quick.Config{
+				MaxCount: 5000,
+				Values: func(args []reflect.Value, r *rand.Rand) {
+					args[0] = reflect.ValueOf(tc.generate(r))
+					args[1] = reflect.ValueOf(tc.generate(r))
+				},
+			}
+
+			property := func(a, b any) bool {
+				blobA, errA := flimsydb.Serialize(tc.typ, a)
+				blobB, errB := flimsydb.Serialize(tc.typ, b)
+				if errA != nil || errB != nil || cm.IsNull(blobA) || cm.IsNull(blobB) {
+					return false
+				}
+
+				compareFunc := cm.GetCompareFunc(tc.typ)
+				return sign(bytes.Compare(blobA, blobB)) == sign(tc.compare(a, b)) &&
+					sign(compareFunc(blobA, blobB)) == sign(tc.compare(a, b)) &&
+					compareFunc(nil, blobA) < 0
+			}
+
+			if err := quick.Check(property, config); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	for _, tc := range encodingCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &quick.Config{
+				MaxCount: 5000,
+				Values: func(args []reflect.Value, r *rand.Rand) {
+					args[0] = reflect.ValueOf(tc.generate(r))
+				},
+			}
+
+			property := func(v any) bool {
+				blob, err := flimsydb.Serialize(tc.typ, v)
+				if err != nil {
+					return false
+				}
+				decoded, err := flimsydb.Deserialize(tc.typ, blob)
+				return err == nil && tc.compare(v, decoded) == 0
+			}
+
+			if err := quick.Check(property, config); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestBTreeRangeMatchesScan(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+
+	for _, tc := range encodingCases {
+		t.Run(tc.name, func(t *testing.T) {
+			col, err := flimsydb.NewColumn("value", tc.typ, nil, indexer.BTreeIndexerType, 0, tc.options...)
+			if err != nil {
+				t.Fatalf("Failed to create column: %v", err)
+			}
+			table := flimsydb.NewTable(flimsydb.Scheme{col})
+
+			values := make([]any, 300)
+			for i := range values {
+				values[i] = tc.generate(r)
+				if _, err := table.InsertRow(map[string]any{"value": values[i]}); err != nil {
+					t.Fatalf("Failed to insert row: %v", err)
+				}
+			}
+
+			for i := 0; i < 50; i++ {
+				lo, hi := tc.generate(r), tc.generate(r)
+				if tc.compare(lo, hi) > 0 {
+					lo, hi = hi, lo
+				}
+
+				var want []any
+				for _, v := range values {
+					if tc.compare(v, lo) >= 0 && tc.compare(v, hi) <= 0 {
+						want = append(want, v)
+					}
+				}
+				sort.Slice(want, func(i, j int) bool { return tc.compare(want[i], want[j]) < 0 })
+
+				found, err := table.FindInRange("value", lo, hi)
+				if err != nil {
+					t.Fatalf("Failed to find range: %v", err)
+				}
+				if len(found) != len(want) {
+					t.Fatalf("Range [%v, %v]: expected %d rows, got %d", lo, hi, len(want), len(found))
+				}
+				for j, row := range found {
+					if tc.compare(row[0], want[j]) != 0 {
+						t.Fatalf("Range [%v, %v]: expected %v at %d, got %v", lo, hi, want[j], j, row[0])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+var priorities = []string{"low", "medium", "high", "critical"}
+
+func newTicketsTable(t *testing.T, db *flimsydb.FlimsyDB) *flimsydb.Table {
+	title, err := flimsydb.NewColumn("title", cm.StringTType, nil, indexer.AbsentIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'title': %v", err)
+	}
+	priority, err := flimsydb.NewColumn("priority", cm.EnumTType, "medium", indexer.BTreeIndexerType, 0, flimsydb.WithEnum(priorities...))
+	if err != nil {
+		t.Fatalf("Failed to create column 'priority': %v", err)
+	}
+	if err := db.CreateTable("tickets", flimsydb.Scheme{title, priority}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("tickets")
+
+	for _, values := range []map[string]any{
+		{"title": "outage", "priority": "critical"},
+		{"title": "typo", "priority": "low"},
+		{"title": "slow page"},
+		{"title": "data loss", "priority": "high"},
+		{"title": "unsorted", "priority": nil},
+	} {
+		if _, err := table.InsertRow(values); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	return table
+}
+
+func titles(rows [][]any) []string {
+	result := make([]string, len(rows))
+	for i, row := range rows {
+		result[i] = row[0].(string)
+	}
+	return result
+}
+
+func TestEnumColumn(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	table := newTicketsTable(t, db)
+
+	if _, err := table.InsertRow(map[string]any{"title": "bad", "priority": "urgent"}); !errors.Is(err, cm.ErrTypeMismatch) {
+		t.Errorf("Expected an unknown label to be rejected with ErrTypeMismatch, got %v", err)
+	}
+	if _, err := table.Find("priority", "urgent"); err == nil {
+		t.Error("Expected a lookup of an unknown label to fail")
+	}
+
+	row, err := table.GetRow(2)
+	if err != nil {
+		t.Fatalf("Failed to get row: %v", err)
+	}
+	if len(row[1]) != 2 {
+		t.Errorf("Expected an enum value to take 2 bytes, got %d", len(row[1]))
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	table, _ = db.GetTable("tickets")
+
+	rows, err := table.Find("priority", "medium")
+	if err != nil || !slices.Equal(titles(rows), []string{"slow page"}) {
+		t.Errorf("Expected the default label after reopening, got %v, %v", rows, err)
+	}
+
+	/* declaration order, not alphabetical order */
+	rows, err = table.FindInRange("priority", "medium", "critical")
+	if err != nil {
+		t.Fatalf("Failed to find in range: %v", err)
+	}
+	if got := titles(rows); !slices.Equal(got, []string{"slow page", "data loss", "outage"}) {
+		t.Errorf("Expected the tickets from medium to critical in declaration order, got %v", got)
+	}
+
+	rows, _ = table.Find("priority", nil)
+	if !slices.Equal(titles(rows), []string{"unsorted"}) {
+		t.Errorf("Expected NULL to be allowed, got %v", rows)
+	}
+}
+
+func TestEnumColumnDefinition(t *testing.T) {
+	for name, def := range map[string]struct {
+		defaultVal any
+		opts       []flimsydb.ColumnOption
+	}{
+		"no labels":          {nil, nil},
+		"duplicate labels":   {nil, []flimsydb.ColumnOption{flimsydb.WithEnum("a", "b", "a")}},
+		"unknown default":    {"c", []flimsydb.ColumnOption{flimsydb.WithEnum("a", "b")}},
+		"non-string default": {int32(1), []flimsydb.ColumnOption{flimsydb.WithEnum("a", "b")}},
+	} {
+		if _, err := flimsydb.NewColumn("col", cm.EnumTType, def.defaultVal, indexer.AbsentIndexerType, 0, def.opts...); err == nil {
+			t.Errorf("%s: expected the enum column to be rejected", name)
+		}
+	}
+
+	if _, err := flimsydb.NewColumn("col", cm.StringTType, nil, indexer.AbsentIndexerType, 0, flimsydb.WithEnum("a")); err == nil {
+		t.Error("Expected labels on a string column to be rejected")
+	}
+}
@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+func explainOperations(e *flimsydb.Explanation) []string {
+	operations := make([]string, len(e.Steps))
+	for i, step := range e.Steps {
+		operations[i] = step.Operation
+	}
+	return operations
+}
+
+func TestExplain(t *testing.T) {
+	db := newSQLDB(t)
+	table, err := db.GetTable("employees")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		query      *flimsydb.Query
+		access     string
+		considered []string
+		filters    []string
+		operations []string
+	}{
+		{
+			name:       "hash lookup",
+			query:      table.Query().Where(flimsydb.Eq("name", "Alice")),
+			access:     "hash index on name",
+			considered: []string{"hash index on name"},
+			operations: []string{"index lookup"},
+		},
+		{
+			name:       "primary key",
+			query:      table.Query().Where(flimsydb.Eq("id", int32(2))),
+			access:     "primary key",
+			considered: []string{"primary key"},
+			operations: []string{"index lookup"},
+		},
+		{
+			name:       "column without an index",
+			query:      table.Query().Where(flimsydb.Eq("level", "junior")),
+			access:     "full scan",
+			filters:    []string{`level = "junior"`},
+			operations: []string{"full scan", "filter"},
+		},
+		{
+			/* a hash index cannot answer a range, like FindInRange */
+			name:       "range on a hash index",
+			query:      table.Query().Where(flimsydb.Between("name", "A", "C")),
+			access:     "full scan",
+			filters:    []string{`name BETWEEN "A" AND "C"`},
+			operations: []string{"full scan", "filter"},
+		},
+		{
+			name:       "index and filter",
+			query:      table.Query().Where(flimsydb.And(flimsydb.Eq("name", "Alice"), flimsydb.Gt("age", int32(30)), flimsydb.IsNull("hired"))),
+			access:     "intersection of (hash index on name, B-tree index on age)",
+			considered: []string{"hash index on name", "B-tree index on age"},
+			filters:    []string{"hired IS NULL"},
+			operations: []string{"index lookup", "filter"},
+		},
+		{
+			name:       "union",
+			query:      table.Query().Where(flimsydb.Or(flimsydb.Eq("name", "Bob"), flimsydb.Le("age", int32(30)))).OrderBy("name", flimsydb.Asc),
+			access:     "union of (hash index on name, B-tree index on age)",
+			considered: []string{"hash index on name", "B-tree index on age"},
+			operations: []string{"index lookup", "sort"},
+		},
+		{
+			name:       "ordered walk",
+			query:      table.Query().OrderBy("age", flimsydb.Desc).Limit(2).Offset(1),
+			access:     "B-tree index on age walked in descending order",
+			considered: []string{"B-tree index on age"},
+			operations: []string{"index walk", "limit"},
+		},
+	} {
+		e, err := tc.query.Explain()
+		if err != nil {
+			t.Fatalf("%s: Explain failed: %v", tc.name, err)
+		}
+		if e.AccessPath != tc.access {
+			t.Errorf("%s: expected access path %q, got %q", tc.name, tc.access, e.AccessPath)
+		}
+		if !reflect.DeepEqual(e.IndexesConsidered, tc.considered) {
+			t.Errorf("%s: expected indexes %v, got %v", tc.name, tc.considered, e.IndexesConsidered)
+		}
+		if !reflect.DeepEqual(e.Filters, tc.filters) {
+			t.Errorf("%s: expected filters %v, got %v", tc.name, tc.filters, e.Filters)
+		}
+		if got := explainOperations(e); !reflect.DeepEqual(got, tc.operations) {
+			t.Errorf("%s: expected steps %v, got %v", tc.name, tc.operations, got)
+		}
+		if e.Analyzed || e.ActualRows != 0 {
+			t.Errorf("%s: expected no actual counts without analyzing, got %+v", tc.name, e)
+		}
+	}
+
+	e, err := table.Query().Where(flimsydb.Eq("id", int32(1))).Explain()
+	if err != nil || e.EstimatedRows != 1 {
+		t.Errorf("Expected one row estimated for a primary key lookup, got %v, %v", e, err)
+	}
+	if _, err := table.Query().Where(flimsydb.Eq("nickname", "x")).Explain(); err == nil {
+		t.Errorf("Expected an unknown column to be reported, got %v", err)
+	}
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	db := newSQLDB(t)
+	table, err := db.GetTable("employees")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+
+	query := table.Query().Where(flimsydb.Ne("level", "senior")).OrderBy("name", flimsydb.Desc).Limit(2)
+	e, err := query.ExplainAnalyze()
+	if err != nil {
+		t.Fatalf("ExplainAnalyze failed: %v", err)
+	}
+	if !e.Analyzed {
+		t.Errorf("Expected the explanation to be analyzed")
+	}
+
+	want := []struct {
+		operation string
+		actual    int
+	}{{"full scan", 4}, {"filter", 3}, {"sort", 3}, {"limit", 2}}
+	if len(e.Steps) != len(want) {
+		t.Fatalf("Expected %d steps, got %+v", len(want), e.Steps)
+	}
+	for i, step := range e.Steps {
+		if step.Operation != want[i].operation || step.ActualRows != want[i].actual {
+			t.Errorf("Step %d: expected %s with %d rows, got %+v", i+1, want[i].operation, want[i].actual, step)
+		}
+		if step.Duration < 0 || step.Duration > e.Duration {
+			t.Errorf("Step %d: unexpected duration %v of %v", i+1, step.Duration, e.Duration)
+		}
+	}
+	if e.Steps[1].Detail != `level != "senior"` || e.Steps[2].Detail != "name DESC" || e.Steps[3].Detail != "limit 2 offset 0" {
+		t.Errorf("Unexpected step details %+v", e.Steps)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		t.Fatalf("Rows failed: %v", err)
+	}
+	if e.ActualRows != len(rows) {
+		t.Errorf("Expected %d actual rows, got %d", len(rows), e.ActualRows)
+	}
+
+	e, err = table.Query().OrderBy("age", flimsydb.Asc).Limit(1).Offset(1).ExplainAnalyze()
+	if err != nil {
+		t.Fatalf("ExplainAnalyze failed: %v", err)
+	}
+	/* the walk stops as soon as the page is full */
+	if e.Steps[0].ActualRows != 2 || e.ActualRows != 1 {
+		t.Errorf("Unexpected counts %+v", e.Steps)
+	}
+}
+
+func TestSQLExplain(t *testing.T) {
+	db := newSQLDB(t)
+
+	rs := mustQuery(t, db, "EXPLAIN SELECT name FROM employees WHERE name = ? AND level = 'senior'", "Alice")
+	if !reflect.DeepEqual(rs.Columns, []string{"plan"}) {
+		t.Errorf("Unexpected columns %v", rs.Columns)
+	}
+	want := [][]any{
+		{"access path: hash index on name (estimated 1 rows)"},
+		{"indexes considered: hash index on name"},
+		{`filters: level = "senior"`},
+		{"1. index lookup: hash index on name (estimated 1 rows)"},
+		{`2. filter: level = "senior" (estimated 1 rows)`},
+	}
+	if !reflect.DeepEqual(rs.Rows, want) {
+		t.Errorf("Expected %v, got %v", want, rs.Rows)
+	}
+
+	rs = mustQuery(t, db, "explain analyze select * from employees where level = 'junior' order by id limit 5")
+	lines := make([]string, len(rs.Rows))
+	for i, row := range rs.Rows {
+		lines[i] = row[0].(string)
+	}
+	if !strings.HasPrefix(lines[3], "1. full scan: table employees (estimated 4 rows, actual 4 rows in ") ||
+		!strings.HasPrefix(lines[4], `2. filter: level = "junior" (estimated 2 rows, actual 2 rows in `) ||
+		!strings.HasPrefix(lines[len(lines)-1], "total: 2 rows in ") {
+		t.Errorf("Unexpected plan\n%s", strings.Join(lines, "\n"))
+	}
+
+	if _, err := db.Query("EXPLAIN DELETE FROM employees"); !errors.Is(err, cm.ErrSyntax) {
+		t.Errorf("Expected only queries to be explained, got %v", err)
+	}
+	if _, err := db.Exec("EXPLAIN SELECT name FROM employees"); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected Exec to refuse EXPLAIN, got %v", err)
+	}
+	if _, err := db.Query("EXPLAIN SELECT nickname FROM employees"); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected an unknown column to be reported, got %v", err)
+	}
+}
@@ -116,7 +116,7 @@ func TestDataOperations(t *testing.T) {
 	}
 
 	for _, data := range testData {
-		err := table.InsertRow(data)
+		_, err := table.InsertRow(data)
 		if err != nil {
 			t.Errorf("Failed to insert data: %v", err)
 		}
@@ -199,7 +199,7 @@ func TestErrorCases(t *testing.T) {
 			"name": "valid string",
 		}
 
-		err := table.InsertRow(invalidData)
+		_, err := table.InsertRow(invalidData)
 		if err == nil {
 			t.Error("Expected error when inserting invalid data type")
 		}
@@ -211,7 +211,7 @@ func TestErrorCases(t *testing.T) {
 			"nonexistent": "value",
 		}
 
-		err := table.InsertRow(invalidData)
+		_, err := table.InsertRow(invalidData)
 		if err == nil {
 			t.Error("Expected error when inserting data with invalid column name")
 		}
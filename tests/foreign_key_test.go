@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/* customers are referenced by orders with the given action and by notes with SET NULL */
+func newForeignKeyTestDB(t *testing.T, db *flimsydb.FlimsyDB, onDelete flimsydb.ReferenceAction) {
+	id, err := flimsydb.NewColumn("id", cm.Int32TType, int32(0), indexer.HashMapIndexerType, flimsydb.PrimaryKeyFlag)
+	if err != nil {
+		t.Fatalf("Failed to create column 'id': %v", err)
+	}
+	name, err := flimsydb.NewColumn("name", cm.StringTType, "", indexer.AbsentIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'name': %v", err)
+	}
+	if err := db.CreateTable("customers", flimsydb.Scheme{id, name}); err != nil {
+		t.Fatalf("Failed to create table customers: %v", err)
+	}
+
+	customer, err := flimsydb.NewColumn("customer", cm.Int32TType, int32(0), indexer.HashMapIndexerType, 0,
+		flimsydb.WithReference("customers", "id", onDelete))
+	if err != nil {
+		t.Fatalf("Failed to create column 'customer': %v", err)
+	}
+	item, err := flimsydb.NewColumn("item", cm.StringTType, "", indexer.AbsentIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'item': %v", err)
+	}
+	if err := db.CreateTable("orders", flimsydb.Scheme{customer, item}); err != nil {
+		t.Fatalf("Failed to create table orders: %v", err)
+	}
+
+	author, err := flimsydb.NewColumn("author", cm.Int32TType, nil, indexer.AbsentIndexerType, 0,
+		flimsydb.WithReference("customers", "id", flimsydb.SetNullAction))
+	if err != nil {
+		t.Fatalf("Failed to create column 'author': %v", err)
+	}
+	if err := db.CreateTable("notes", flimsydb.Scheme{author}); err != nil {
+		t.Fatalf("Failed to create table notes: %v", err)
+	}
+}
+
+func insertCustomers(t *testing.T, db *flimsydb.FlimsyDB) {
+	customers, _ := db.GetTable("customers")
+	for i, name := range []string{"Alice", "Bob"} {
+		if _, err := customers.InsertRow(map[string]any{"id": int32(i + 1), "name": name}); err != nil {
+			t.Fatalf("Failed to insert customer: %v", err)
+		}
+	}
+}
+
+func TestForeignKeyReferenceValidation(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	newForeignKeyTestDB(t, db, flimsydb.RestrictAction)
+
+	missingTable, _ := flimsydb.NewColumn("ref", cm.Int32TType, int32(0), indexer.AbsentIndexerType, 0,
+		flimsydb.WithReference("vendors", "id", flimsydb.RestrictAction))
+	if err := db.CreateTable("invoices", flimsydb.Scheme{missingTable}); !errors.Is(err, cm.ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+
+	notUnique, _ := flimsydb.NewColumn("ref", cm.StringTType, "", indexer.AbsentIndexerType, 0,
+		flimsydb.WithReference("customers", "name", flimsydb.RestrictAction))
+	if err := db.CreateTable("invoices", flimsydb.Scheme{notUnique}); !errors.Is(err, cm.ErrInvalidReference) {
+		t.Errorf("Expected ErrInvalidReference, got %v", err)
+	}
+
+	wrongType, _ := flimsydb.NewColumn("ref", cm.StringTType, "", indexer.AbsentIndexerType, 0,
+		flimsydb.WithReference("customers", "id", flimsydb.RestrictAction))
+	if err := db.CreateTable("invoices", flimsydb.Scheme{wrongType}); !errors.Is(err, cm.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v", err)
+	}
+
+	if _, err := flimsydb.NewColumn("ref", cm.Int32TType, int32(0), indexer.AbsentIndexerType, flimsydb.NotNullFlag,
+		flimsydb.WithReference("customers", "id", flimsydb.SetNullAction)); err == nil {
+		t.Error("Expected a not null column with the set null action to be rejected")
+	}
+
+	if err := db.DeleteTable("customers"); !errors.Is(err, cm.ErrTableReferenced) {
+		t.Errorf("Expected ErrTableReferenced, got %v", err)
+	}
+}
+
+func TestForeignKeyInsertAndUpdate(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	newForeignKeyTestDB(t, db, flimsydb.RestrictAction)
+	insertCustomers(t, db)
+
+	orders, _ := db.GetTable("orders")
+	if _, err := orders.InsertRow(map[string]any{"customer": int32(3), "item": "book"}); !errors.Is(err, cm.ErrForeignKeyViolation) {
+		t.Errorf("Expected ErrForeignKeyViolation for a missing customer, got %v", err)
+	}
+	if countRows(t, db, "orders") != 0 {
+		t.Error("Rejected order was stored")
+	}
+
+	id, err := orders.InsertRow(map[string]any{"customer": int32(1), "item": "book"})
+	if err != nil {
+		t.Fatalf("Failed to insert order: %v", err)
+	}
+	if err := orders.UpdateRow(id, map[string]any{"customer": int32(3)}); !errors.Is(err, cm.ErrForeignKeyViolation) {
+		t.Errorf("Expected ErrForeignKeyViolation when pointing at a missing customer, got %v", err)
+	}
+	if err := orders.UpdateRow(id, map[string]any{"customer": int32(2)}); err != nil {
+		t.Errorf("Failed to move order to another customer: %v", err)
+	}
+
+	customers, _ := db.GetTable("customers")
+	if err := customers.UpdateRow(0, map[string]any{"id": int32(10)}); err != nil {
+		t.Errorf("Failed to change an unreferenced key: %v", err)
+	}
+	if err := customers.UpdateRow(1, map[string]any{"id": int32(20)}); !errors.Is(err, cm.ErrForeignKeyViolation) {
+		t.Errorf("Expected ErrForeignKeyViolation when changing a referenced key, got %v", err)
+	}
+
+	notes, _ := db.GetTable("notes")
+	if _, err := notes.InsertRow(map[string]any{"author": nil}); err != nil {
+		t.Errorf("Failed to insert a NULL reference: %v", err)
+	}
+}
+
+func TestForeignKeyOnDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		onDelete flimsydb.ReferenceAction
+		orders   int
+	}{
+		{"restrict", flimsydb.RestrictAction, 3},
+		{"cascade", flimsydb.CascadeAction, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := flimsydb.NewFlimsyDB()
+			newForeignKeyTestDB(t, db, tt.onDelete)
+			insertCustomers(t, db)
+
+			orders, _ := db.GetTable("orders")
+			notes, _ := db.GetTable("notes")
+			for _, customer := range []int32{1, 1, 2} {
+				if _, err := orders.InsertRow(map[string]any{"customer": customer, "item": "book"}); err != nil {
+					t.Fatalf("Failed to insert order: %v", err)
+				}
+			}
+			noteID, err := notes.InsertRow(map[string]any{"author": int32(1)})
+			if err != nil {
+				t.Fatalf("Failed to insert note: %v", err)
+			}
+
+			customers, _ := db.GetTable("customers")
+			err = customers.DeleteRow(0)
+
+			if tt.onDelete == flimsydb.RestrictAction {
+				if !errors.Is(err, cm.ErrForeignKeyViolation) {
+					t.Errorf("Expected ErrForeignKeyViolation, got %v", err)
+				}
+				if countRows(t, db, "customers") != 2 {
+					t.Error("Restricted customer was deleted")
+				}
+			} else if err != nil {
+				t.Fatalf("Failed to delete customer: %v", err)
+			}
+
+			if n := countRows(t, db, "orders"); n != tt.orders {
+				t.Errorf("Expected %d orders, got %d", tt.orders, n)
+			}
+
+			note, err := notes.GetRow(noteID)
+			if err != nil {
+				t.Fatalf("Failed to get note: %v", err)
+			}
+			if isNull := cm.IsNull(note[0]); isNull != (tt.onDelete != flimsydb.RestrictAction) {
+				t.Errorf("Unexpected note author after delete: %v", note[0])
+			}
+		})
+	}
+}
+
+func TestForeignKeyRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	newForeignKeyTestDB(t, db, flimsydb.CascadeAction)
+	insertCustomers(t, db)
+
+	orders, _ := db.GetTable("orders")
+	if _, err := orders.InsertRow(map[string]any{"customer": int32(2), "item": "book"}); err != nil {
+		t.Fatalf("Failed to insert order: %v", err)
+	}
+	customers, _ := db.GetTable("customers")
+	if err := customers.DeleteRow(1); err != nil {
+		t.Fatalf("Failed to delete customer: %v", err)
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	if n := countRows(t, db, "orders"); n != 0 {
+		t.Errorf("Expected the cascaded deletion to be restored, got %d orders", n)
+	}
+
+	orders, _ = db.GetTable("orders")
+	if _, err := orders.InsertRow(map[string]any{"customer": int32(2), "item": "book"}); !errors.Is(err, cm.ErrForeignKeyViolation) {
+		t.Errorf("Expected restored reference to be enforced, got %v", err)
+	}
+}
@@ -1,8 +1,11 @@
 package tests
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math/rand"
 	"reflect"
+	"slices"
 	"sort"
 	"sync"
 	"testing"
@@ -427,3 +430,95 @@ func TestBTreeIndexerConcurrentAccess(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestBTreeIndexerRandomDeletes(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		idx := indexer.NewBTreeIndexer(cm.StringTType, 4)
+		model := make(map[int]bool)
+
+		for op := 0; op < 3000; op++ {
+			k := r.Intn(300)
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+
+			if model[k] {
+				if err := idx.Delete(key, k); err != nil {
+					t.Fatalf("seed %d: failed to delete %d: %v", seed, k, err)
+				}
+				delete(model, k)
+			} else {
+				if err := idx.Add(key, k); err != nil {
+					t.Fatalf("seed %d: failed to add %d: %v", seed, k, err)
+				}
+				model[k] = true
+			}
+		}
+
+		ptrs := idx.FindInRange([]byte{0, 0, 0, 0}, []byte{0xff, 0xff, 0xff, 0xff})
+		if len(ptrs) != len(model) {
+			t.Fatalf("seed %d: expected %d pointers, got %d", seed, len(model), len(ptrs))
+		}
+		for _, p := range ptrs {
+			if !model[p] {
+				t.Fatalf("seed %d: unexpected pointer %d", seed, p)
+			}
+		}
+	}
+}
+
+func TestBTreeIndexerRangeOrder(t *testing.T) {
+	idx := indexer.NewKeyIndexer()
+	r := rand.New(rand.NewSource(1))
+	for _, k := range r.Perm(2000) {
+		key := make([]byte, 4)
+		binary.BigEndian.PutUint32(key, uint32(k))
+		if err := idx.Add(key, k); err != nil {
+			t.Fatalf("Failed to add %d: %v", k, err)
+		}
+	}
+
+	ptrs := idx.FindInRange([]byte{0, 0, 0, 100}, []byte{0, 0, 6, 0})
+	if len(ptrs) != 0x600-100+1 {
+		t.Fatalf("Expected %d pointers, got %d", 0x600-100+1, len(ptrs))
+	}
+	if !sort.IntsAreSorted(ptrs) {
+		t.Error("Expected pointers in key order")
+	}
+}
+
+func TestBTreeIndexerAscendDescend(t *testing.T) {
+	idx := indexer.NewKeyIndexer()
+	r := rand.New(rand.NewSource(2))
+	for _, k := range r.Perm(1000) {
+		key := make([]byte, 4)
+		binary.BigEndian.PutUint32(key, uint32(2*k))
+		if err := idx.Add(key, 2*k); err != nil {
+			t.Fatalf("Failed to add %d: %v", 2*k, err)
+		}
+	}
+
+	collect := func(walk func(visit func(val cm.Blob, ptrs []int) bool), limit int) []int {
+		var result []int
+		walk(func(val cm.Blob, ptrs []int) bool {
+			result = append(result, ptrs...)
+			return len(result) < limit
+		})
+		return result
+	}
+
+	/* 101 is not a key, the walks start at the nearest key in their direction */
+	up := collect(func(visit func(cm.Blob, []int) bool) { idx.Ascend([]byte{0, 0, 0, 101}, visit) }, 5)
+	if !slices.Equal(up, []int{102, 104, 106, 108, 110}) {
+		t.Errorf("Expected the 5 keys after 101, got %v", up)
+	}
+	down := collect(func(visit func(cm.Blob, []int) bool) { idx.Descend([]byte{0, 0, 0, 101}, visit) }, 5)
+	if !slices.Equal(down, []int{100, 98, 96, 94, 92}) {
+		t.Errorf("Expected the 5 keys before 101, got %v", down)
+	}
+
+	all := collect(func(visit func(cm.Blob, []int) bool) { idx.Descend(nil, visit) }, 10000)
+	if len(all) != 1000 || !sort.IsSorted(sort.Reverse(sort.IntSlice(all))) {
+		t.Errorf("Expected every key in descending order, got %d keys", len(all))
+	}
+}
@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/* newJoinDB creates employees referring to departments by code, the code is indexed or not */
+func newJoinDB(t *testing.T, idxrType indexer.IndexerType) *flimsydb.FlimsyDB {
+	db := flimsydb.NewFlimsyDB()
+
+	type def struct {
+		name     string
+		typ      cm.TabularType
+		idxrType indexer.IndexerType
+	}
+	columns := func(defs ...def) flimsydb.Scheme {
+		var scheme flimsydb.Scheme
+		for _, d := range defs {
+			col, err := flimsydb.NewColumn(d.name, d.typ, nil, d.idxrType, 0)
+			if err != nil {
+				t.Fatalf("Failed to create column '%s': %v", d.name, err)
+			}
+			scheme = append(scheme, col)
+		}
+		return scheme
+	}
+
+	if err := db.CreateTable("employees", columns(
+		def{"id", cm.Int32TType, indexer.AbsentIndexerType},
+		def{"name", cm.StringTType, indexer.AbsentIndexerType},
+		def{"dept", cm.Int32TType, indexer.AbsentIndexerType},
+	)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := db.CreateTable("departments", columns(
+		def{"code", cm.Int32TType, idxrType},
+		def{"title", cm.StringTType, indexer.AbsentIndexerType},
+	)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	employees, _ := db.GetTable("employees")
+	departments, _ := db.GetTable("departments")
+
+	r := rand.New(rand.NewSource(3))
+	/* some codes are shared by two departments, and some departments have no employees */
+	for i := range 12 {
+		code := int32(i % 10)
+		if _, err := departments.InsertRow(map[string]any{"code": code, "title": fmt.Sprintf("dept-%d", i)}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+	for i := range 100 {
+		var dept any = int32(r.Intn(14))
+		if r.Intn(10) == 0 {
+			dept = nil
+		}
+		if _, err := employees.InsertRow(map[string]any{"id": int32(i), "name": fmt.Sprintf("emp-%d", i), "dept": dept}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	return db
+}
+
+/* expectedJoin joins the tables with nested loops over every row */
+func expectedJoin(t *testing.T, db *flimsydb.FlimsyDB, typ flimsydb.JoinType) []string {
+	employees, _ := db.GetTable("employees")
+	departments, _ := db.GetTable("departments")
+	left, err := employees.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get rows: %v", err)
+	}
+	right, err := departments.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to get rows: %v", err)
+	}
+
+	var result []string
+	for _, l := range left {
+		matched := false
+		for _, r := range right {
+			if l[2] != nil && l[2] == r[0] {
+				result = append(result, fmt.Sprint(l[0], r[1]))
+				matched = true
+			}
+		}
+		if !matched && typ == flimsydb.LeftJoin {
+			result = append(result, fmt.Sprint(l[0], nil))
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+func TestJoinMatchesNestedLoops(t *testing.T) {
+	for _, idxrType := range []indexer.IndexerType{indexer.AbsentIndexerType, indexer.HashMapIndexerType, indexer.BTreeIndexerType} {
+		db := newJoinDB(t, idxrType)
+		for _, typ := range []flimsydb.JoinType{flimsydb.InnerJoin, flimsydb.LeftJoin} {
+			t.Run(fmt.Sprintf("indexer=%v/type=%v", idxrType, typ), func(t *testing.T) {
+				records, err := db.Join("employees", "departments", typ).On("dept", "code").Records()
+				if err != nil {
+					t.Fatalf("Failed to join: %v", err)
+				}
+
+				got := make([]string, len(records))
+				for i, record := range records {
+					if len(record) != 5 {
+						t.Fatalf("Expected every qualified column, got %v", record)
+					}
+					got[i] = fmt.Sprint(record["employees.id"], record["departments.title"])
+				}
+				sort.Strings(got)
+
+				if want := expectedJoin(t, db, typ); !reflect.DeepEqual(got, want) {
+					t.Fatalf("Expected %v, got %v", want, got)
+				}
+			})
+		}
+	}
+}
+
+func TestJoinSelectAndWhere(t *testing.T) {
+	db := newJoinDB(t, indexer.HashMapIndexerType)
+
+	records, err := db.Join("employees", "departments", flimsydb.LeftJoin).
+		On("dept", "code").
+		Where(flimsydb.Lt("id", int32(5))).
+		Select("departments.title", "employees.name").
+		Records()
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	if len(records) < 5 {
+		t.Fatalf("Expected every employee below 5, got %v", records)
+	}
+	for _, record := range records {
+		if _, found := record["departments.title"]; !found || len(record) != 2 {
+			t.Fatalf("Expected the selected columns only, got %v", record)
+		}
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	db := newJoinDB(t, indexer.AbsentIndexerType)
+
+	if _, err := db.Join("employees", "departments", flimsydb.InnerJoin).On("name", "code").Records(); !errors.Is(err, cm.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v", err)
+	}
+	if _, err := db.Join("employees", "projects", flimsydb.InnerJoin).On("dept", "code").Records(); !errors.Is(err, cm.ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+	if _, err := db.Join("employees", "departments", flimsydb.InnerJoin).On("dept", "id").Records(); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected ErrColumnNotFound, got %v", err)
+	}
+	if _, err := db.Join("employees", "departments", flimsydb.InnerJoin).Records(); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData without a condition, got %v", err)
+	}
+	if _, err := db.Join("employees", "departments", flimsydb.InnerJoin).On("dept", "code").Select("title").Records(); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for an unqualified column, got %v", err)
+	}
+}
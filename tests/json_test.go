@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+func newCustomersWithProfiles(t *testing.T, db *flimsydb.FlimsyDB) *flimsydb.Table {
+	name, err := flimsydb.NewColumn("name", cm.StringTType, nil, indexer.AbsentIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'name': %v", err)
+	}
+	profile, err := flimsydb.NewColumn("profile", cm.JSONTType, nil, indexer.AbsentIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'profile': %v", err)
+	}
+	if err := db.CreateTable("customers", flimsydb.Scheme{name, profile}); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("customers")
+
+	for _, values := range []map[string]any{
+		{"name": "Alice", "profile": `{"address": {"city": "Paris"}, "age": 31, "tags": ["vip"]}`},
+		{"name": "Bob", "profile": map[string]any{"address": map[string]any{"city": "Berlin"}, "age": 45}},
+		{"name": "Carol", "profile": `{"address": {"city": "Paris"}, "age": "unknown"}`},
+		{"name": "Dave", "profile": `{"age": 19}`},
+		{"name": "Eve"},
+	} {
+		if _, err := table.InsertRow(values); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	return table
+}
+
+func TestJSONColumn(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	table := newCustomersWithProfiles(t, db)
+
+	if _, err := table.InsertRow(map[string]any{"name": "Mallory", "profile": `{"broken": `}); err == nil {
+		t.Error("Expected an invalid document to be rejected")
+	}
+
+	rows, err := table.Find("name", "Alice")
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("Failed to find Alice: %v, %v", rows, err)
+	}
+	if doc := string(rows[0][1].(json.RawMessage)); doc != `{"address":{"city":"Paris"},"age":31,"tags":["vip"]}` {
+		t.Errorf("Expected a compacted document, got %s", doc)
+	}
+
+	for _, withIndex := range []bool{false, true} {
+		if withIndex {
+			if err := table.CreatePathIndex("by_city", "profile", "$.address.city", indexer.HashMapIndexerType); err != nil {
+				t.Fatalf("Failed to create path index: %v", err)
+			}
+			if err := table.CreatePathIndex("by_age", "profile", "$.age", indexer.BTreeIndexerType); err != nil {
+				t.Fatalf("Failed to create path index: %v", err)
+			}
+		}
+
+		rows, err = table.Find("profile->$.address.city", "Paris")
+		if err != nil || len(rows) != 2 {
+			t.Errorf("Expected 2 customers in Paris (index %v), got %v, %v", withIndex, rows, err)
+		}
+
+		rows, err = table.Find("profile->$.tags[0]", "vip")
+		if err != nil || len(rows) != 1 || rows[0][0] != "Alice" {
+			t.Errorf("Expected Alice to be tagged (index %v), got %v, %v", withIndex, rows, err)
+		}
+
+		rows, err = table.FindInRange("profile->$.age", 20, 50)
+		if err != nil || len(rows) != 2 {
+			t.Errorf("Expected 2 customers aged 20 to 50 (index %v), got %v, %v", withIndex, rows, err)
+		}
+
+		rows, err = table.Find("profile->$.address.city", nil)
+		if err != nil || len(rows) != 2 {
+			t.Errorf("Expected 2 customers without a city (index %v), got %v, %v", withIndex, rows, err)
+		}
+	}
+
+	if err := table.UpdateRow(3, map[string]any{"profile": `{"address": {"city": "Paris"}}`}); err != nil {
+		t.Fatalf("Failed to update row: %v", err)
+	}
+	rows, _ = table.Find("profile->$.address.city", "Paris")
+	if len(rows) != 3 {
+		t.Errorf("Expected the path index to follow updates, got %v", rows)
+	}
+
+	if _, err := table.Find("profile->address", "Paris"); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for a malformed path, got %v", err)
+	}
+	if _, err := table.Find("name->$.x", "Paris"); !errors.Is(err, cm.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for a path on a string column, got %v", err)
+	}
+	if err := table.CreatePathIndex("by_name", "name", "$.x", indexer.HashMapIndexerType); !errors.Is(err, cm.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for a path index on a string column, got %v", err)
+	}
+}
+
+func TestJSONPathIndexRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	table := newCustomersWithProfiles(t, db)
+	if err := table.CreatePathIndex("by_age", "profile", "$.age", indexer.BTreeIndexerType); err != nil {
+		t.Fatalf("Failed to create path index: %v", err)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	table, _ = db.GetTable("customers")
+	rows, err := table.FindInRange("profile->$.age", 40, 50)
+	if err != nil || len(rows) != 1 || rows[0][0] != "Bob" {
+		t.Errorf("Expected Bob from the restored path index, got %v, %v", rows, err)
+	}
+	if err := table.CreatePathIndex("by_age", "profile", "$.age", indexer.BTreeIndexerType); !errors.Is(err, cm.ErrIndexExists) {
+		t.Errorf("Expected the path index to be restored, got %v", err)
+	}
+}
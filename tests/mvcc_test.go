@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	if err := db.CreateTable("users", newWALTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("users")
+
+	aliceID, _ := table.InsertRow(map[string]any{"id": int32(1), "name": "Alice"})
+	bobID, _ := table.InsertRow(map[string]any{"id": int32(2), "name": "Bob"})
+
+	snapshot := db.Snapshot()
+	defer snapshot.Release()
+
+	if err := table.UpdateRow(aliceID, map[string]any{"name": "Alicia"}); err != nil {
+		t.Fatalf("Failed to update row: %v", err)
+	}
+	if err := table.DeleteRow(bobID); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	if _, err := table.InsertRow(map[string]any{"id": int32(3), "name": "Carol"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	rows, err := snapshot.GetAll("users")
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if len(rows) != 2 || rows[0][1] != "Alice" || rows[1][1] != "Bob" {
+		t.Errorf("Snapshot does not show the state it was taken at: %v", rows)
+	}
+
+	found, err := snapshot.Find("users", "name", "Alice")
+	if err != nil {
+		t.Fatalf("Failed to find in snapshot: %v", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("Expected indexed lookup to find the old version, got %v", found)
+	}
+
+	found, err = snapshot.Find("users", "name", "Alicia")
+	if err != nil {
+		t.Fatalf("Failed to find in snapshot: %v", err)
+	}
+	if len(found) != 0 {
+		t.Errorf("Expected the new version to be invisible, got %v", found)
+	}
+
+	found, err = snapshot.FindInRange("users", "id", int32(2), int32(3))
+	if err != nil {
+		t.Fatalf("Failed to find range in snapshot: %v", err)
+	}
+	if len(found) != 1 || found[0][1] != "Bob" {
+		t.Errorf("Expected the deleted row in the snapshot range, got %v", found)
+	}
+
+	if _, err := snapshot.GetRow("users", bobID); err != nil {
+		t.Errorf("Expected deleted row to be visible in the snapshot, got %v", err)
+	}
+
+	current, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read table: %v", err)
+	}
+	if len(current) != 2 || current[0][1] != "Alicia" || current[1][1] != "Carol" {
+		t.Errorf("Unexpected current state: %v", current)
+	}
+
+	snapshot.Release()
+	if _, err := snapshot.GetAll("users"); !errors.Is(err, cm.ErrSnapshotReleased) {
+		t.Errorf("Expected ErrSnapshotReleased, got %v", err)
+	}
+
+	table.Vacuum()
+	fresh := db.Snapshot()
+	defer fresh.Release()
+	rows, err = fresh.GetAll("users")
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Errorf("Expected a new snapshot to see the current state, got %v", rows)
+	}
+}
+
+func TestTxReadsFromSnapshot(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	newTxTestDB(t, db)
+	accounts, _ := db.GetTable("accounts")
+
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	if _, err := accounts.InsertRow(map[string]any{"id": int32(1), "name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	rows, err := tx.GetAll("accounts")
+	if err != nil {
+		t.Fatalf("Failed to read in transaction: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("Expected the transaction to read as of Begin, got %v", rows)
+	}
+}
+
+func TestSnapshotWithConcurrentWriters(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	if err := db.CreateTable("users", newWALTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("users")
+
+	const count = 200
+	for i := 0; i < count; i++ {
+		if _, err := table.InsertRow(map[string]any{"id": int32(i), "name": fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	snapshot := db.Snapshot()
+	defer snapshot.Release()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for id := w; id < count; id += 4 {
+				if err := table.UpdateRow(id, map[string]any{"name": "changed"}); err != nil {
+					t.Errorf("Failed to update row: %v", err)
+				}
+				if id%8 == 0 {
+					if err := table.DeleteRow(id); err != nil {
+						t.Errorf("Failed to delete row: %v", err)
+					}
+				}
+			}
+		}(w)
+	}
+
+	for i := 0; i < 20; i++ {
+		rows, err := snapshot.GetAll("users")
+		if err != nil {
+			t.Fatalf("Failed to read snapshot: %v", err)
+		}
+		if len(rows) != count {
+			t.Fatalf("Snapshot changed under concurrent writes: %d rows", len(rows))
+		}
+		for _, row := range rows {
+			if row[1] == "changed" {
+				t.Fatalf("Snapshot sees a later write: %v", row)
+			}
+		}
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+func newNullTestScheme(t *testing.T) flimsydb.Scheme {
+	col1, err := flimsydb.NewColumn("id", cm.Int32TType, nil, indexer.HashMapIndexerType, flimsydb.PrimaryKeyFlag)
+	if err != nil {
+		t.Fatalf("Failed to create column 'id': %v", err)
+	}
+
+	col2, err := flimsydb.NewColumn("email", cm.StringTType, nil, indexer.HashMapIndexerType, flimsydb.UniqueFlag)
+	if err != nil {
+		t.Fatalf("Failed to create column 'email': %v", err)
+	}
+
+	col3, err := flimsydb.NewColumn("score", cm.Float64TType, nil, indexer.BTreeIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'score': %v", err)
+	}
+
+	col4, err := flimsydb.NewColumn("note", cm.StringTType, nil, indexer.AbsentIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'note': %v", err)
+	}
+
+	return flimsydb.Scheme{col1, col2, col3, col4}
+}
+
+func TestNullValues(t *testing.T) {
+	table := flimsydb.NewTable(newNullTestScheme(t))
+
+	if _, err := table.InsertRow(map[string]any{"id": int32(1)}); err != nil {
+		t.Fatalf("Failed to insert row with NULL defaults: %v", err)
+	}
+	if _, err := table.InsertRow(map[string]any{"id": int32(2), "email": nil, "score": float64(1.5), "note": "x"}); err != nil {
+		t.Fatalf("Failed to insert row with explicit NULL: %v", err)
+	}
+	if _, err := table.InsertRow(map[string]any{"id": int32(3), "email": "c@example.com", "score": float64(-2)}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	rows, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if rows[0][1] != nil || rows[0][2] != nil || rows[0][3] != nil {
+		t.Errorf("Expected NULL values to deserialize as nil, got %v", rows[0])
+	}
+
+	wantNulls := map[string]int{"email": 2, "score": 1, "note": 2}
+	for colName, want := range wantNulls {
+		found, err := table.Find(colName, nil)
+		if err != nil {
+			t.Fatalf("Failed to find NULL in %s: %v", colName, err)
+		}
+		if len(found) != want {
+			t.Errorf("Expected %d NULL rows in %s, got %d", want, colName, len(found))
+		}
+	}
+
+	found, err := table.FindInRange("score", float64(-10), float64(10))
+	if err != nil {
+		t.Fatalf("Failed to find range: %v", err)
+	}
+	if len(found) != 2 {
+		t.Errorf("Expected NULL to be excluded from ranges, got %v", found)
+	}
+
+	if _, err := table.FindInRange("score", nil, float64(10)); err == nil {
+		t.Error("Expected error for a NULL range bound")
+	}
+}
+
+func TestNotNullFlag(t *testing.T) {
+	table := flimsydb.NewTable(newNullTestScheme(t))
+
+	if _, err := table.InsertRow(map[string]any{"email": "a@example.com"}); !errors.Is(err, cm.ErrNullViolation) {
+		t.Errorf("Expected ErrNullViolation for a missing primary key, got %v", err)
+	}
+	if _, err := table.InsertRow(map[string]any{"id": nil}); !errors.Is(err, cm.ErrNullViolation) {
+		t.Errorf("Expected ErrNullViolation for an explicit NULL, got %v", err)
+	}
+
+	id, err := table.InsertRow(map[string]any{"id": int32(1)})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if err := table.UpdateRow(id, map[string]any{"id": nil}); !errors.Is(err, cm.ErrNullViolation) {
+		t.Errorf("Expected ErrNullViolation on update, got %v", err)
+	}
+
+	rows, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Expected rejected rows to be absent, got %v", rows)
+	}
+}
+
+func TestUniqueFlagWithNulls(t *testing.T) {
+	table := flimsydb.NewTable(newNullTestScheme(t))
+
+	for i := int32(1); i <= 2; i++ {
+		if _, err := table.InsertRow(map[string]any{"id": i}); err != nil {
+			t.Fatalf("Expected several NULLs in a unique column to be allowed: %v", err)
+		}
+	}
+
+	if _, err := table.InsertRow(map[string]any{"id": int32(3), "email": "a@example.com"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if _, err := table.InsertRow(map[string]any{"id": int32(4), "email": "a@example.com"}); err == nil {
+		t.Error("Expected error for a duplicate unique value")
+	}
+	if _, err := table.InsertRow(map[string]any{"id": int32(1)}); err == nil {
+		t.Error("Expected error for a duplicate primary key")
+	}
+}
+
+func TestNullRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.CreateTable("users", newNullTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("users")
+	if _, err := table.InsertRow(map[string]any{"id": int32(1)}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	table, _ = db.GetTable("users")
+
+	found, err := table.Find("email", nil)
+	if err != nil {
+		t.Fatalf("Failed to find NULL: %v", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("Expected NULL to survive recovery, got %v", found)
+	}
+
+	if _, err := table.InsertRow(map[string]any{"email": "a@example.com"}); !errors.Is(err, cm.ErrNullViolation) {
+		t.Errorf("Expected flags to survive recovery, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+func orderedIDs(t *testing.T, q *flimsydb.Query) []int32 {
+	rows, err := q.Rows()
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	ids := make([]int32, len(rows))
+	for i, row := range rows {
+		ids[i] = row[0].(int32)
+	}
+	return ids
+}
+
+/* compareNullable orders NULL before every value like the database does */
+func compareNullable[T cmp.Ordered](a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	default:
+		return cmp.Compare(a.(T), b.(T))
+	}
+}
+
+func TestOrderByMatchesSort(t *testing.T) {
+	indexed := newPeopleTable(t, true)
+	plain := newPeopleTable(t, false)
+
+	type orderCase struct {
+		name  string
+		build func(q *flimsydb.Query) *flimsydb.Query
+	}
+	cases := []orderCase{
+		{"age asc", func(q *flimsydb.Query) *flimsydb.Query { return q.OrderBy("age", flimsydb.Asc) }},
+		{"age desc", func(q *flimsydb.Query) *flimsydb.Query { return q.OrderBy("age", flimsydb.Desc) }},
+		{"age desc, score asc", func(q *flimsydb.Query) *flimsydb.Query {
+			return q.OrderBy("age", flimsydb.Desc).OrderBy("score", flimsydb.Asc)
+		}},
+		{"city, age desc limit", func(q *flimsydb.Query) *flimsydb.Query {
+			return q.OrderBy("city", flimsydb.Asc).OrderBy("age", flimsydb.Desc).Limit(25)
+		}},
+		{"top 10 by age", func(q *flimsydb.Query) *flimsydb.Query { return q.OrderBy("age", flimsydb.Desc).Limit(10) }},
+		{"page 3 by age", func(q *flimsydb.Query) *flimsydb.Query {
+			return q.OrderBy("age", flimsydb.Asc).Offset(20).Limit(10)
+		}},
+		{"range on sort column", func(q *flimsydb.Query) *flimsydb.Query {
+			return q.Where(flimsydb.Between("age", int32(30), int32(40))).OrderBy("age", flimsydb.Desc).Limit(15)
+		}},
+		{"open range on sort column", func(q *flimsydb.Query) *flimsydb.Query {
+			return q.Where(flimsydb.Gt("age", int32(60))).OrderBy("age", flimsydb.Asc)
+		}},
+		{"exclusive range descending", func(q *flimsydb.Query) *flimsydb.Query {
+			return q.Where(flimsydb.Lt("age", int32(25))).OrderBy("age", flimsydb.Desc)
+		}},
+		{"filter on another column", func(q *flimsydb.Query) *flimsydb.Query {
+			return q.Where(flimsydb.Eq("level", "senior")).OrderBy("age", flimsydb.Asc).Limit(5)
+		}},
+		{"unindexed sort column", func(q *flimsydb.Query) *flimsydb.Query {
+			return q.Where(flimsydb.Like("city", "P%")).OrderBy("score", flimsydb.Desc)
+		}},
+		{"offset past the end", func(q *flimsydb.Query) *flimsydb.Query { return q.OrderBy("age", flimsydb.Asc).Offset(1000) }},
+		{"limit without order", func(q *flimsydb.Query) *flimsydb.Query { return q.Where(flimsydb.Eq("city", "Rome")).Limit(3) }},
+		{"limit zero", func(q *flimsydb.Query) *flimsydb.Query { return q.OrderBy("age", flimsydb.Asc).Limit(0) }},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := orderedIDs(t, tc.build(indexed.Query()))
+			want := orderedIDs(t, tc.build(plain.Query()))
+			if !slices.Equal(got, want) {
+				t.Errorf("Expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestOrderBySemantics(t *testing.T) {
+	table := newPeopleTable(t, false)
+
+	rows, err := table.Query().OrderBy("age", flimsydb.Asc).OrderBy("score", flimsydb.Desc).Rows()
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	all, _ := table.GetAll()
+	if len(rows) != len(all) {
+		t.Fatalf("Expected %d rows, got %d", len(all), len(rows))
+	}
+	for i := 1; i < len(rows); i++ {
+		prev, cur := rows[i-1], rows[i]
+		c := cmp.Or(compareNullable[int32](prev[2], cur[2]), -compareNullable[float64](prev[4], cur[4]), cmp.Compare(prev[0].(int32), cur[0].(int32)))
+		if c > 0 {
+			t.Fatalf("Rows %v and %v are out of order", prev, cur)
+		}
+	}
+	if rows[0][2] != nil {
+		t.Errorf("Expected NULL ages first, got %v", rows[0])
+	}
+
+	/* enums follow declaration order */
+	levels, _ := table.Query().Where(flimsydb.Ne("level", nil)).OrderBy("level", flimsydb.Desc).Limit(1).Rows()
+	if len(levels) != 1 || levels[0][3] != "senior" {
+		t.Errorf("Expected senior to sort last, got %v", levels)
+	}
+
+	if _, err := table.Query().OrderBy("height", flimsydb.Asc).Rows(); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected ErrColumnNotFound, got %v", err)
+	}
+	if _, err := table.Query().Limit(-5).Rows(); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a negative limit to be rejected, got %v", err)
+	}
+	if _, err := table.Query().Offset(-1).Rows(); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a negative offset to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,397 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+func mustPrepare(t *testing.T, db *flimsydb.FlimsyDB, sql string) *flimsydb.Stmt {
+	t.Helper()
+
+	stmt, err := db.Prepare(sql)
+	if err != nil {
+		t.Fatalf("Prepare %q failed: %v", sql, err)
+	}
+	return stmt
+}
+
+func TestPreparedStatements(t *testing.T) {
+	db := newSQLDB(t)
+
+	byAge := mustPrepare(t, db, "SELECT name FROM employees WHERE age >= ? ORDER BY age LIMIT ?")
+	for _, tc := range []struct {
+		age   int
+		limit int
+		want  [][]any
+	}{
+		{30, 10, [][]any{{"Alice"}, {"Dan's"}}},
+		{0, 1, [][]any{{"Bob"}}},
+		{50, 10, [][]any{}},
+	} {
+		rs, err := byAge.Query(tc.age, tc.limit)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if !reflect.DeepEqual(rs.Rows, tc.want) {
+			t.Errorf("age >= %d: expected %v, got %v", tc.age, tc.want, rs.Rows)
+		}
+	}
+
+	insert := mustPrepare(t, db, "INSERT INTO employees (id, name, age) VALUES (?, ?, ?)")
+	for id := 5; id <= 7; id++ {
+		if result, err := insert.Exec(id, "Temp", 20+id); err != nil || result.RowsAffected != 1 {
+			t.Fatalf("Insert failed: %v, %v", result, err)
+		}
+	}
+
+	rename := mustPrepare(t, db, "UPDATE employees SET name = ? WHERE id = ?")
+	if result, err := rename.Exec("Eve", 5); err != nil || result.RowsAffected != 1 {
+		t.Errorf("Update failed: %v, %v", result, err)
+	}
+
+	remove := mustPrepare(t, db, "DELETE FROM employees WHERE name = 'Temp'")
+	if result, err := remove.Exec(); err != nil || result.RowsAffected != 2 {
+		t.Errorf("Expected 2 deleted rows, got %v, %v", result, err)
+	}
+	if rs := mustQuery(t, db, "SELECT name FROM employees WHERE id >= 5"); !reflect.DeepEqual(rs.Rows, [][]any{{"Eve"}}) {
+		t.Errorf("Unexpected rows %v", rs.Rows)
+	}
+
+	if _, err := byAge.Query(30); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a missing argument to be refused, got %v", err)
+	}
+	if _, err := byAge.Query(30, -1, 1); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected an extra argument to be refused, got %v", err)
+	}
+	if _, err := byAge.Query(30, -2); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a negative limit to be refused, got %v", err)
+	}
+	if _, err := byAge.Exec(30, 1); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected Exec to refuse a query, got %v", err)
+	}
+}
+
+func TestPrepareErrors(t *testing.T) {
+	db := newSQLDB(t)
+
+	for _, tc := range []struct {
+		sql  string
+		want error
+	}{
+		{"SELECT name FROM", cm.ErrSyntax},
+		{"SELECT name FROM managers", cm.ErrTableNotFound},
+		{"SELECT nickname FROM employees", cm.ErrColumnNotFound},
+		{"SELECT name FROM employees WHERE nickname = ?", cm.ErrColumnNotFound},
+		{"SELECT name FROM employees ORDER BY nickname", cm.ErrColumnNotFound},
+		{"UPDATE employees SET nickname = ?", cm.ErrColumnNotFound},
+		{"INSERT INTO employees (id, nickname) VALUES (?, ?)", cm.ErrColumnNotFound},
+		{"DELETE FROM employees WHERE age = 'old'", cm.ErrTypeMismatch},
+	} {
+		if _, err := db.Prepare(tc.sql); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.sql, tc.want, err)
+		}
+	}
+}
+
+func TestPreparedStatementReplansAfterSchemaChange(t *testing.T) {
+	db := newSQLDB(t)
+
+	stmt := mustPrepare(t, db, "SELECT name FROM employees WHERE id = ?")
+	if rs, err := stmt.Query(1); err != nil || !reflect.DeepEqual(rs.Rows, [][]any{{"Alice"}}) {
+		t.Fatalf("Unexpected result %v, %v", rs, err)
+	}
+
+	mustExec(t, db, "DROP TABLE employees")
+	if _, err := stmt.Query(1); !errors.Is(err, cm.ErrTableNotFound) {
+		t.Errorf("Expected the dropped table to be missing, got %v", err)
+	}
+
+	/* the new table has other columns, the statement binds to them */
+	mustExec(t, db, "CREATE TABLE employees (name TEXT, id BIGINT PRIMARY KEY)")
+	mustExec(t, db, "INSERT INTO employees VALUES ('Zoe', 1)")
+	if rs, err := stmt.Query(1); err != nil || !reflect.DeepEqual(rs.Rows, [][]any{{"Zoe"}}) {
+		t.Errorf("Expected the recreated table, got %v, %v", rs, err)
+	}
+
+	mustExec(t, db, "DROP TABLE employees")
+	mustExec(t, db, "CREATE TABLE employees (id INT PRIMARY KEY)")
+	if _, err := stmt.Query(1); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected the missing column to be reported, got %v", err)
+	}
+
+	/* statements run by Exec and Query are cached the same way */
+	if _, err := db.Query("SELECT name FROM employees"); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected the missing column to be reported, got %v", err)
+	}
+}
+
+func TestPreparedStatementReplansAfterIndexChange(t *testing.T) {
+	db := newSQLDB(t)
+	table, err := db.GetTable("employees")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+
+	/* a clause without placeholders keeps its access path between runs */
+	stmt := mustPrepare(t, db, "SELECT id FROM employees WHERE level = 'junior' AND salary = 1000 ORDER BY id")
+	query := func() [][]any {
+		t.Helper()
+		rs, err := stmt.Query()
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		return rs.Rows
+	}
+
+	if got := query(); !reflect.DeepEqual(got, [][]any{{int32(4)}}) {
+		t.Errorf("Unexpected rows %v", got)
+	}
+
+	if err := table.CreateIndex("by_pay", "level", "salary"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	mustExec(t, db, "INSERT INTO employees (id, name) VALUES (5, 'Erin')")
+	if got := query(); !reflect.DeepEqual(got, [][]any{{int32(4)}, {int32(5)}}) {
+		t.Errorf("Unexpected rows with the index %v", got)
+	}
+
+	/* a path through the dropped index would miss rows inserted afterwards */
+	if err := table.DropIndex("by_pay"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	mustExec(t, db, "INSERT INTO employees (id, name) VALUES (6, 'Finn')")
+	if got := query(); !reflect.DeepEqual(got, [][]any{{int32(4)}, {int32(5)}, {int32(6)}}) {
+		t.Errorf("Unexpected rows after dropping the index %v", got)
+	}
+}
+
+func TestPreparedStatementConcurrentUse(t *testing.T) {
+	db := newSQLDB(t)
+
+	stmt := mustPrepare(t, db, "SELECT name FROM employees WHERE id = ?")
+	insert := mustPrepare(t, db, "INSERT INTO employees (id, name) VALUES (?, ?)")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := insert.Exec(100+i, "Worker"); err != nil {
+				t.Errorf("Insert failed: %v", err)
+			}
+			if rs, err := stmt.Query(100 + i); err != nil || !reflect.DeepEqual(rs.Rows, [][]any{{"Worker"}}) {
+				t.Errorf("Unexpected result %v, %v", rs, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPreparedQuery(t *testing.T) {
+	db := newSQLDB(t)
+	table, err := db.GetTable("employees")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+
+	byAge, err := table.Query().
+		Select("name").
+		Where(flimsydb.And(flimsydb.Between("age", flimsydb.Param(1), flimsydb.Param(2)), flimsydb.Ne("level", flimsydb.Param(3)))).
+		OrderBy("age", flimsydb.Asc).
+		Prepare()
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		args []any
+		want [][]any
+	}{
+		{[]any{int32(0), int32(40), "middle"}, [][]any{{"Bob"}, {"Alice"}}},
+		{[]any{int32(0), int32(40), "junior"}, [][]any{{"Alice"}}},
+		{[]any{int32(-5), int32(50), "senior"}, [][]any{{"Carol"}, {"Bob"}, {"Dan's"}}},
+	} {
+		rows, err := byAge.Rows(tc.args...)
+		if err != nil || !reflect.DeepEqual(rows, tc.want) {
+			t.Errorf("%v: expected %v, got %v, %v", tc.args, tc.want, rows, err)
+		}
+	}
+
+	records, err := byAge.Records(int32(30), int32(40), "junior")
+	if err != nil || len(records) != 1 || records[0]["name"] != "Alice" {
+		t.Errorf("Expected Alice, got %v, %v", records, err)
+	}
+
+	if _, err := byAge.Rows(int32(0)); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected a missing argument to be reported, got %v", err)
+	}
+	if _, err := byAge.Rows("x", int32(40), "junior"); err == nil {
+		t.Errorf("Expected an argument of the wrong type to be reported, got %v", err)
+	}
+
+	for _, q := range []*flimsydb.Query{
+		table.Query().Where(flimsydb.Eq("nickname", flimsydb.Param(1))),
+		table.Query().Select("nickname"),
+		table.Query().OrderBy("nickname", flimsydb.Asc),
+	} {
+		if _, err := q.Prepare(); !errors.Is(err, cm.ErrColumnNotFound) {
+			t.Errorf("Expected an unknown column to be reported by Prepare, got %v", err)
+		}
+	}
+	if _, err := table.Query().Where(flimsydb.Eq("name", flimsydb.Param(0))).Prepare(); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected placeholders to count from 1, got %v", err)
+	}
+}
+
+func TestPreparedQueryReplansAfterIndexChange(t *testing.T) {
+	db := newSQLDB(t)
+	table, err := db.GetTable("employees")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+
+	/* a predicate without placeholders keeps its access path between runs */
+	juniors, err := table.Query().
+		Select("id").
+		Where(flimsydb.Eq("level", "junior")).
+		Where(flimsydb.Eq("salary", cm.NewDecimal(100000, 2))).
+		OrderBy("id", flimsydb.Asc).
+		Prepare()
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	query := func() [][]any {
+		t.Helper()
+		rows, err := juniors.Rows()
+		if err != nil {
+			t.Fatalf("Rows failed: %v", err)
+		}
+		return rows
+	}
+
+	if got := query(); !reflect.DeepEqual(got, [][]any{{int32(4)}}) {
+		t.Errorf("Unexpected rows %v", got)
+	}
+
+	if err := table.CreateIndex("by_pay", "level", "salary"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	mustExec(t, db, "INSERT INTO employees (id, name) VALUES (5, 'Erin')")
+	if got := query(); !reflect.DeepEqual(got, [][]any{{int32(4)}, {int32(5)}}) {
+		t.Errorf("Unexpected rows with the index %v", got)
+	}
+
+	if err := table.DropIndex("by_pay"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	mustExec(t, db, "INSERT INTO employees (id, name) VALUES (6, 'Finn')")
+	if got := query(); !reflect.DeepEqual(got, [][]any{{int32(4)}, {int32(5)}, {int32(6)}}) {
+		t.Errorf("Unexpected rows after dropping the index %v", got)
+	}
+}
+
+func TestPreparedQueryRebindsPlan(t *testing.T) {
+	db := newSQLDB(t)
+	table, err := db.GetTable("employees")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+	if err := table.CreateIndex("by_level_salary", "level", "salary"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	/* the plan of the first run is reused for the others, whatever index or scan it chose */
+	q, err := table.Query().
+		Select("id").
+		Where(flimsydb.Or(
+			flimsydb.And(flimsydb.Eq("level", flimsydb.Param(1)), flimsydb.Eq("salary", flimsydb.Param(2))),
+			flimsydb.Eq("name", flimsydb.Param(3)),
+			flimsydb.Eq("email", flimsydb.Param(4)),
+		)).
+		OrderBy("id", flimsydb.Asc).
+		Prepare()
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		args []any
+		want [][]any
+	}{
+		{[]any{"junior", cm.NewDecimal(100000, 2), "Alice", "x"}, [][]any{{int32(1)}, {int32(4)}}},
+		{[]any{"junior", cm.NewDecimal(310000, 2), "Carol", "alice@example.com"}, [][]any{{int32(1)}, {int32(2)}, {int32(3)}}},
+		/* a NULL argument turns an equality into IS NULL, which is planned anew */
+		{[]any{"senior", cm.NewDecimal(0, 2), "Nobody", nil}, [][]any{{int32(2)}, {int32(4)}}},
+		{[]any{"middle", cm.NewDecimal(400025, 2), "Nobody", "x"}, [][]any{{int32(3)}}},
+	} {
+		rows, err := q.Rows(tc.args...)
+		if err != nil || !reflect.DeepEqual(rows, tc.want) {
+			t.Errorf("%v: expected %v, got %v, %v", tc.args, tc.want, rows, err)
+		}
+	}
+
+	/* the same goes for SQL statements with placeholders */
+	stmt := mustPrepare(t, db, "SELECT id FROM employees WHERE level = ? AND salary = ? ORDER BY id")
+	for _, tc := range []struct {
+		args []any
+		want [][]any
+	}{
+		{[]any{"junior", 1000}, [][]any{{int32(4)}}},
+		{[]any{"senior", cm.NewDecimal(520050, 2)}, [][]any{{int32(1)}}},
+		{[]any{"junior", nil}, [][]any{}},
+	} {
+		rs, err := stmt.Query(tc.args...)
+		if err != nil || len(rs.Rows) != len(tc.want) || len(tc.want) != 0 && !reflect.DeepEqual(rs.Rows, tc.want) {
+			t.Errorf("%v: expected %v, got %v, %v", tc.args, tc.want, rs, err)
+		}
+	}
+
+	if err := table.DropIndex("by_level_salary"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	mustExec(t, db, "INSERT INTO employees (id, name, level, salary) VALUES (5, 'Erin', 'senior', 5200.50)")
+	rs, err := stmt.Query("senior", cm.NewDecimal(520050, 2))
+	if err != nil || !reflect.DeepEqual(rs.Rows, [][]any{{int32(1)}, {int32(5)}}) {
+		t.Errorf("Unexpected rows after dropping the index %v, %v", rs, err)
+	}
+}
+
+func TestPreparedQueryAfterDeleteTable(t *testing.T) {
+	db := newSQLDB(t)
+	table, err := db.GetTable("employees")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+
+	q, err := table.Query().Select("name").Where(flimsydb.Eq("id", flimsydb.Param(1))).Prepare()
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	if rows, err := q.Rows(int32(1)); err != nil || !reflect.DeepEqual(rows, [][]any{{"Alice"}}) {
+		t.Errorf("Expected Alice, got %v, %v", rows, err)
+	}
+
+	/* creating another table does not affect the query */
+	mustExec(t, db, "CREATE TABLE other (id INT PRIMARY KEY)")
+	if _, err := q.Rows(int32(1)); err != nil {
+		t.Errorf("Expected the query to keep working, got %v", err)
+	}
+
+	if err := db.DeleteTable("employees"); err != nil {
+		t.Fatalf("Failed to delete table: %v", err)
+	}
+	if _, err := q.Rows(int32(1)); !errors.Is(err, cm.ErrTableNotFound) {
+		t.Errorf("Expected the deleted table to be reported, got %v", err)
+	}
+
+	/* a new table of the same name is not the one the query was prepared for */
+	mustExec(t, db, "CREATE TABLE employees (id INT PRIMARY KEY, name TEXT)")
+	if _, err := q.Records(int32(1)); !errors.Is(err, cm.ErrTableNotFound) {
+		t.Errorf("Expected the deleted table to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+/* enrollments are identified by the student and the course together */
+func newPrimaryKeyTestScheme(t *testing.T) flimsydb.Scheme {
+	student, err := flimsydb.NewColumn("student", cm.Int32TType, nil, indexer.AbsentIndexerType, flimsydb.PrimaryKeyFlag)
+	if err != nil {
+		t.Fatalf("Failed to create column 'student': %v", err)
+	}
+	course, err := flimsydb.NewColumn("course", cm.StringTType, nil, indexer.AbsentIndexerType, flimsydb.PrimaryKeyFlag)
+	if err != nil {
+		t.Fatalf("Failed to create column 'course': %v", err)
+	}
+	grade, err := flimsydb.NewColumn("grade", cm.Int32TType, nil, indexer.AbsentIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'grade': %v", err)
+	}
+
+	return flimsydb.Scheme{student, course, grade}
+}
+
+func TestCompositePrimaryKey(t *testing.T) {
+	table := flimsydb.NewTable(newPrimaryKeyTestScheme(t))
+
+	for _, values := range []map[string]any{
+		{"student": int32(1), "course": "math", "grade": int32(4)},
+		{"student": int32(1), "course": "art", "grade": int32(5)},
+		{"student": int32(2), "course": "math", "grade": int32(3)},
+	} {
+		if _, err := table.InsertRow(values); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	if _, err := table.InsertRow(map[string]any{"student": int32(1), "course": "math"}); !errors.Is(err, cm.ErrDuplicateKey) {
+		t.Errorf("Expected ErrDuplicateKey, got %v", err)
+	}
+
+	row, err := table.GetByPK(int32(1), "art")
+	if err != nil {
+		t.Fatalf("Failed to get row by key: %v", err)
+	}
+	values, _ := flimsydb.DeserializeRow(newPrimaryKeyTestScheme(t), row)
+	if values[2] != int32(5) {
+		t.Errorf("Expected grade 5, got %v", values[2])
+	}
+
+	if err := table.UpdateByPK(map[string]any{"grade": int32(2)}, int32(2), "math"); err != nil {
+		t.Fatalf("Failed to update row by key: %v", err)
+	}
+	if err := table.UpdateByPK(map[string]any{"course": "math"}, int32(1), "art"); !errors.Is(err, cm.ErrDuplicateKey) {
+		t.Errorf("Expected ErrDuplicateKey when moving onto an existing key, got %v", err)
+	}
+	if err := table.UpdateByPK(map[string]any{"course": "music"}, int32(1), "art"); err != nil {
+		t.Fatalf("Failed to change the key: %v", err)
+	}
+	if _, err := table.GetByPK(int32(1), "art"); !errors.Is(err, cm.ErrRowNotFound) {
+		t.Errorf("Expected the old key to be gone, got %v", err)
+	}
+
+	if err := table.DeleteByPK(int32(1), "music"); err != nil {
+		t.Fatalf("Failed to delete row by key: %v", err)
+	}
+	if err := table.DeleteByPK(int32(1), "music"); !errors.Is(err, cm.ErrRowNotFound) {
+		t.Errorf("Expected ErrRowNotFound, got %v", err)
+	}
+
+	if _, err := table.GetByPK(int32(1)); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected ErrInvalidData for a partial key, got %v", err)
+	}
+	if _, err := table.GetByPK("1", "math"); !errors.Is(err, cm.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v", err)
+	}
+
+	rows, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Errorf("Expected 2 rows, got %d", len(rows))
+	}
+}
+
+func TestGetByPKWithoutKey(t *testing.T) {
+	table := flimsydb.NewTable(newWALTestScheme(t))
+	if _, err := table.GetByPK(int32(1)); !errors.Is(err, cm.ErrNoPrimaryKey) {
+		t.Errorf("Expected ErrNoPrimaryKey, got %v", err)
+	}
+}
+
+func TestPrimaryKeyRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.CreateTable("enrollments", newPrimaryKeyTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("enrollments")
+	if _, err := table.InsertRow(map[string]any{"student": int32(1), "course": "math"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	table, _ = db.GetTable("enrollments")
+	if _, err := table.GetByPK(int32(1), "math"); err != nil {
+		t.Errorf("Failed to get restored row by key: %v", err)
+	}
+	if _, err := table.InsertRow(map[string]any{"student": int32(1), "course": "math"}); !errors.Is(err, cm.ErrDuplicateKey) {
+		t.Errorf("Expected restored key index to reject duplicates, got %v", err)
+	}
+}
+
+func TestWriteByPKFollowsKey(t *testing.T) {
+	standalone := flimsydb.NewTable(newPrimaryKeyTestScheme(t))
+	db := flimsydb.NewFlimsyDB()
+	if err := db.CreateTable("enrollments", newPrimaryKeyTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	linked, err := db.GetTable("enrollments")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+
+	for name, table := range map[string]*flimsydb.Table{"standalone": standalone, "linked": linked} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := table.InsertRow(map[string]any{"student": int32(1), "course": "math", "grade": int32(0)}); err != nil {
+				t.Fatalf("Failed to insert row: %v", err)
+			}
+
+			/* moving the row resets its grade, a write by the old key must not land on the moved row */
+			grades := map[string]int32{"math": 1, "art": 2}
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range 500 {
+					from, to := "math", "art"
+					if i%2 == 1 {
+						from, to = to, from
+					}
+					if err := table.UpdateByPK(map[string]any{"course": to, "grade": int32(0)}, int32(1), from); err != nil {
+						t.Errorf("Failed to move the row: %v", err)
+						return
+					}
+				}
+			}()
+			for course, grade := range grades {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range 500 {
+						err := table.UpdateByPK(map[string]any{"grade": grade}, int32(1), course)
+						if err != nil && !errors.Is(err, cm.ErrRowNotFound) {
+							t.Errorf("Failed to update by key: %v", err)
+							return
+						}
+					}
+				}()
+			}
+			done := make(chan struct{})
+			checked := make(chan struct{})
+			go func() {
+				defer close(checked)
+				for {
+					rows, err := table.GetAll()
+					if err != nil || len(rows) != 1 {
+						t.Errorf("Expected a single row, got %v, %v", rows, err)
+						return
+					}
+					if grade := rows[0][2].(int32); grade != 0 && grade != grades[rows[0][1].(string)] {
+						t.Errorf("Row %v got the grade written for another key", rows[0])
+						return
+					}
+					select {
+					case <-done:
+						return
+					default:
+					}
+				}
+			}()
+			wg.Wait()
+			close(done)
+			<-checked
+
+			if err := table.DeleteByPK(int32(1), "math"); err != nil {
+				t.Fatalf("Failed to delete by key: %v", err)
+			}
+			if err := table.DeleteByPK(int32(1), "math"); !errors.Is(err, cm.ErrRowNotFound) {
+				t.Errorf("Expected ErrRowNotFound for a deleted key, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+func TestProjectionMatchesFullRows(t *testing.T) {
+	table := newPeopleTable(t, true)
+	where := flimsydb.Ge("age", int32(40))
+
+	full, err := table.Query().Where(where).OrderBy("id", flimsydb.Asc).Rows()
+	if err != nil {
+		t.Fatalf("Failed to run query: %v", err)
+	}
+
+	rows, err := table.Query().Select("level", "id").Where(where).OrderBy("id", flimsydb.Asc).Rows()
+	if err != nil {
+		t.Fatalf("Failed to run projected query: %v", err)
+	}
+	records, err := table.Query().Select("id", "level").Where(where).OrderBy("id", flimsydb.Asc).Records()
+	if err != nil {
+		t.Fatalf("Failed to run record query: %v", err)
+	}
+
+	if len(rows) != len(full) || len(records) != len(full) {
+		t.Fatalf("Expected %d rows, got %d rows and %d records", len(full), len(rows), len(records))
+	}
+	for i, row := range full {
+		if want := []any{row[3], row[0]}; !reflect.DeepEqual(rows[i], want) {
+			t.Fatalf("Row %d: expected %v, got %v", i, want, rows[i])
+		}
+		if want := (flimsydb.Record{"id": row[0], "level": row[3]}); !reflect.DeepEqual(records[i], want) {
+			t.Fatalf("Record %d: expected %v, got %v", i, want, records[i])
+		}
+	}
+}
+
+func TestProjectionDefaultsToEveryColumn(t *testing.T) {
+	table := newPeopleTable(t, false)
+
+	records, err := table.Query().Where(flimsydb.Eq("id", int32(7))).Records()
+	if err != nil {
+		t.Fatalf("Failed to run query: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	for _, col := range []string{"id", "city", "age", "level", "score"} {
+		if _, found := records[0][col]; !found {
+			t.Errorf("Expected column '%s' in %v", col, records[0])
+		}
+	}
+}
+
+func TestProjectionErrors(t *testing.T) {
+	table := newPeopleTable(t, true)
+
+	if _, err := table.Query().Select("salary").Rows(); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected ErrColumnNotFound, got %v", err)
+	}
+	opts := flimsydb.ScanOptions{Limit: 10, Columns: []string{"salary"}}
+	if _, _, err := table.Scan("age", "", opts); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected ErrColumnNotFound from Scan, got %v", err)
+	}
+}
+
+func TestScanProjection(t *testing.T) {
+	table := newPeopleTable(t, true)
+
+	opts := flimsydb.ScanOptions{Limit: 20, Where: flimsydb.Ne("age", nil), Columns: []string{"age"}}
+	var last int32 = -1
+	for cursor, pages := flimsydb.Cursor(""), 0; pages == 0 || cursor != ""; pages++ {
+		rows, next, err := table.Scan("age", cursor, opts)
+		if err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		for _, row := range rows {
+			if len(row) != 1 {
+				t.Fatalf("Expected 1 value per row, got %v", row)
+			}
+			age := row[0].(int32)
+			if age < last {
+				t.Fatalf("Ages out of order: %d after %d", age, last)
+			}
+			last = age
+		}
+		cursor = next
+	}
+}
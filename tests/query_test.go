@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+var (
+	queryCities = []string{"Berlin", "Bern", "Paris", "Porto", "Rome"}
+	queryLevels = []string{"junior", "middle", "senior"}
+)
+
+/* newPeopleTable fills a table with the same pseudo-random rows, indexed or not */
+func newPeopleTable(t *testing.T, indexed bool) *flimsydb.Table {
+	idxr := func(idxrType indexer.IndexerType) indexer.IndexerType {
+		if indexed {
+			return idxrType
+		}
+		return indexer.AbsentIndexerType
+	}
+
+	var flags flimsydb.FlagsType
+	if indexed {
+		flags = flimsydb.PrimaryKeyFlag
+	}
+
+	var scheme flimsydb.Scheme
+	for _, def := range []struct {
+		name     string
+		typ      cm.TabularType
+		idxrType indexer.IndexerType
+		flags    flimsydb.FlagsType
+		opts     []flimsydb.ColumnOption
+	}{
+		{"id", cm.Int32TType, indexer.AbsentIndexerType, flags, nil},
+		{"city", cm.StringTType, idxr(indexer.BTreeIndexerType), 0, nil},
+		{"age", cm.Int32TType, idxr(indexer.BTreeIndexerType), 0, nil},
+		{"level", cm.EnumTType, idxr(indexer.HashMapIndexerType), 0, []flimsydb.ColumnOption{flimsydb.WithEnum(queryLevels...)}},
+		{"score", cm.Float64TType, indexer.AbsentIndexerType, 0, nil},
+	} {
+		col, err := flimsydb.NewColumn(def.name, def.typ, nil, def.idxrType, def.flags, def.opts...)
+		if err != nil {
+			t.Fatalf("Failed to create column '%s': %v", def.name, err)
+		}
+		scheme = append(scheme, col)
+	}
+
+	table := flimsydb.NewTable(scheme)
+	if indexed {
+		if err := table.CreateIndex("by_city_level", "city", "level"); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+
+	r := rand.New(rand.NewSource(42))
+	for i := range 300 {
+		values := map[string]any{
+			"id":    int32(i),
+			"city":  queryCities[r.Intn(len(queryCities))],
+			"age":   int32(18 + r.Intn(50)),
+			"level": queryLevels[r.Intn(len(queryLevels))],
+			"score": float64(r.Intn(1000)) / 10,
+		}
+		/* some NULLs in every nullable column */
+		for _, col := range []string{"city", "age", "level", "score"} {
+			if r.Intn(15) == 0 {
+				values[col] = nil
+			}
+		}
+		if _, err := table.InsertRow(values); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	return table
+}
+
+func queryIDs(t *testing.T, table *flimsydb.Table, pred flimsydb.Predicate) []int32 {
+	rows, err := table.Query().Where(pred).Rows()
+	if err != nil {
+		t.Fatalf("Query %v failed: %v", pred, err)
+	}
+
+	ids := make([]int32, len(rows))
+	for i, row := range rows {
+		ids[i] = row[0].(int32)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestQueryPlannerMatchesScan(t *testing.T) {
+	indexed := newPeopleTable(t, true)
+	plain := newPeopleTable(t, false)
+
+	preds := []flimsydb.Predicate{
+		flimsydb.Eq("id", int32(17)),
+		flimsydb.Eq("city", "Paris"),
+		flimsydb.Ne("city", "Paris"),
+		flimsydb.Eq("city", nil),
+		flimsydb.Ne("age", nil),
+		flimsydb.Lt("age", int32(30)),
+		flimsydb.Le("age", int32(30)),
+		flimsydb.Gt("age", int32(60)),
+		flimsydb.Ge("age", int32(60)),
+		flimsydb.Between("age", int32(25), int32(35)),
+		flimsydb.In("level", "junior", "senior"),
+		flimsydb.In("city", "Rome", nil),
+		flimsydb.In("id", int32(1), int32(2), int32(2), int32(999)),
+		flimsydb.Like("city", "Ber%"),
+		flimsydb.Like("city", "P_r%"),
+		flimsydb.Like("level", "%i%"),
+		flimsydb.IsNull("score"),
+		flimsydb.And(flimsydb.Eq("city", "Berlin"), flimsydb.Eq("level", "senior")),
+		flimsydb.And(flimsydb.Eq("city", "Berlin"), flimsydb.Eq("level", "senior"), flimsydb.Gt("age", int32(40))),
+		flimsydb.And(flimsydb.Eq("id", int32(5)), flimsydb.Eq("city", "Rome")),
+		flimsydb.And(flimsydb.Like("city", "Po%"), flimsydb.Lt("score", 50.0)),
+		flimsydb.And(flimsydb.Between("age", int32(20), int32(40)), flimsydb.Eq("level", "middle"), flimsydb.Not(flimsydb.Eq("city", "Bern"))),
+		flimsydb.Or(flimsydb.Eq("city", "Rome"), flimsydb.Gt("age", int32(65))),
+		flimsydb.Or(flimsydb.Eq("city", "Rome"), flimsydb.Gt("score", 99.0)),
+		flimsydb.Or(flimsydb.Like("city", "Ber%"), flimsydb.IsNull("level")),
+		flimsydb.And(flimsydb.Or(flimsydb.Eq("city", "Rome"), flimsydb.Eq("city", "Porto")), flimsydb.Ge("age", int32(50))),
+		flimsydb.Not(flimsydb.And(flimsydb.Eq("level", "junior"), flimsydb.Lt("age", int32(30)))),
+		flimsydb.And(),
+		flimsydb.Or(),
+	}
+
+	for _, pred := range preds {
+		t.Run(pred.String(), func(t *testing.T) {
+			got, want := queryIDs(t, indexed, pred), queryIDs(t, plain, pred)
+			if !slices.Equal(got, want) {
+				t.Errorf("Indexed query returned %d rows, the scan %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestQuerySemantics(t *testing.T) {
+	table := newPeopleTable(t, true)
+
+	all, _ := table.GetAll()
+	var nullAges, young int
+	for _, row := range all {
+		switch {
+		case row[2] == nil:
+			nullAges++
+		case row[2].(int32) < 30:
+			young++
+		}
+	}
+
+	if ids := queryIDs(t, table, flimsydb.Lt("age", int32(30))); len(ids) != young {
+		t.Errorf("Expected %d rows younger than 30 and no NULLs, got %d", young, len(ids))
+	}
+	if ids := queryIDs(t, table, flimsydb.Not(flimsydb.Lt("age", int32(30)))); len(ids) != len(all)-young {
+		t.Errorf("Expected Not to include NULLs, got %d of %d", len(ids), len(all)-young)
+	}
+	if ids := queryIDs(t, table, flimsydb.Eq("age", nil)); len(ids) != nullAges {
+		t.Errorf("Expected Eq with nil to find %d NULLs, got %d", nullAges, len(ids))
+	}
+
+	rows, err := table.Query().Where(flimsydb.Eq("city", "Paris")).Where(flimsydb.Eq("level", "senior")).Rows()
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for _, row := range rows {
+		if row[1] != "Paris" || row[3] != "senior" {
+			t.Errorf("Expected chained Where calls to combine, got %v", row)
+		}
+	}
+
+	for _, pred := range []flimsydb.Predicate{
+		flimsydb.Lt("age", nil),
+		flimsydb.Eq("age", "old"),
+		flimsydb.Eq("height", int32(1)),
+		flimsydb.Like("age", "1%"),
+		flimsydb.Eq("level", "intern"),
+		flimsydb.And(flimsydb.Eq("city", "Rome"), nil),
+	} {
+		if _, err := table.Query().Where(pred).Rows(); err == nil {
+			t.Errorf("Expected %v to be rejected", pred)
+		}
+	}
+	if _, err := table.Query().Where(flimsydb.In("nowhere", 1)).Rows(); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected ErrColumnNotFound, got %v", err)
+	}
+
+	expected := `(city = "Rome" OR age > 60) AND NOT (level IN ("junior", NULL))`
+	pred := flimsydb.And(flimsydb.Or(flimsydb.Eq("city", "Rome"), flimsydb.Gt("age", 60)), flimsydb.Not(flimsydb.In("level", "junior", nil)))
+	if got := fmt.Sprint(pred); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
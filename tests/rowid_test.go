@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+func newRowIDTestTable(t *testing.T) *flimsydb.Table {
+	col1, err := flimsydb.NewColumn("id", cm.Int32TType, int32(0), indexer.HashMapIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'id': %v", err)
+	}
+
+	col2, err := flimsydb.NewColumn("group", cm.Int32TType, int32(0), indexer.BTreeIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'group': %v", err)
+	}
+
+	return flimsydb.NewTable(flimsydb.Scheme{col1, col2})
+}
+
+func TestStableRowIDs(t *testing.T) {
+	table := newRowIDTestTable(t)
+
+	ids := make([]int, 5)
+	for i := range ids {
+		id, err := table.InsertRow(map[string]any{"id": int32(i), "group": int32(i % 2)})
+		if err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+		ids[i] = id
+	}
+
+	if err := table.DeleteRow(ids[1]); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	if err := table.DeleteRow(ids[1]); !errors.Is(err, cm.ErrRowNotFound) {
+		t.Errorf("Expected ErrRowNotFound when deleting twice, got %v", err)
+	}
+
+	row, err := table.GetRow(ids[3])
+	if err != nil {
+		t.Fatalf("Failed to get row by id: %v", err)
+	}
+	if val, _ := flimsydb.Deserialize(cm.Int32TType, row[0]); val != int32(3) {
+		t.Errorf("Expected row id %d to keep value 3, got %v", ids[3], val)
+	}
+
+	newID, err := table.InsertRow(map[string]any{"id": int32(5), "group": int32(1)})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	for _, id := range ids {
+		if id == newID {
+			t.Errorf("Row id %d was reused", newID)
+		}
+	}
+
+	table.Vacuum()
+
+	if err := table.UpdateRow(ids[4], map[string]any{"group": int32(1)}); err != nil {
+		t.Fatalf("Failed to update row after vacuum: %v", err)
+	}
+
+	rows, err := table.Find("group", int32(1))
+	if err != nil {
+		t.Fatalf("Failed to find rows: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Errorf("Expected 3 rows in group 1 after vacuum, got %d", len(rows))
+	}
+}
+
+func TestDeleteManyRows(t *testing.T) {
+	table := newRowIDTestTable(t)
+
+	const count = 20000
+	for i := 0; i < count; i++ {
+		if _, err := table.InsertRow(map[string]any{"id": int32(i), "group": int32(i % 10)}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	for id := 0; id < count; id += 2 {
+		if err := table.DeleteRow(id); err != nil {
+			t.Fatalf("Failed to delete row %d: %v", id, err)
+		}
+	}
+
+	rows, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != count/2 {
+		t.Errorf("Expected %d rows, got %d", count/2, len(rows))
+	}
+
+	found, err := table.Find("id", int32(4001))
+	if err != nil {
+		t.Fatalf("Failed to find row: %v", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("Expected to find surviving row, got %v", found)
+	}
+}
+
+func TestRowIDsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.CreateTable("users", newWALTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("users")
+
+	for i, name := range []string{"Alice", "Bob", "Carol"} {
+		if _, err := table.InsertRow(map[string]any{"id": int32(i), "name": name}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+	if err := table.DeleteRow(2); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	if err := table.DeleteRow(0); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	table, _ = db.GetTable("users")
+
+	row, err := table.GetRow(1)
+	if err != nil {
+		t.Fatalf("Failed to get row by id after restart: %v", err)
+	}
+	if name, _ := flimsydb.Deserialize(cm.StringTType, row[1]); name != "Bob" {
+		t.Errorf("Expected row 1 to be Bob, got %v", name)
+	}
+
+	id, err := table.InsertRow(map[string]any{"id": int32(3), "name": "Dave"})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if id != 3 {
+		t.Errorf("Expected next row id 3 after restart, got %d", id)
+	}
+}
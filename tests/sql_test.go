@@ -0,0 +1,272 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+func mustExec(t *testing.T, db *flimsydb.FlimsyDB, sql string, args ...any) flimsydb.Result {
+	t.Helper()
+
+	result, err := db.Exec(sql, args...)
+	if err != nil {
+		t.Fatalf("Exec %q failed: %v", sql, err)
+	}
+	return result
+}
+
+func mustQuery(t *testing.T, db *flimsydb.FlimsyDB, sql string, args ...any) *flimsydb.ResultSet {
+	t.Helper()
+
+	rs, err := db.Query(sql, args...)
+	if err != nil {
+		t.Fatalf("Query %q failed: %v", sql, err)
+	}
+	return rs
+}
+
+func newSQLDB(t *testing.T) *flimsydb.FlimsyDB {
+	db := flimsydb.NewFlimsyDB()
+
+	mustExec(t, db, `
+		CREATE TABLE employees (
+			id INT PRIMARY KEY,
+			name TEXT NOT NULL INDEX USING HASH,
+			age INT INDEX USING BTREE,
+			salary DECIMAL(10, 2) DEFAULT 1000,
+			level ENUM('junior', 'middle', 'senior') DEFAULT 'junior',
+			email VARCHAR(64) UNIQUE,
+			hired TIMESTAMP
+		);`)
+
+	result := mustExec(t, db, `
+		INSERT INTO employees (id, name, age, salary, level, email, hired) VALUES
+			(1, 'Alice', 34, 5200.50, 'senior', 'alice@example.com', '2020-03-01T09:00:00Z'),
+			(2, 'Bob', 28, 3100, 'junior', NULL, NULL),
+			(3, 'Carol', -1, 4000.25, 'middle', 'carol@example.com', NULL)`)
+	if result.RowsAffected != 3 {
+		t.Fatalf("Expected 3 inserted rows, got %d", result.RowsAffected)
+	}
+
+	mustExec(t, db, "INSERT INTO employees (id, name, age) VALUES (?, ?, ?)", 4, "Dan's", 45)
+	return db
+}
+
+func TestSQLSelect(t *testing.T) {
+	db := newSQLDB(t)
+
+	rs := mustQuery(t, db, "SELECT name, salary FROM employees WHERE age >= ? ORDER BY age DESC LIMIT 2", 20)
+	if !reflect.DeepEqual(rs.Columns, []string{"name", "salary"}) {
+		t.Errorf("Unexpected columns %v", rs.Columns)
+	}
+	want := [][]any{{"Dan's", cm.NewDecimal(100000, 2)}, {"Alice", cm.NewDecimal(520050, 2)}}
+	if !reflect.DeepEqual(rs.Rows, want) {
+		t.Errorf("Expected %v, got %v", want, rs.Rows)
+	}
+
+	for _, tc := range []struct {
+		sql  string
+		args []any
+		want []string
+	}{
+		{"SELECT name FROM employees ORDER BY id", nil, []string{"Alice", "Bob", "Carol", "Dan's"}},
+		{"select name from employees where level = 'junior' order by name", nil, []string{"Bob", "Dan's"}},
+		{"SELECT name FROM employees WHERE email IS NULL ORDER BY id", nil, []string{"Bob", "Dan's"}},
+		{"SELECT name FROM employees WHERE email IS NOT NULL AND age < 0", nil, []string{"Carol"}},
+		{"SELECT name FROM employees WHERE age BETWEEN 30 AND 50 OR name LIKE 'B%' ORDER BY id", nil, []string{"Alice", "Bob", "Dan's"}},
+		{"SELECT name FROM employees WHERE id NOT IN (1, 2) ORDER BY id", nil, []string{"Carol", "Dan's"}},
+		{"SELECT name FROM employees WHERE NOT (level = 'junior') ORDER BY id", nil, []string{"Alice", "Carol"}},
+		{"SELECT name FROM employees WHERE salary > ? ORDER BY id", []any{"4000"}, []string{"Alice", "Carol"}},
+		{"SELECT name FROM employees WHERE hired < ?", []any{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}, []string{"Alice"}},
+		{"SELECT name FROM employees ORDER BY id LIMIT 2 OFFSET 1", nil, []string{"Bob", "Carol"}},
+	} {
+		rs := mustQuery(t, db, tc.sql, tc.args...)
+		got := make([]string, len(rs.Rows))
+		for i, row := range rs.Rows {
+			got[i] = row[0].(string)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.sql, tc.want, got)
+		}
+	}
+
+	records := mustQuery(t, db, "SELECT * FROM employees WHERE id = 1").Records()
+	if len(records) != 1 || records[0]["level"] != "senior" || len(records[0]) != 7 {
+		t.Errorf("Unexpected records %v", records)
+	}
+}
+
+func TestSQLUpdateAndDelete(t *testing.T) {
+	db := newSQLDB(t)
+
+	result := mustExec(t, db, "UPDATE employees SET level = 'middle', salary = ? WHERE level = 'junior'", "2500.5")
+	if result.RowsAffected != 2 {
+		t.Errorf("Expected 2 updated rows, got %d", result.RowsAffected)
+	}
+	rs := mustQuery(t, db, "SELECT id FROM employees WHERE level = 'middle' AND salary = 2500.50 ORDER BY id")
+	if !reflect.DeepEqual(rs.Rows, [][]any{{int32(2)}, {int32(4)}}) {
+		t.Errorf("Unexpected updated rows %v", rs.Rows)
+	}
+
+	/* a failing row leaves every row of the statement unchanged */
+	if _, err := db.Exec("UPDATE employees SET email = 'same@example.com'"); err == nil {
+		t.Errorf("Expected a unique violation")
+	}
+	if rs := mustQuery(t, db, "SELECT id FROM employees WHERE email = 'same@example.com'"); len(rs.Rows) != 0 {
+		t.Errorf("Expected no row to change, got %v", rs.Rows)
+	}
+
+	result = mustExec(t, db, "DELETE FROM employees WHERE age < 30")
+	if result.RowsAffected != 2 {
+		t.Errorf("Expected 2 deleted rows, got %d", result.RowsAffected)
+	}
+	if rs := mustQuery(t, db, "SELECT id FROM employees ORDER BY id"); !reflect.DeepEqual(rs.Rows, [][]any{{int32(1)}, {int32(4)}}) {
+		t.Errorf("Unexpected remaining rows %v", rs.Rows)
+	}
+
+	mustExec(t, db, "DROP TABLE employees")
+	mustExec(t, db, "DROP TABLE IF EXISTS employees")
+	if db.TableExists("employees") {
+		t.Errorf("Expected the table to be dropped")
+	}
+}
+
+func TestSQLConcurrentUpdateAndDelete(t *testing.T) {
+	db := newSQLDB(t)
+
+	/* every statement claims a junior, a row claimed by another statement no longer matches */
+	const claims = 8
+	var wg sync.WaitGroup
+	affected := make([]int, claims)
+	errs := make([]error, claims)
+	for i := range claims {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result flimsydb.Result
+			result, errs[i] = db.Exec("UPDATE employees SET level = 'senior', age = ? WHERE level = 'junior'", i)
+			affected[i] = result.RowsAffected
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range claims {
+		if errs[i] != nil {
+			t.Fatalf("UPDATE failed: %v", errs[i])
+		}
+		total += affected[i]
+	}
+	if rs := mustQuery(t, db, "SELECT id FROM employees WHERE level = 'junior'"); total != 2 || len(rs.Rows) != 0 {
+		t.Errorf("Expected the 2 juniors to be claimed once, got %d claims and %v left", total, rs.Rows)
+	}
+
+	/* a row deleted by another statement is skipped instead of failing */
+	var deleted [claims]int
+	for i := range claims {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := db.Exec("DELETE FROM employees WHERE level = 'senior'")
+			if err != nil {
+				t.Errorf("DELETE failed: %v", err)
+			}
+			deleted[i] = result.RowsAffected
+		}()
+	}
+	wg.Wait()
+
+	total = 0
+	for _, n := range deleted {
+		total += n
+	}
+	if total != 3 {
+		t.Errorf("Expected the 3 seniors to be deleted once, got %d deletions", total)
+	}
+}
+
+func TestSQLCreateTable(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+
+	mustExec(t, db, `CREATE TABLE fixtures (home TEXT, away TEXT, PRIMARY KEY (home, away))`)
+	mustExec(t, db, `CREATE TABLE teams (name TEXT PRIMARY KEY)`)
+	mustExec(t, db, `CREATE TABLE players (
+		id BIGINT PRIMARY KEY,
+		tags TEXT[] INDEX USING INVERTED,
+		team TEXT REFERENCES teams (name) ON DELETE SET NULL,
+		"order" INT INDEX USING BTREE
+	)`)
+
+	fixtures, err := db.GetTable("fixtures")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+	if _, err := fixtures.GetByPK("Reds", "Blues"); !errors.Is(err, cm.ErrRowNotFound) {
+		t.Errorf("Expected a composite primary key, got %v", err)
+	}
+
+	mustExec(t, db, `INSERT INTO players VALUES (1, ?, NULL, 2), (2, ?, NULL, 1)`, []string{"fast", "tall"}, []string{"tall"})
+	players, err := db.GetTable("players")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+	if rows, err := players.FindContaining("tags", "tall"); err != nil || len(rows) != 2 {
+		t.Errorf("Expected 2 tall players, got %v, %v", rows, err)
+	}
+	/* scanning needs the B-tree index declared by the INDEX clause */
+	if rows, _, err := players.Scan("order", "", flimsydb.ScanOptions{Limit: 10}); err != nil || len(rows) != 2 || rows[0][0] != int64(2) {
+		t.Errorf("Expected players in order, got %v, %v", rows, err)
+	}
+}
+
+func TestSQLErrors(t *testing.T) {
+	db := newSQLDB(t)
+
+	for _, tc := range []struct {
+		sql  string
+		args []any
+		want error
+	}{
+		{"SELEC name FROM employees", nil, cm.ErrSyntax},
+		{"SELECT name FROM employees WHERE", nil, cm.ErrSyntax},
+		{"SELECT name FROM employees WHERE name = 'Alice", nil, cm.ErrSyntax},
+		{"CREATE TABLE t (a UNKNOWNTYPE)", nil, cm.ErrSyntax},
+		{"CREATE TABLE t (a INT INDEX USING SKIPLIST)", nil, cm.ErrSyntax},
+		{"SELECT name FROM employees WHERE id = ?", nil, cm.ErrInvalidData},
+		{"SELECT name FROM employees", []any{1}, cm.ErrInvalidData},
+		{"SELECT nickname FROM employees", nil, cm.ErrColumnNotFound},
+		{"SELECT name FROM employees WHERE nickname = 'x'", nil, cm.ErrColumnNotFound},
+		{"SELECT name FROM managers", nil, cm.ErrTableNotFound},
+		{"SELECT name FROM employees WHERE age = 'old'", nil, cm.ErrTypeMismatch},
+		{"SELECT name FROM employees WHERE age = 1.5", nil, cm.ErrTypeMismatch},
+		{"SELECT name FROM employees WHERE age = ?", []any{int64(1) << 40}, cm.ErrTypeMismatch},
+		{"INSERT INTO employees (id, name) VALUES (5)", nil, cm.ErrInvalidData},
+		{"INSERT INTO employees (id, name) VALUES (1, 'Again')", nil, cm.ErrDuplicateKey},
+		{"CREATE TABLE employees (id INT)", nil, cm.ErrTableExists},
+		{"DROP TABLE managers", nil, cm.ErrTableNotFound},
+	} {
+		var err error
+		if strings.HasPrefix(tc.sql, "SELECT") {
+			_, err = db.Query(tc.sql, tc.args...)
+		} else {
+			_, err = db.Exec(tc.sql, tc.args...)
+		}
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.sql, tc.want, err)
+		}
+	}
+
+	if _, err := db.Exec("SELECT name FROM employees"); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected Exec to refuse a query, got %v", err)
+	}
+	if _, err := db.Query("DELETE FROM employees"); !errors.Is(err, cm.ErrInvalidData) {
+		t.Errorf("Expected Query to refuse a statement, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"errors"
 	"testing"
 
 	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
@@ -75,7 +76,7 @@ func TestInsertRow(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := table.InsertRow(tc.values)
+			_, err := table.InsertRow(tc.values)
 			if (err != nil) != tc.wantErr {
 				t.Errorf("InsertRow() error = %v, wantErr %v", err, tc.wantErr)
 			}
@@ -101,7 +102,7 @@ func TestUpdateAndGetRow(t *testing.T) {
 		"id":   int32(1),
 		"name": "Initial",
 	}
-	if err := table.InsertRow(initialValues); err != nil {
+	if _, err := table.InsertRow(initialValues); err != nil {
 		t.Fatalf("Error inserting initial data: %v", err)
 	}
 
@@ -148,7 +149,7 @@ func TestDeleteRow(t *testing.T) {
 	table := flimsydb.NewTable(columns)
 
 	for i := int32(0); i < 3; i++ {
-		if err := table.InsertRow(map[string]any{"id": i}); err != nil {
+		if _, err := table.InsertRow(map[string]any{"id": i}); err != nil {
 			t.Fatalf("Error inserting row %d: %v", i, err)
 		}
 	}
@@ -167,12 +168,16 @@ func TestDeleteRow(t *testing.T) {
 		t.Errorf("Expected id=0, got %v", id0)
 	}
 
-	row1, err := table.GetRow(1)
+	if _, err := table.GetRow(1); !errors.Is(err, cm.ErrRowNotFound) {
+		t.Errorf("Expected ErrRowNotFound for deleted row, got %v", err)
+	}
+
+	row2, err := table.GetRow(2)
 	if err != nil {
-		t.Fatalf("Error getting second row: %v", err)
+		t.Fatalf("Error getting last row: %v", err)
 	}
 
-	id2, err := flimsydb.Deserialize(cm.Int32TType, row1[0])
+	id2, err := flimsydb.Deserialize(cm.Int32TType, row2[0])
 	if err != nil || id2.(int32) != 2 {
 		t.Errorf("Expected id=2, got %v", id2)
 	}
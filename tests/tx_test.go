@@ -0,0 +1,323 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+)
+
+func newTxTestDB(t *testing.T, db *flimsydb.FlimsyDB) {
+	for _, name := range []string{"accounts", "audit"} {
+		if err := db.CreateTable(name, newWALTestScheme(t)); err != nil {
+			t.Fatalf("Failed to create table %s: %v", name, err)
+		}
+	}
+}
+
+func countRows(t *testing.T, db *flimsydb.FlimsyDB, tableName string) int {
+	table, err := db.GetTable(tableName)
+	if err != nil {
+		t.Fatalf("Failed to get table %s: %v", tableName, err)
+	}
+
+	rows, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	return len(rows)
+}
+
+func TestTxCommit(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	newTxTestDB(t, db)
+
+	accounts, _ := db.GetTable("accounts")
+	existingID, err := accounts.InsertRow(map[string]any{"id": int32(1), "name": "Alice"})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	tx := db.Begin()
+	newID, err := tx.InsertRow("accounts", map[string]any{"id": int32(2), "name": "Bob"})
+	if err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+	if _, err := tx.InsertRow("audit", map[string]any{"id": int32(2), "name": "created Bob"}); err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+	if err := tx.UpdateRow("accounts", existingID, map[string]any{"name": "Alicia"}); err != nil {
+		t.Fatalf("Failed to update row in transaction: %v", err)
+	}
+
+	if countRows(t, db, "accounts") != 1 || countRows(t, db, "audit") != 0 {
+		t.Error("Transaction writes are visible before commit")
+	}
+	if _, err := accounts.GetRow(newID); !errors.Is(err, cm.ErrRowNotFound) {
+		t.Errorf("Expected uncommitted row to be invisible, got %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+
+	if countRows(t, db, "accounts") != 2 || countRows(t, db, "audit") != 1 {
+		t.Error("Transaction writes are missing after commit")
+	}
+
+	rows, err := accounts.Find("name", "Alicia")
+	if err != nil {
+		t.Fatalf("Failed to find updated row: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Expected updated row to be indexed, got %v", rows)
+	}
+
+	if err := tx.Commit(); !errors.Is(err, cm.ErrTxDone) {
+		t.Errorf("Expected ErrTxDone on second commit, got %v", err)
+	}
+}
+
+func TestTxRollback(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	newTxTestDB(t, db)
+
+	tx := db.Begin()
+	if _, err := tx.InsertRow("accounts", map[string]any{"id": int32(1), "name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back transaction: %v", err)
+	}
+
+	if countRows(t, db, "accounts") != 0 {
+		t.Error("Rolled back insert is visible")
+	}
+	if _, err := tx.InsertRow("accounts", map[string]any{"id": int32(2)}); !errors.Is(err, cm.ErrTxDone) {
+		t.Errorf("Expected ErrTxDone after rollback, got %v", err)
+	}
+}
+
+func TestTxFailedCommitIsAtomic(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	newTxTestDB(t, db)
+
+	accounts, _ := db.GetTable("accounts")
+	id, err := accounts.InsertRow(map[string]any{"id": int32(1), "name": "Alice"})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	tx := db.Begin()
+	if _, err := tx.InsertRow("audit", map[string]any{"id": int32(1), "name": "deleted Alice"}); err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+	if err := tx.UpdateRow("accounts", id, map[string]any{"name": "Alicia"}); err != nil {
+		t.Fatalf("Failed to update row in transaction: %v", err)
+	}
+	if err := tx.DeleteRow("accounts", id); err != nil {
+		t.Fatalf("Failed to delete row in transaction: %v", err)
+	}
+	if err := tx.DeleteRow("accounts", id+100); err != nil {
+		t.Fatalf("Failed to delete row in transaction: %v", err)
+	}
+
+	if err := tx.Commit(); !errors.Is(err, cm.ErrRowNotFound) {
+		t.Fatalf("Expected commit to fail with ErrRowNotFound, got %v", err)
+	}
+
+	if countRows(t, db, "audit") != 0 {
+		t.Error("Insert of a failed transaction is visible")
+	}
+
+	rows, err := accounts.Find("name", "Alice")
+	if err != nil {
+		t.Fatalf("Failed to find row: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Expected original row to be restored and indexed, got %v", rows)
+	}
+
+	rows, err = accounts.Find("name", "Alicia")
+	if err != nil {
+		t.Fatalf("Failed to find row: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("Expected update of a failed transaction to be undone, got %v", rows)
+	}
+}
+
+func TestTxRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	newTxTestDB(t, db)
+
+	tx := db.Begin()
+	if _, err := tx.InsertRow("accounts", map[string]any{"id": int32(1), "name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+	if _, err := tx.InsertRow("audit", map[string]any{"id": int32(1), "name": "created Alice"}); err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+
+	uncommitted := db.Begin()
+	if _, err := uncommitted.InsertRow("accounts", map[string]any{"id": int32(2), "name": "Bob"}); err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	if countRows(t, db, "accounts") != 1 || countRows(t, db, "audit") != 1 {
+		t.Error("Expected only the committed transaction to be recovered")
+	}
+}
+
+func TestTxReadsOwnWrites(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	newTxTestDB(t, db)
+
+	accounts, _ := db.GetTable("accounts")
+	aliceID, err := accounts.InsertRow(map[string]any{"id": int32(1), "name": "Alice"})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	bobID, err := accounts.InsertRow(map[string]any{"id": int32(2), "name": "Bob"})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	carolID, err := tx.InsertRow("accounts", map[string]any{"id": int32(3), "name": "Carol"})
+	if err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+	if err := tx.UpdateRow("accounts", aliceID, map[string]any{"name": "Alicia"}); err != nil {
+		t.Fatalf("Failed to update row in transaction: %v", err)
+	}
+	if err := tx.DeleteRow("accounts", bobID); err != nil {
+		t.Fatalf("Failed to delete row in transaction: %v", err)
+	}
+
+	if row, err := tx.GetRow("accounts", carolID); err != nil || row == nil {
+		t.Errorf("Expected the transaction to see its insert, got %v", err)
+	}
+	if _, err := tx.GetRow("accounts", bobID); !errors.Is(err, cm.ErrRowNotFound) {
+		t.Errorf("Expected the transaction to see its delete, got %v", err)
+	}
+	if rows, err := tx.Find("accounts", "name", "Alicia"); err != nil || len(rows) != 1 {
+		t.Errorf("Expected the transaction to see its update, got %v, %v", rows, err)
+	}
+	if rows, err := tx.Find("accounts", "name", "Alice"); err != nil || len(rows) != 0 {
+		t.Errorf("Expected the old value to be gone, got %v, %v", rows, err)
+	}
+	if rows, err := tx.FindInRange("accounts", "id", int32(2), int32(3)); err != nil || len(rows) != 1 || rows[0][1] != "Carol" {
+		t.Errorf("Unexpected range %v, %v", rows, err)
+	}
+	rows, err := tx.GetAll("accounts")
+	if err != nil || len(rows) != 2 || rows[0][1] != "Alicia" || rows[1][1] != "Carol" {
+		t.Errorf("Unexpected rows %v, %v", rows, err)
+	}
+
+	/* nobody else sees them before the commit */
+	if countRows(t, db, "accounts") != 2 {
+		t.Error("Transaction writes are visible before commit")
+	}
+}
+
+func TestTxConflict(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	newTxTestDB(t, db)
+
+	accounts, _ := db.GetTable("accounts")
+	id, err := accounts.InsertRow(map[string]any{"id": int32(1), "name": "Alice"})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	otherID, err := accounts.InsertRow(map[string]any{"id": int32(2), "name": "Bob"})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	first, second := db.Begin(), db.Begin()
+	if err := first.UpdateRow("accounts", id, map[string]any{"name": "first"}); err != nil {
+		t.Fatalf("Failed to update row in transaction: %v", err)
+	}
+	if err := second.UpdateRow("accounts", id, map[string]any{"name": "second"}); err != nil {
+		t.Fatalf("Failed to update row in transaction: %v", err)
+	}
+	if _, err := second.InsertRow("audit", map[string]any{"id": int32(1), "name": "renamed"}); err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+
+	if err := first.Commit(); err != nil {
+		t.Fatalf("Failed to commit transaction: %v", err)
+	}
+	if err := second.Commit(); !errors.Is(err, cm.ErrTxConflict) {
+		t.Fatalf("Expected ErrTxConflict, got %v", err)
+	}
+	if rows, _ := accounts.Find("name", "first"); len(rows) != 1 || countRows(t, db, "audit") != 0 {
+		t.Errorf("Expected the conflicting transaction to have no effect, got %v", rows)
+	}
+
+	/* a row deleted after Begin conflicts too */
+	tx := db.Begin()
+	if err := tx.UpdateRow("accounts", otherID, map[string]any{"name": "Robert"}); err != nil {
+		t.Fatalf("Failed to update row in transaction: %v", err)
+	}
+	if err := accounts.DeleteRow(otherID); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, cm.ErrTxConflict) {
+		t.Errorf("Expected ErrTxConflict, got %v", err)
+	}
+
+	/* rows changed by nobody else commit fine */
+	tx = db.Begin()
+	if err := tx.UpdateRow("accounts", id, map[string]any{"name": "again"}); err != nil {
+		t.Fatalf("Failed to update row in transaction: %v", err)
+	}
+	if _, err := accounts.InsertRow(map[string]any{"id": int32(3), "name": "Carol"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Errorf("Expected an unrelated write not to conflict, got %v", err)
+	}
+}
+
+func TestTxCommitAfterClose(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	newTxTestDB(t, db)
+
+	tx := db.Begin()
+	if _, err := tx.InsertRow("accounts", map[string]any{"id": int32(1), "name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert row in transaction: %v", err)
+	}
+	db.Close()
+
+	if err := tx.Commit(); !errors.Is(err, cm.ErrClosed) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+	if countRows(t, db, "accounts") != 0 {
+		t.Error("Expected the refused commit to have no effect")
+	}
+}
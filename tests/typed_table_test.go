@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+type Level string
+
+type Employee struct {
+	ID       int64      `flimsy:"id,pk"`
+	Name     string     `flimsy:"name,index=hash,notnull"`
+	Level    Level      `flimsy:"level,enum=junior|middle|senior,index=btree"`
+	Salary   cm.Decimal `flimsy:"salary,decimal=10.2"`
+	Tags     []string   `flimsy:"tags,index=inverted"`
+	Nickname *string    `flimsy:"nickname"`
+	Manager  *int64     `flimsy:"manager,ref=employees.id,ondelete=setnull"`
+	Note     string     `flimsy:"-"`
+	internal int
+}
+
+func newEmployees(t *testing.T, db *flimsydb.FlimsyDB) *flimsydb.TypedTable[Employee] {
+	employees, err := flimsydb.CreateTypedTable[Employee](db, "employees")
+	if err != nil {
+		t.Fatalf("Failed to create typed table: %v", err)
+	}
+
+	boss := int64(1)
+	nick := "Bobby"
+	for _, e := range []Employee{
+		{ID: 1, Name: "Alice", Level: "senior", Salary: cm.NewDecimal(500000, 2), Tags: []string{"lead"}},
+		{ID: 2, Name: "Bob", Level: "junior", Salary: cm.NewDecimal(250050, 2), Nickname: &nick, Manager: &boss},
+		{ID: 3, Name: "Carol", Level: "middle", Salary: cm.NewDecimal(3500, 0), Tags: []string{"oncall", "lead"}, Manager: &boss},
+	} {
+		if _, err := employees.Insert(e); err != nil {
+			t.Fatalf("Failed to insert %s: %v", e.Name, err)
+		}
+	}
+
+	return employees
+}
+
+func TestTypedTable(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	employees := newEmployees(t, db)
+
+	bob, err := employees.GetByPK(int64(2))
+	if err != nil {
+		t.Fatalf("Failed to get Bob: %v", err)
+	}
+	if bob.Name != "Bob" || bob.Level != "junior" || bob.Salary != cm.NewDecimal(250050, 2) ||
+		bob.Nickname == nil || *bob.Nickname != "Bobby" || bob.Manager == nil || *bob.Manager != 1 || bob.Tags != nil {
+		t.Errorf("Expected Bob to round-trip, got %+v", bob)
+	}
+
+	carols, err := employees.Find("name", "Carol")
+	if err != nil || len(carols) != 1 || carols[0].Salary != cm.NewDecimal(350000, 2) {
+		t.Errorf("Expected Carol with a rescaled salary, got %+v, %v", carols, err)
+	}
+
+	found, err := employees.FindInRange("level", "middle", "senior")
+	if err != nil || len(found) != 2 || found[0].Name != "Carol" || found[1].Name != "Alice" {
+		t.Errorf("Expected Carol and Alice in level order, got %+v, %v", found, err)
+	}
+
+	leads, err := employees.FindContaining("tags", "lead")
+	if err != nil || len(leads) != 2 {
+		t.Errorf("Expected 2 leads, got %+v, %v", leads, err)
+	}
+
+	bob.Level = "middle"
+	bob.Nickname = nil
+	if err := employees.Update(1, bob); err != nil {
+		t.Fatalf("Failed to update Bob: %v", err)
+	}
+	if bob, _ = employees.Get(1); bob.Level != "middle" || bob.Nickname != nil {
+		t.Errorf("Expected the update to change the level and clear the nickname, got %+v", bob)
+	}
+
+	if _, err := employees.Insert(Employee{ID: 4, Name: "Dave", Level: "intern"}); !errors.Is(err, cm.ErrTypeMismatch) {
+		t.Errorf("Expected an unknown level to be rejected, got %v", err)
+	}
+	if _, err := employees.Insert(Employee{ID: 1, Name: "Eve", Level: "junior"}); !errors.Is(err, cm.ErrDuplicateKey) {
+		t.Errorf("Expected a duplicate key to be rejected, got %v", err)
+	}
+
+	/* deleting the boss clears the manager of the others */
+	if err := employees.Table().DeleteByPK(int64(1)); err != nil {
+		t.Fatalf("Failed to delete Alice: %v", err)
+	}
+	all, err := employees.All()
+	if err != nil || len(all) != 2 {
+		t.Fatalf("Expected 2 employees, got %+v, %v", all, err)
+	}
+	for _, e := range all {
+		if e.Manager != nil {
+			t.Errorf("Expected the manager of %s to be cleared, got %d", e.Name, *e.Manager)
+		}
+	}
+}
+
+func TestTypedTableBinding(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	employees := newEmployees(t, db)
+
+	type Badge struct {
+		Name string `flimsy:"name"`
+		Tags []string
+	}
+	if _, err := flimsydb.NewTypedTable[Badge](employees.Table()); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected a field without a column to be rejected, got %v", err)
+	}
+
+	type Summary struct {
+		Name  string   `flimsy:"name"`
+		Level string   `flimsy:"level"`
+		Tags  []string `flimsy:"tags"`
+	}
+	summaries, err := flimsydb.NewTypedTable[Summary](employees.Table())
+	if err != nil {
+		t.Fatalf("Failed to bind a partial struct: %v", err)
+	}
+	rows, err := summaries.Find("name", "Carol")
+	if err != nil || len(rows) != 1 || rows[0].Level != "middle" || !slices.Equal(rows[0].Tags, []string{"oncall", "lead"}) {
+		t.Errorf("Expected Carol's summary, got %+v, %v", rows, err)
+	}
+
+	type WrongType struct {
+		Name int32 `flimsy:"name"`
+	}
+	if _, err := flimsydb.NewTypedTable[WrongType](employees.Table()); !errors.Is(err, cm.ErrTypeMismatch) {
+		t.Errorf("Expected a field of the wrong type to be rejected, got %v", err)
+	}
+
+	type Unsupported struct {
+		Count int `flimsy:"count"`
+	}
+	if _, err := flimsydb.SchemeOf[Unsupported](); err == nil {
+		t.Error("Expected an int field to be rejected")
+	}
+
+	type BadIndex struct {
+		Name string `flimsy:"name,index=inverted"`
+	}
+	if _, err := flimsydb.SchemeOf[BadIndex](); err == nil {
+		t.Error("Expected an inverted index on a string field to be rejected")
+	}
+
+	scheme, err := flimsydb.SchemeOf[Employee]()
+	if err != nil || len(scheme) != 7 || scheme[0].Flags&flimsydb.PrimaryKeyFlag == 0 || scheme[4].IdxrType != indexer.InvertedIndexerType {
+		t.Errorf("Expected the scheme to follow the tags, got %v, %v", scheme, err)
+	}
+}
+
+func TestTypedColumns(t *testing.T) {
+	db := flimsydb.NewFlimsyDB()
+	employees := newEmployees(t, db)
+
+	id, err := flimsydb.Field(employees, func(e *Employee) *int64 { return &e.ID })
+	if err != nil {
+		t.Fatalf("Failed to get the id column: %v", err)
+	}
+	bob, err := id.Get(2)
+	if err != nil || bob.Name != "Bob" {
+		t.Errorf("Expected Bob by primary key, got %+v, %v", bob, err)
+	}
+
+	name, err := flimsydb.Field(employees, func(e *Employee) *string { return &e.Name })
+	if err != nil || name.Name() != "name" {
+		t.Fatalf("Failed to get the name column: %v", err)
+	}
+	carols, err := name.Find("Carol")
+	if err != nil || len(carols) != 1 || carols[0].ID != 3 {
+		t.Errorf("Expected Carol, got %+v, %v", carols, err)
+	}
+
+	level, err := flimsydb.Field(employees, func(e *Employee) *Level { return &e.Level })
+	if err != nil {
+		t.Fatalf("Failed to get the level column: %v", err)
+	}
+	found, err := level.FindInRange("middle", "senior")
+	if err != nil || len(found) != 2 || found[0].Name != "Carol" || found[1].Name != "Alice" {
+		t.Errorf("Expected Carol and Alice in level order, got %+v, %v", found, err)
+	}
+
+	manager, err := flimsydb.Field(employees, func(e *Employee) **int64 { return &e.Manager })
+	if err != nil {
+		t.Fatalf("Failed to get the manager column: %v", err)
+	}
+	boss := int64(1)
+	reports, err := manager.Find(&boss)
+	if err != nil || len(reports) != 2 {
+		t.Errorf("Expected 2 reports, got %+v, %v", reports, err)
+	}
+
+	tags, err := flimsydb.ArrayField(employees, func(e *Employee) *[]string { return &e.Tags })
+	if err != nil {
+		t.Fatalf("Failed to get the tags column: %v", err)
+	}
+	leads, err := tags.FindContaining("lead")
+	if err != nil || len(leads) != 2 {
+		t.Errorf("Expected 2 leads, got %+v, %v", leads, err)
+	}
+
+	if _, err := flimsydb.Field(employees, func(e *Employee) *string { return &e.Note }); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected a field without a column to be rejected, got %v", err)
+	}
+	if _, err := flimsydb.Field(employees, func(e *Employee) *string { return new(string) }); !errors.Is(err, cm.ErrColumnNotFound) {
+		t.Errorf("Expected a pointer outside the struct to be rejected, got %v", err)
+	}
+}
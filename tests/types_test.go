@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+func newEventsScheme(t *testing.T) flimsydb.Scheme {
+	var scheme flimsydb.Scheme
+	for _, def := range []struct {
+		name     string
+		typ      cm.TabularType
+		idxrType indexer.IndexerType
+	}{
+		{"id", cm.Int64TType, indexer.HashMapIndexerType},
+		{"at", cm.TimestampTType, indexer.BTreeIndexerType},
+		{"done", cm.BoolTType, indexer.HashMapIndexerType},
+		{"payload", cm.BytesTType, indexer.AbsentIndexerType},
+	} {
+		col, err := flimsydb.NewColumn(def.name, def.typ, nil, def.idxrType, 0)
+		if err != nil {
+			t.Fatalf("Failed to create column '%s': %v", def.name, err)
+		}
+		scheme = append(scheme, col)
+	}
+
+	return scheme
+}
+
+func TestExtendedTypes(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.CreateTable("events", newEventsScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("events")
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := int64(0); i < 5; i++ {
+		values := map[string]any{
+			"id":      int64(1)<<40 + i,
+			"at":      start.Add(time.Duration(i) * time.Hour),
+			"done":    i%2 == 0,
+			"payload": []byte{byte(i), 0x00},
+		}
+		if _, err := table.InsertRow(values); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	if _, err := table.InsertRow(map[string]any{"id": int32(1)}); err == nil {
+		t.Error("Expected type mismatch for an int32 in an int64 column")
+	}
+	if _, err := table.InsertRow(map[string]any{"at": time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC)}); err == nil {
+		t.Error("Expected error for a timestamp out of range")
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	table, _ = db.GetTable("events")
+
+	found, err := table.Find("id", int64(1)<<40+3)
+	if err != nil || len(found) != 1 {
+		t.Fatalf("Expected to find a large id, got %v, %v", found, err)
+	}
+	if !bytes.Equal(found[0][3].([]byte), []byte{3, 0x00}) {
+		t.Errorf("Unexpected payload %v", found[0][3])
+	}
+
+	found, err = table.FindInRange("at", start.Add(time.Hour), start.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to find range: %v", err)
+	}
+	if len(found) != 3 || !found[0][1].(time.Time).Equal(start.Add(time.Hour)) {
+		t.Errorf("Unexpected timestamp range %v", found)
+	}
+
+	found, err = table.Find("done", true)
+	if err != nil || len(found) != 3 {
+		t.Errorf("Expected 3 done events, got %v, %v", found, err)
+	}
+
+	flimsydb.PrintTable(table)
+}
@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	flimsydb "github.com/ndgde/flimsy-db/cmd/flimsydb"
+	cm "github.com/ndgde/flimsy-db/cmd/flimsydb/common"
+	"github.com/ndgde/flimsy-db/cmd/flimsydb/indexer"
+)
+
+func newWALTestScheme(t *testing.T) flimsydb.Scheme {
+	col1, err := flimsydb.NewColumn("id", cm.Int32TType, int32(0), indexer.HashMapIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'id': %v", err)
+	}
+
+	col2, err := flimsydb.NewColumn("name", cm.StringTType, "", indexer.BTreeIndexerType, 0)
+	if err != nil {
+		t.Fatalf("Failed to create column 'name': %v", err)
+	}
+
+	return flimsydb.Scheme{col1, col2}
+}
+
+func TestWALRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	if err := db.CreateTable("users", newWALTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := db.CreateTable("dropped", newWALTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	table, err := db.GetTable("users")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+
+	for i, name := range []string{"Alice", "Bob", "Carol"} {
+		if _, err := table.InsertRow(map[string]any{"id": int32(i), "name": name}); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	if err := table.UpdateRow(1, map[string]any{"name": "Robert"}); err != nil {
+		t.Fatalf("Failed to update row: %v", err)
+	}
+	if err := table.DeleteRow(0); err != nil {
+		t.Fatalf("Failed to delete row: %v", err)
+	}
+	if err := db.DeleteTable("dropped"); err != nil {
+		t.Fatalf("Failed to delete table: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	if db.TableExists("dropped") {
+		t.Error("Deleted table was restored")
+	}
+
+	table, err = db.GetTable("users")
+	if err != nil {
+		t.Fatalf("Failed to get restored table: %v", err)
+	}
+
+	rows, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read restored rows: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 restored rows, got %d", len(rows))
+	}
+	if rows[0][1] != "Robert" || rows[1][1] != "Carol" {
+		t.Errorf("Unexpected restored rows: %v", rows)
+	}
+
+	found, err := table.Find("name", "Carol")
+	if err != nil {
+		t.Fatalf("Failed to find by restored index: %v", err)
+	}
+	if len(found) != 1 || found[0][0] != int32(2) {
+		t.Errorf("Expected restored index to find Carol, got %v", found)
+	}
+
+	found, err = table.Find("id", int32(0))
+	if err != nil {
+		t.Fatalf("Failed to find by restored index: %v", err)
+	}
+	if len(found) != 0 {
+		t.Errorf("Expected deleted row to be absent from the index, got %v", found)
+	}
+}
+
+func TestWALTornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.CreateTable("users", newWALTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, _ := db.GetTable("users")
+	if _, err := table.InsertRow(map[string]any{"id": int32(1), "name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	db.Close()
+
+	logFile, err := os.OpenFile(filepath.Join(dir, "wal.log"), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	if _, err := logFile.Write([]byte{0, 0, 1, 0, 0xde, 0xad}); err != nil {
+		t.Fatalf("Failed to damage log file: %v", err)
+	}
+	logFile.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database with torn tail: %v", err)
+	}
+	table, _ = db.GetTable("users")
+	if _, err := table.InsertRow(map[string]any{"id": int32(2), "name": "Bob"}); err != nil {
+		t.Fatalf("Failed to insert row after recovery: %v", err)
+	}
+	db.Close()
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	table, _ = db.GetTable("users")
+	rows, err := table.GetAll()
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Errorf("Expected 2 rows after recovery, got %d", len(rows))
+	}
+}
+
+func TestWritesAfterClose(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.CreateTable("users", newWALTestScheme(t)); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	table, err := db.GetTable("users")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+	if _, err := table.InsertRow(map[string]any{"id": int32(1), "name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Expected closing twice to succeed, got %v", err)
+	}
+
+	/* nothing may look written once the log is gone */
+	if _, err := table.InsertRow(map[string]any{"id": int32(2), "name": "Bob"}); !errors.Is(err, cm.ErrClosed) {
+		t.Errorf("Expected ErrClosed from InsertRow, got %v", err)
+	}
+	if err := table.UpdateRow(0, map[string]any{"name": "Alicia"}); !errors.Is(err, cm.ErrClosed) {
+		t.Errorf("Expected ErrClosed from UpdateRow, got %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO users VALUES (3, 'Carol')"); !errors.Is(err, cm.ErrClosed) {
+		t.Errorf("Expected ErrClosed from Exec, got %v", err)
+	}
+	if err := db.CreateTable("other", newWALTestScheme(t)); !errors.Is(err, cm.ErrClosed) {
+		t.Errorf("Expected ErrClosed from CreateTable, got %v", err)
+	}
+	if err := db.DeleteTable("users"); !errors.Is(err, cm.ErrClosed) {
+		t.Errorf("Expected ErrClosed from DeleteTable, got %v", err)
+	}
+	if err := db.Checkpoint(); !errors.Is(err, cm.ErrClosed) {
+		t.Errorf("Expected ErrClosed from Checkpoint, got %v", err)
+	}
+	if err := table.CreateIndex("by_both", "id", "name"); !errors.Is(err, cm.ErrClosed) {
+		t.Errorf("Expected ErrClosed from CreateIndex, got %v", err)
+	}
+
+	/* reads keep working on what was there */
+	if rows, err := table.GetAll(); err != nil || len(rows) != 1 {
+		t.Errorf("Expected the row written before closing, got %v, %v", rows, err)
+	}
+
+	db, err = flimsydb.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	if !db.TableExists("users") || db.TableExists("other") {
+		t.Errorf("Unexpected tables %v", db.ListTables())
+	}
+	reopened, err := db.GetTable("users")
+	if err != nil {
+		t.Fatalf("Failed to get table: %v", err)
+	}
+	if rows, err := reopened.GetAll(); err != nil || len(rows) != 1 {
+		t.Errorf("Expected only the row written before closing, got %v, %v", rows, err)
+	}
+}